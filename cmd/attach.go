@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"ducker/container"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+// detachKeysFlag run、start、attach 共用的脱离按键参数
+var detachKeysFlag = &cli.StringFlag{
+	Name:  "detach-keys",
+	Usage: "Override the key sequence for detaching a container",
+	Value: container.DefaultDetachKeys,
+}
+
+var Attach = &cli.Command{
+	Name:      "attach",
+	Usage:     "Attach local standard input, output, and error streams to a running container",
+	ArgsUsage: "CONTAINER",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-stdin",
+			Usage: "Do not attach STDIN",
+		},
+		&cli.BoolFlag{
+			Name:  "sig-proxy",
+			Usage: "Proxy all received signals to the process",
+			Value: true,
+		},
+		detachKeysFlag,
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("exactly one container ID required")
+		}
+		return container.Attach(c.Args().First(), c.Bool("no-stdin"), c.Bool("sig-proxy"), c.String("detach-keys"))
+	},
+}
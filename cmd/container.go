@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+var Container = &cli.Command{
+	Name:  "container",
+	Usage: "Manage containers",
+	Subcommands: []*cli.Command{
+		inspectCommand("container"),
+	},
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"ducker/container"
+	"ducker/image"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+var Create = &cli.Command{
+	Name:                   "create",
+	Usage:                  "Create a new container",
+	ArgsUsage:              "IMAGE [COMMAND] [ARG...]",
+	UseShortOptionHandling: true,
+	Flags:                  runFlags,
+	Action: func(c *cli.Context) error {
+		if c.NArg() < 1 {
+			return fmt.Errorf("please specify an image name")
+		}
+
+		imageName := c.Args().Get(0)
+		imageRunOpts, err := image.GetRunOptions(imageName)
+		if err != nil {
+			return err
+		}
+
+		opts, err := buildRunOptions(c, imageRunOpts)
+		if err != nil {
+			return err
+		}
+		cont, err := container.Create(c.String("name"), imageName, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(cont.ID)
+		return nil
+	},
+}
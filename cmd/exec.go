@@ -1,22 +1,32 @@
 package cmd
 
 import (
+	"bufio"
 	"ducker/container"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 )
 
 var Exec = &cli.Command{
-	Name:      "exec",
-	Usage:     "Run a command in a running container",
-	ArgsUsage: "CONTAINER COMMAND [ARG...]",
+	Name:                   "exec",
+	Usage:                  "Run a command in a running container",
+	ArgsUsage:              "CONTAINER COMMAND [ARG...]",
+	UseShortOptionHandling: true,
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
 			Name:    "interactive",
-			Aliases: []string{"i", "it"},
+			Aliases: []string{"i"},
 			Usage:   "Keep STDIN open even if not attached",
 		},
+		&cli.BoolFlag{
+			Name:    "tty",
+			Aliases: []string{"t"},
+			Usage:   "Allocate a pseudo-TTY",
+		},
+		interactiveTtyFlag,
 		&cli.BoolFlag{
 			Name:    "detach",
 			Aliases: []string{"d"},
@@ -27,6 +37,27 @@ var Exec = &cli.Command{
 			Aliases: []string{"e"},
 			Usage:   "Set environment variables",
 		},
+		&cli.StringSliceFlag{
+			Name:  "env-file",
+			Usage: "Read in a file of environment variables",
+		},
+		&cli.StringFlag{
+			Name:    "user",
+			Aliases: []string{"u"},
+			Usage:   "Username or UID (format: <name|uid>[:<group|gid>])",
+		},
+		&cli.BoolFlag{
+			Name:  "privileged",
+			Usage: "Give extended privileges to the command",
+		},
+		&cli.StringSliceFlag{
+			Name:  "cap-add",
+			Usage: "Add Linux capabilities to the command",
+		},
+		&cli.StringSliceFlag{
+			Name:  "cap-drop",
+			Usage: "Drop Linux capabilities from the command",
+		},
 		&cli.StringFlag{
 			Name:    "workdir",
 			Aliases: []string{"w"},
@@ -37,8 +68,78 @@ var Exec = &cli.Command{
 		if c.NArg() < 2 {
 			return fmt.Errorf("usage: ducker exec [OPTIONS] CONTAINER COMMAND [ARG...]")
 		}
-		containerName := c.Args().Get(0)
-		interactive := c.Bool("interactive") || !c.Bool("detach")
-		return container.Exec(containerName, interactive, c.StringSlice("env"), c.Args().Slice()[1:], c.String("workdir"))
+		var env []string
+		for _, path := range c.StringSlice("env-file") {
+			vars, err := parseEnvFile(path)
+			if err != nil {
+				return err
+			}
+			env = append(env, vars...)
+		}
+		env = append(env, c.StringSlice("env")...)
+
+		capAdd, err := container.ParseCapabilities(c.StringSlice("cap-add"))
+		if err != nil {
+			return err
+		}
+		capDrop, err := container.ParseCapabilities(c.StringSlice("cap-drop"))
+		if err != nil {
+			return err
+		}
+
+		exitCode, err := container.Exec(c.Args().Get(0), &container.ExecOptions{
+			Interactive: c.Bool("interactive") || c.Bool("it") || !c.Bool("detach"),
+			Tty:         c.Bool("tty") || c.Bool("it"),
+			Detach:      c.Bool("detach"),
+			Privileged:  c.Bool("privileged"),
+			CapAdd:      capAdd,
+			CapDrop:     capDrop,
+			User:        c.String("user"),
+			Env:         env,
+			WorkDir:     c.String("workdir"),
+			Cmd:         c.Args().Slice()[1:],
+		})
+		if err != nil {
+			return err
+		}
+		// 以命令的退出码作为 ducker 的退出码
+		if exitCode != 0 {
+			return cli.Exit("", exitCode)
+		}
+		return nil
 	},
 }
+
+// parseEnvFile 读取每行一个 KEY=VALUE 的环境变量文件，忽略空行和 # 开头的注释；
+// 只有变量名的行取当前环境中的值，当前环境未设置时忽略
+func parseEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open env file: %w", err)
+	}
+	defer file.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, _, hasValue := strings.Cut(line, "=")
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid variable %q in env file %s line %d", name, path, lineNo)
+		}
+		if !hasValue {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+			continue
+		}
+		env = append(env, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+	return env, nil
+}
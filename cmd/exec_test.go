@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	t.Setenv("DUCKER_TEST_INHERITED", "from-host")
+	os.Unsetenv("DUCKER_TEST_UNSET")
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "values",
+			content: "A=1\nB=x=y\nEMPTY=\n",
+			want:    []string{"A=1", "B=x=y", "EMPTY="},
+		},
+		{
+			name:    "comments and blank lines",
+			content: "# comment\n\n   \nA=1\n  # indented comment\nB=2 # not a comment\n",
+			want:    []string{"A=1", "B=2 # not a comment"},
+		},
+		{
+			name:    "inherited from environment",
+			content: "DUCKER_TEST_INHERITED\nDUCKER_TEST_UNSET\nA=1\n",
+			want:    []string{"DUCKER_TEST_INHERITED=from-host", "A=1"},
+		},
+		{
+			name:    "surrounding whitespace",
+			content: "  A=1  \r\n",
+			want:    []string{"A=1"},
+		},
+		{name: "missing name", content: "=value\n", wantErr: true},
+		{name: "space in name", content: "A B=1\n", wantErr: true},
+		{name: "space before equals", content: "A =1\n", wantErr: true},
+		{name: "bare words", content: "not a variable\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "env")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseEnvFile(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseEnvFile() = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEnvFile() error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseEnvFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvFileMissing(t *testing.T) {
+	if _, err := parseEnvFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("parseEnvFile(missing) succeeded, want error")
+	}
+}
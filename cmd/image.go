@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+var Image = &cli.Command{
+	Name:  "image",
+	Usage: "Manage images",
+	Subcommands: []*cli.Command{
+		inspectCommand("image"),
+	},
+}
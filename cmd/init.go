@@ -2,10 +2,19 @@ package cmd
 
 import (
 	"ducker/container"
+	"os"
+	"runtime"
 
 	"github.com/urfave/cli/v2"
 )
 
+func init() {
+	// 容器进程在主线程上创建 cgroup 命名空间，/proc/PID/ns 中看到的是主线程的命名空间
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		runtime.LockOSThread()
+	}
+}
+
 var Init = &cli.Command{
 	Name:   "init",
 	Hidden: true,
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"ducker/container"
+	"ducker/image"
+	network "ducker/net"
+	"ducker/util"
+	"ducker/volume"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+// inspectFunc 根据名称或 ID 获取对象详情
+type inspectFunc func(nameOrID string) (any, error)
+
+var inspectors = map[string]inspectFunc{
+	"container": func(target string) (any, error) { return container.Inspect(target) },
+	"image":     func(target string) (any, error) { return image.Inspect(target) },
+	"network":   func(target string) (any, error) { return network.Inspect(target) },
+	"volume":    func(target string) (any, error) { return volume.Inspect(target) },
+}
+
+// inspectOrder 未指定 --type 时按此顺序查找对象
+var inspectOrder = []string{"container", "image", "network", "volume"}
+
+var formatFlag = &cli.StringFlag{
+	Name:    "format",
+	Aliases: []string{"f"},
+	Usage:   "Format output using a Go template",
+}
+
+var Inspect = &cli.Command{
+	Name:      "inspect",
+	Usage:     "Return low-level information on Ducker objects",
+	ArgsUsage: "NAME|ID [NAME|ID...]",
+	Flags: []cli.Flag{
+		formatFlag,
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "Return JSON for specified type (container, image, network, volume)",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return fmt.Errorf("at least one object name required")
+		}
+		objType := c.String("type")
+		if objType == "" {
+			return runInspect(c, inspectAny)
+		}
+		inspect, ok := inspectors[objType]
+		if !ok {
+			return fmt.Errorf("unknown object type: %s", objType)
+		}
+		return runInspect(c, inspect)
+	},
+}
+
+// inspectCommand 生成各资源组下的 inspect 子命令
+func inspectCommand(objType string) *cli.Command {
+	return &cli.Command{
+		Name:      "inspect",
+		Usage:     fmt.Sprintf("Display detailed information on one or more %ss", objType),
+		ArgsUsage: fmt.Sprintf("%s [%s...]", objType, objType),
+		Flags:     []cli.Flag{formatFlag},
+		Action: func(c *cli.Context) error {
+			if c.NArg() == 0 {
+				return fmt.Errorf("at least one %s name required", objType)
+			}
+			return runInspect(c, inspectors[objType])
+		},
+	}
+}
+
+func inspectAny(target string) (any, error) {
+	for _, objType := range inspectOrder {
+		if info, err := inspectors[objType](target); err == nil {
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("no such object: %s", target)
+}
+
+func runInspect(c *cli.Context, inspect inspectFunc) error {
+	items := make([]any, 0, c.NArg())
+	for _, target := range c.Args().Slice() {
+		info, err := inspect(target)
+		if err != nil {
+			return err
+		}
+		items = append(items, info)
+	}
+	return util.PrintInspect(items, c.String("format"))
+}
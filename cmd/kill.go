@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"ducker/container"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+var Kill = &cli.Command{
+	Name:      "kill",
+	Usage:     "Kill one or more running containers",
+	ArgsUsage: "CONTAINER [CONTAINER...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "signal",
+			Aliases: []string{"s"},
+			Usage:   "Signal to send to the container (name or number)",
+			Value:   "KILL",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return fmt.Errorf("at least one container ID required")
+		}
+		return container.Kill(c.Args().Slice(), c.String("signal"))
+	},
+}
@@ -51,6 +51,7 @@ var Network = &cli.Command{
 				return network.List(c.Bool("quiet"))
 			},
 		},
+		inspectCommand("network"),
 		{
 			Name:  "rm",
 			Usage: "Remove one or more networks",
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"ducker/container"
+
+	"github.com/urfave/cli/v2"
+)
+
+var Nsexec = &cli.Command{
+	Name:   "nsexec",
+	Hidden: true,
+	Action: func(c *cli.Context) error {
+		return container.RunNsexec()
+	},
+}
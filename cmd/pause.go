@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"ducker/container"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+var Pause = &cli.Command{
+	Name:      "pause",
+	Usage:     "Pause all processes within one or more containers",
+	ArgsUsage: "CONTAINER [CONTAINER...]",
+	Action: func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return fmt.Errorf("at least one container ID required")
+		}
+		return container.Pause(c.Args().Slice())
+	},
+}
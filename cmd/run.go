@@ -3,6 +3,8 @@ package cmd
 import (
 	"ducker/container"
 	"ducker/image"
+	"ducker/limit"
+	"ducker/util"
 	"fmt"
 	"strconv"
 	"strings"
@@ -15,59 +17,14 @@ var Run = &cli.Command{
 	Usage:                  "Create and run a new container",
 	ArgsUsage:              "IMAGE [COMMAND] [ARG...]",
 	UseShortOptionHandling: true,
-	Flags: []cli.Flag{
-		&cli.StringFlag{
-			Name:  "name",
-			Usage: "Assign a name to the container",
-		},
-		&cli.BoolFlag{
-			Name:    "interactive",
-			Aliases: []string{"it", "i"},
-			Usage:   "Keep STDIN open even if not attached",
-		},
+	Flags: append(runFlags,
 		&cli.BoolFlag{
 			Name:    "detach",
 			Aliases: []string{"d"},
 			Usage:   "Run container in background and print container ID",
 		},
-		&cli.BoolFlag{
-			Name:  "rm",
-			Usage: "Automatically remove the container when it exits",
-		},
-		&cli.StringFlag{
-			Name:    "workdir",
-			Aliases: []string{"w"},
-			Usage:   "Working directory inside the container",
-		},
-		&cli.StringSliceFlag{
-			Name:    "env",
-			Aliases: []string{"e"},
-			Usage:   "Set environment variables",
-		},
-		&cli.StringSliceFlag{
-			Name:    "volume",
-			Aliases: []string{"v"},
-			Usage:   "Bind mount a volume (host_path:container_path)",
-		},
-		&cli.StringFlag{
-			Name:  "network",
-			Usage: "Connect a container to a network",
-		},
-		&cli.StringSliceFlag{
-			Name:    "publish",
-			Aliases: []string{"p"},
-			Usage:   "Publish a container's port(s) to the host",
-		},
-		&cli.Float64Flag{
-			Name:  "cpus",
-			Usage: "Number of CPUs",
-		},
-		&cli.StringFlag{
-			Name:    "memory",
-			Aliases: []string{"m"},
-			Usage:   "Memory limit",
-		},
-	},
+		detachKeysFlag,
+	),
 	Action: func(c *cli.Context) error {
 		if c.NArg() < 1 {
 			return fmt.Errorf("please specify an image name")
@@ -81,13 +38,213 @@ var Run = &cli.Command{
 			return err
 		}
 
-		opts := buildRunOptions(c, imageRunOpts)
-		_, err = container.Run(containerName, imageName, opts)
+		opts, err := buildRunOptions(c, imageRunOpts)
+		if err != nil {
+			return err
+		}
+		// 前台运行时保持标准输入打开
+		opts.Interactive = opts.Interactive || !c.Bool("detach")
+		_, err = container.Run(containerName, imageName, opts, c.Bool("detach"), c.String("detach-keys"))
 		return err
 	},
 }
 
-func buildRunOptions(ctx *cli.Context, imageOpts *image.RunOptions) *container.RunOptions {
+// interactiveTtyFlag run、create、exec 共用的 --it 参数，兼容旧版本的写法，等同于 -i -t
+// 不能作为 interactive 的别名，否则 -it 会被解析为该参数而不再拆分为 -i -t
+var interactiveTtyFlag = &cli.BoolFlag{
+	Name:  "it",
+	Usage: "Keep STDIN open and allocate a pseudo-TTY, same as -i -t",
+}
+
+// runFlags run 与 create 共用的容器配置参数
+var runFlags = append([]cli.Flag{
+	&cli.StringFlag{
+		Name:  "name",
+		Usage: "Assign a name to the container",
+	},
+	&cli.BoolFlag{
+		Name:    "interactive",
+		Aliases: []string{"i"},
+		Usage:   "Keep STDIN open even if not attached",
+	},
+	&cli.BoolFlag{
+		Name:    "tty",
+		Aliases: []string{"t"},
+		Usage:   "Allocate a pseudo-TTY",
+	},
+	interactiveTtyFlag,
+	&cli.BoolFlag{
+		Name:    "init",
+		Usage:   "Run an init inside the container that forwards signals and reaps processes",
+		EnvVars: []string{"DUCKER_INIT"},
+	},
+	&cli.BoolFlag{
+		Name:  "rm",
+		Usage: "Automatically remove the container when it exits",
+	},
+	&cli.StringFlag{
+		Name:  "restart",
+		Usage: "Restart policy to apply when a container exits (no, on-failure[:max-retries], always, unless-stopped)",
+		Value: container.RestartNo,
+	},
+	&cli.StringFlag{
+		Name:    "workdir",
+		Aliases: []string{"w"},
+		Usage:   "Working directory inside the container",
+	},
+	&cli.StringFlag{
+		Name:    "user",
+		Aliases: []string{"u"},
+		Usage:   "Username or UID (format: <name|uid>[:<group|gid>])",
+	},
+	&cli.StringFlag{
+		Name:  "userns-remap",
+		Usage: "Run in a user namespace with container root mapped to an unprivileged host ID range (default, or uid[:gid])",
+	},
+	&cli.BoolFlag{
+		Name:  "privileged",
+		Usage: "Give extended privileges to this container",
+	},
+	&cli.StringSliceFlag{
+		Name:  "cap-add",
+		Usage: "Add Linux capabilities",
+	},
+	&cli.StringSliceFlag{
+		Name:  "cap-drop",
+		Usage: "Drop Linux capabilities",
+	},
+	&cli.StringSliceFlag{
+		Name:  "security-opt",
+		Usage: "Security options (seccomp=unconfined, seccomp=profile.json, no-new-privileges=false)",
+	},
+	&cli.StringSliceFlag{
+		Name:    "env",
+		Aliases: []string{"e"},
+		Usage:   "Set environment variables",
+	},
+	&cli.StringSliceFlag{
+		Name:    "volume",
+		Aliases: []string{"v"},
+		Usage:   "Bind mount a volume (host_path:container_path)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "tmpfs",
+		Usage: "Mount a tmpfs directory (/path[:size=64m,mode=1777])",
+	},
+	&cli.StringSliceFlag{
+		Name:  "device",
+		Usage: "Add a host device to the container (host_path[:container_path][:rwm])",
+	},
+	&cli.BoolFlag{
+		Name:  "read-only",
+		Usage: "Mount the container's root filesystem as read only",
+	},
+	&cli.StringFlag{
+		Name:  "hostname",
+		Usage: "Container host name (defaults to the container ID)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "add-host",
+		Usage: "Add a custom host-to-IP mapping (host:ip)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "dns",
+		Usage: "Set custom DNS servers",
+	},
+	&cli.StringSliceFlag{
+		Name:  "dns-search",
+		Usage: "Set custom DNS search domains",
+	},
+	&cli.StringSliceFlag{
+		Name:  "dns-option",
+		Usage: "Set DNS options",
+	},
+	&cli.StringFlag{
+		Name:  "network",
+		Usage: "Connect a container to a network (network name, host, none or container:<name|id>)",
+	},
+	&cli.StringFlag{
+		Name:  "pid",
+		Usage: "PID namespace to use (host or container:<name|id>)",
+	},
+	&cli.StringFlag{
+		Name:  "ipc",
+		Usage: "IPC namespace to use (private, host or container:<name|id>)",
+	},
+	&cli.StringFlag{
+		Name:  "uts",
+		Usage: "UTS namespace to use (host)",
+	},
+	&cli.StringFlag{
+		Name:  "cgroupns",
+		Usage: "Cgroup namespace to use (private or host)",
+	},
+	&cli.StringSliceFlag{
+		Name:    "publish",
+		Aliases: []string{"p"},
+		Usage:   "Publish a container's port(s) to the host",
+	},
+	&cli.BoolFlag{
+		Name:  "oom-kill-disable",
+		Usage: "Disable OOM Killer",
+	},
+	&cli.StringSliceFlag{
+		Name:  "device-read-bps",
+		Usage: "Limit read rate (bytes per second) from a device (device_path:rate)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "device-write-bps",
+		Usage: "Limit write rate (bytes per second) to a device (device_path:rate)",
+	},
+	&cli.StringFlag{
+		Name:  "stop-signal",
+		Usage: "Signal to stop the container (default SIGTERM)",
+	},
+	&cli.IntFlag{
+		Name:  "stop-timeout",
+		Usage: "Timeout (in seconds) to stop a container (default 10)",
+	},
+}, resourceFlags...)
+
+// resourceFlags run、create 与 update 共用的资源限制参数
+var resourceFlags = []cli.Flag{
+	&cli.Float64Flag{
+		Name:  "cpus",
+		Usage: "Number of CPUs",
+	},
+	&cli.Uint64Flag{
+		Name:    "cpu-shares",
+		Aliases: []string{"c"},
+		Usage:   "CPU shares (relative weight)",
+	},
+	&cli.StringFlag{
+		Name:  "cpuset-cpus",
+		Usage: "CPUs in which to allow execution (0-3, 0,1)",
+	},
+	&cli.StringFlag{
+		Name:  "cpuset-mems",
+		Usage: "MEMs in which to allow execution (0-3, 0,1)",
+	},
+	&cli.StringFlag{
+		Name:    "memory",
+		Aliases: []string{"m"},
+		Usage:   "Memory limit",
+	},
+	&cli.StringFlag{
+		Name:  "memory-swap",
+		Usage: "Swap limit equal to memory plus swap: '-1' to enable unlimited swap",
+	},
+	&cli.StringFlag{
+		Name:  "memory-reservation",
+		Usage: "Memory soft limit",
+	},
+	&cli.Int64Flag{
+		Name:  "pids-limit",
+		Usage: "Tune container pids limit (set -1 for unlimited)",
+	},
+}
+
+func buildRunOptions(ctx *cli.Context, imageOpts *image.RunOptions) (*container.RunOptions, error) {
 	coalesce := func(value, fallback string) string {
 		if value != "" {
 			return value
@@ -101,18 +258,192 @@ func buildRunOptions(ctx *cli.Context, imageOpts *image.RunOptions) *container.R
 		return fallback
 	}
 
+	restart, err := container.ParseRestartPolicy(ctx.String("restart"))
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Bool("rm") && !restart.IsNone() {
+		return nil, fmt.Errorf("conflicting options: --restart and --rm")
+	}
+
+	stopSignal := coalesce(ctx.String("stop-signal"), imageOpts.StopSignal)
+	if stopSignal != "" {
+		if _, err := util.ParseSignal(stopSignal); err != nil {
+			return nil, err
+		}
+	}
+	var stopTimeout *int
+	if ctx.IsSet("stop-timeout") {
+		timeout := ctx.Int("stop-timeout")
+		stopTimeout = &timeout
+	}
+
+	usernsRemap, err := container.ParseUsernsRemap(ctx.String("userns-remap"))
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := map[string]string{}
+	for flag, kind := range map[string]string{"network": "net", "pid": "pid", "ipc": "ipc", "uts": "uts", "cgroupns": "cgroup"} {
+		mode, err := container.ParseNamespaceMode(kind, ctx.String(flag))
+		if err != nil {
+			return nil, err
+		}
+		namespaces[flag] = mode
+		// 与宿主机或其他容器共用的命名空间不属于容器的用户命名空间，容器内的 root 无法管理
+		shared := mode == container.NamespaceHost || strings.HasPrefix(mode, container.NamespaceContainerPrefix)
+		if shared && usernsRemap != nil {
+			return nil, fmt.Errorf("conflicting options: --userns-remap and --%s %s", flag, ctx.String(flag))
+		}
+		if flag == "network" && (shared || mode == container.NetworkNone) && ctx.IsSet("publish") {
+			return nil, fmt.Errorf("conflicting options: --publish and --network %s", ctx.String(flag))
+		}
+		// 加入其他容器的网络命名空间时使用该容器的主机名、hosts 和 resolv.conf
+		if flag == "network" && strings.HasPrefix(mode, container.NamespaceContainerPrefix) {
+			for _, dnsFlag := range []string{"hostname", "add-host", "dns", "dns-search", "dns-option"} {
+				if ctx.IsSet(dnsFlag) {
+					return nil, fmt.Errorf("conflicting options: --%s and --network %s", dnsFlag, ctx.String(flag))
+				}
+			}
+		}
+		if flag == "uts" && shared && ctx.IsSet("hostname") {
+			return nil, fmt.Errorf("conflicting options: --hostname and --uts %s", ctx.String(flag))
+		}
+	}
+
+	capAdd, err := container.ParseCapabilities(ctx.StringSlice("cap-add"))
+	if err != nil {
+		return nil, err
+	}
+	capDrop, err := container.ParseCapabilities(ctx.StringSlice("cap-drop"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := container.ValidateHostname(ctx.String("hostname")); err != nil {
+		return nil, err
+	}
+	if err := container.ValidateExtraHosts(ctx.StringSlice("add-host")); err != nil {
+		return nil, err
+	}
+	if err := container.ValidateNameservers(ctx.StringSlice("dns")); err != nil {
+		return nil, err
+	}
+
+	tmpfs, err := container.ParseTmpfs(ctx.StringSlice("tmpfs"))
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := container.ParseDevices(ctx.StringSlice("device"))
+	if err != nil {
+		return nil, err
+	}
+
+	security, err := container.ParseSecurityOpts(ctx.StringSlice("security-opt"))
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := parseResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := resources.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &container.RunOptions{
-		Interactive: ctx.Bool("interactive") || !ctx.Bool("detach"),
-		AutoRemove:  ctx.Bool("rm"),
-		Volume:      parseKeyValueArgs(ctx.StringSlice("volume")),
-		Ports:       parseKeyValueArgs(ctx.StringSlice("publish")),
-		Network:     ctx.String("network"),
-		CPUs:        ctx.Float64("cpus"),
-		Memory:      parseMemoryString(ctx.String("memory")),
-		WorkDir:     coalesce(ctx.String("workdir"), imageOpts.WorkDir),
-		Env:         coalesceSlice(ctx.StringSlice("env"), imageOpts.Env),
-		Cmd:         coalesceSlice(ctx.Args().Tail(), imageOpts.Cmd),
+		Interactive:    ctx.Bool("interactive") || ctx.Bool("it"),
+		Tty:            ctx.Bool("tty") || ctx.Bool("it"),
+		AutoRemove:     ctx.Bool("rm"),
+		Restart:        restart,
+		Init:           ctx.Bool("init"),
+		Volume:         parseKeyValueArgs(ctx.StringSlice("volume")),
+		Tmpfs:          tmpfs,
+		ReadonlyRootfs: ctx.Bool("read-only"),
+		Devices:        devices,
+		Ports:          parseKeyValueArgs(ctx.StringSlice("publish")),
+		Network:        namespaces["network"],
+		Hostname:       ctx.String("hostname"),
+		ExtraHosts:     ctx.StringSlice("add-host"),
+		DNS:            ctx.StringSlice("dns"),
+		DNSSearch:      ctx.StringSlice("dns-search"),
+		DNSOptions:     ctx.StringSlice("dns-option"),
+		PidMode:        namespaces["pid"],
+		IpcMode:        namespaces["ipc"],
+		UTSMode:        namespaces["uts"],
+		CgroupnsMode:   namespaces["cgroupns"],
+		Resources:      *resources,
+		WorkDir:        coalesce(ctx.String("workdir"), imageOpts.WorkDir),
+		Env:            coalesceSlice(ctx.StringSlice("env"), imageOpts.Env),
+		Cmd:            coalesceSlice(ctx.Args().Tail(), imageOpts.Cmd),
+		User:           coalesce(ctx.String("user"), imageOpts.User),
+		UsernsRemap:    usernsRemap,
+		Privileged:     ctx.Bool("privileged"),
+		CapAdd:         capAdd,
+		CapDrop:        capDrop,
+		SecurityOpt:    ctx.StringSlice("security-opt"),
+		Security:       *security,
+		StopSignal:     stopSignal,
+		StopTimeout:    stopTimeout,
+	}, nil
+}
+
+// parseResources 解析资源限制参数，未指定的限制为零值
+func parseResources(ctx *cli.Context) (*limit.Resources, error) {
+	resources := &limit.Resources{
+		CPUs:           ctx.Float64("cpus"),
+		CPUShares:      ctx.Uint64("cpu-shares"),
+		CpusetCpus:     ctx.String("cpuset-cpus"),
+		CpusetMems:     ctx.String("cpuset-mems"),
+		OOMKillDisable: ctx.Bool("oom-kill-disable"),
+		PidsLimit:      ctx.Int64("pids-limit"),
+	}
+
+	var err error
+	// -1 与 0 都表示不限制内存
+	if memory := ctx.String("memory"); memory != "-1" {
+		if resources.Memory, err = parseMemoryString(memory); err != nil {
+			return nil, fmt.Errorf("invalid --memory: %w", err)
+		}
+	}
+	if resources.MemoryReservation, err = parseMemoryString(ctx.String("memory-reservation")); err != nil {
+		return nil, fmt.Errorf("invalid --memory-reservation: %w", err)
+	}
+	if swap := ctx.String("memory-swap"); swap == "-1" {
+		resources.MemorySwap = -1
+	} else {
+		size, err := parseMemoryString(swap)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --memory-swap: %w", err)
+		}
+		resources.MemorySwap = int64(size)
+	}
+	if resources.DeviceReadBps, err = parseThrottleDevices(ctx.StringSlice("device-read-bps")); err != nil {
+		return nil, fmt.Errorf("invalid --device-read-bps: %w", err)
 	}
+	if resources.DeviceWriteBps, err = parseThrottleDevices(ctx.StringSlice("device-write-bps")); err != nil {
+		return nil, fmt.Errorf("invalid --device-write-bps: %w", err)
+	}
+	return resources, nil
+}
+
+// parseThrottleDevices 解析 device_path:rate 格式的设备速率限制，速率支持 k/m/g 后缀
+func parseThrottleDevices(specs []string) ([]limit.ThrottleDevice, error) {
+	var devices []limit.ThrottleDevice
+	for _, spec := range specs {
+		path, rateStr, ok := strings.Cut(spec, ":")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("expected device_path:rate, got %q", spec)
+		}
+		rate, err := parseMemoryString(rateStr)
+		if err != nil || rate == 0 {
+			return nil, fmt.Errorf("invalid rate %q", rateStr)
+		}
+		devices = append(devices, limit.ThrottleDevice{Path: path, Rate: rate})
+	}
+	return devices, nil
 }
 
 func parseKeyValueArgs(args []string) map[string]string {
@@ -126,14 +457,15 @@ func parseKeyValueArgs(args []string) map[string]string {
 	return result
 }
 
-// parseMemoryString 解析内存字符串，支持 k/m/g 后缀
-func parseMemoryString(memStr string) uint64 {
+// parseMemoryString 解析内存字符串，支持 k/m/g 后缀（可带 b，如 512mb），空字符串为 0
+func parseMemoryString(memStr string) (uint64, error) {
+	original := memStr
+	memStr = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(memStr)), "b")
 	if memStr == "" {
-		return 0
-	}
-	memStr = strings.ToLower(strings.TrimSpace(memStr))
-	if memStr == "" {
-		return 0
+		if strings.TrimSpace(original) == "" {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("invalid size: %q", original)
 	}
 
 	multiplier := uint64(1)
@@ -152,7 +484,7 @@ func parseMemoryString(memStr string) uint64 {
 
 	val, err := strconv.ParseUint(memStr, 10, 64)
 	if err != nil {
-		return 0
+		return 0, fmt.Errorf("invalid size: %q", original)
 	}
-	return val * multiplier
+	return val * multiplier, nil
 }
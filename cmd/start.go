@@ -8,9 +8,10 @@ import (
 )
 
 var Start = &cli.Command{
-	Name:      "start",
-	Usage:     "Start one or more stopped containers",
-	ArgsUsage: "CONTAINER [CONTAINER...]",
+	Name:                   "start",
+	Usage:                  "Start one or more stopped containers",
+	ArgsUsage:              "CONTAINER [CONTAINER...]",
+	UseShortOptionHandling: true,
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
 			Name:    "attach",
@@ -22,11 +23,12 @@ var Start = &cli.Command{
 			Aliases: []string{"i"},
 			Usage:   "Attach STDIN when --attach is used",
 		},
+		detachKeysFlag,
 	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() == 0 {
 			return fmt.Errorf("at least one container ID required")
 		}
-		return container.Start(c.Args().Slice(), c.Bool("attach"), c.Bool("interactive"))
+		return container.Start(c.Args().Slice(), c.Bool("attach"), c.Bool("interactive"), c.String("detach-keys"))
 	},
 }
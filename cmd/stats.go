@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"ducker/container"
+
+	"github.com/urfave/cli/v2"
+)
+
+var Stats = &cli.Command{
+	Name:      "stats",
+	Usage:     "Display a live stream of container(s) resource usage statistics",
+	ArgsUsage: "[CONTAINER...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-stream",
+			Usage: "Disable streaming stats and only pull the first result",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		return container.Stats(c.Args().Slice(), c.Bool("no-stream"))
+	},
+}
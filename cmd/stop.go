@@ -15,14 +15,17 @@ var Stop = &cli.Command{
 		&cli.IntFlag{
 			Name:    "time",
 			Aliases: []string{"t"},
-			Usage:   "Seconds to wait for stop before killing the container",
-			Value:   10,
+			Usage:   "Seconds to wait for stop before killing the container (default: the container's --stop-timeout, or 10)",
 		},
 	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() == 0 {
 			return fmt.Errorf("at least one container ID required")
 		}
-		return container.Stop(c.Args().Slice(), c.Int("time"))
+		timeout := -1 // 未指定时使用容器配置的超时时间
+		if c.IsSet("time") {
+			timeout = c.Int("time")
+		}
+		return container.Stop(c.Args().Slice(), timeout)
 	},
 }
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"ducker/container"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+var Top = &cli.Command{
+	Name:      "top",
+	Usage:     "Display the running processes of a container",
+	ArgsUsage: "CONTAINER",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("exactly one container ID required")
+		}
+		return container.Top(c.Args().First())
+	},
+}
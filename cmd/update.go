@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"ducker/container"
+	"ducker/limit"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+var Update = &cli.Command{
+	Name:      "update",
+	Usage:     "Update configuration of one or more containers",
+	ArgsUsage: "CONTAINER [CONTAINER...]",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "restart",
+			Usage: "Restart policy to apply when a container exits",
+		},
+	}, resourceFlags...),
+	Action: func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return fmt.Errorf("at least one container ID required")
+		}
+
+		changes, err := parseResources(c)
+		if err != nil {
+			return err
+		}
+		// 未设置的选项保持不变，显式指定 --cpus 0 时取消 CPU 核数限制，--memory -1 或 0 时取消内存限制
+		if c.IsSet("cpus") && changes.CPUs == 0 {
+			changes.CPUs = limit.CPUsUnlimited
+		}
+		if c.IsSet("memory") && changes.Memory == 0 {
+			changes.Memory = limit.MemoryUnlimited
+		}
+		var restart *container.RestartPolicy
+		if c.IsSet("restart") {
+			policy, err := container.ParseRestartPolicy(c.String("restart"))
+			if err != nil {
+				return err
+			}
+			restart = &policy
+		}
+		return container.Update(c.Args().Slice(), changes, restart)
+	},
+}
@@ -44,16 +44,6 @@ var Volume = &cli.Command{
 				return nil
 			},
 		},
-		{
-			Name:      "inspect",
-			Usage:     "Display detailed information on a volume",
-			ArgsUsage: "VOLUME",
-			Action: func(c *cli.Context) error {
-				if c.NArg() < 1 {
-					return fmt.Errorf("requires 1 argument")
-				}
-				return volume.Inspect(c.Args().First())
-			},
-		},
+		inspectCommand("volume"),
 	},
 }
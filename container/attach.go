@@ -0,0 +1,557 @@
+package container
+
+import (
+	"ducker/util"
+	"encoding/binary"
+	"fmt"
+	"io"
+	gonet "net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultDetachKeys 默认的脱离容器按键序列
+	DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+	// attach 数据帧的流类型，客户端发送的空 stdin 帧表示关闭容器标准输入
+	streamStdin  byte = 0
+	streamStdout byte = 1
+	streamStderr byte = 2
+	streamResize byte = 3 // 客户端终端窗口大小变化
+	streamError  byte = 4 // 监控进程主动断开客户端的原因
+
+	frameHeaderSize = 8
+	maxFrameSize    = 1 << 20
+
+	// attachAcceptTimeout 前台启动时监控进程等待客户端连接的超时时间
+	attachAcceptTimeout = 10 * time.Second
+	// attachQueueSize 通过 attach 命令连接的客户端待发送的输出帧数上限，队列满时断开该客户端
+	// 发起前台启动的客户端不受此限制
+	attachQueueSize = 64
+	// attachWriteTimeout 向 attach 命令连接的客户端写入一帧的超时时间，超时的客户端被断开
+	// 前台客户端仅在容器退出后发送剩余输出时有此超时
+	attachWriteTimeout = 10 * time.Second
+
+	// errSlowClient 输出队列已满的客户端被断开时发送的原因
+	errSlowClient = "client too slow to read container output, disconnected"
+)
+
+// encodeFrame 编码数据帧：1 字节流类型 + 3 字节保留 + 4 字节大端长度 + 数据
+func encodeFrame(stream byte, data []byte) []byte {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(data))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+func writeFrame(w io.Writer, stream byte, data []byte) error {
+	_, err := w.Write(encodeFrame(stream, data))
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame too large: %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return header[0], data, nil
+}
+
+// ParseDetachKeys 解析脱离按键序列，格式为逗号分隔的单个字符或 ctrl-<a-z|@|[|\|]|^|_>
+func ParseDetachKeys(s string) ([]byte, error) {
+	if s == "" {
+		s = DefaultDetachKeys
+	}
+	var keys []byte
+	for _, key := range strings.Split(s, ",") {
+		name, isCtrl := strings.CutPrefix(strings.ToLower(key), "ctrl-")
+		switch {
+		case !isCtrl && len(key) == 1:
+			keys = append(keys, key[0])
+		case isCtrl && len(name) == 1 && name[0] >= 'a' && name[0] <= 'z':
+			keys = append(keys, name[0]-'a'+1)
+		case isCtrl && len(name) == 1 && strings.Contains("@[\\]^_", name):
+			keys = append(keys, name[0]-'@')
+		default:
+			return nil, fmt.Errorf("invalid detach keys: %s", s)
+		}
+	}
+	return keys, nil
+}
+
+// ========== 监控进程侧 ==========
+
+// attachServer 监控进程持有的容器标准输入输出
+// 容器输出写入日志并转发给所有 attach 的客户端，客户端输入写入容器标准输入
+type attachServer struct {
+	listener *gonet.UnixListener
+	logFile  *os.File
+
+	// clients 客户端连接 -> 待发送的输出帧队列，由各自的写协程发送，慢客户端不会阻塞容器输出
+	mu      sync.Mutex
+	clients map[*gonet.UnixConn]*attachClient
+	closed  bool
+	writers sync.WaitGroup
+
+	stdinMu sync.Mutex
+	stdin   *os.File // 当前容器进程标准输入管道的写端，未开启 -i 或已关闭时为 nil
+
+	// 以 --tty 运行时容器的伪终端主设备、最近一次的窗口大小及输出转发结束通知
+	tty        *os.File
+	winsize    *unix.Winsize
+	ttyDrained chan struct{}
+
+	closeOnce sync.Once
+}
+
+func newAttachServer(containerID string, listener *gonet.UnixListener) (*attachServer, error) {
+	logPath := util.GetContainerLogPath(containerID)
+	if err := util.EnsureDir(filepath.Dir(logPath)); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open log file: %w", err)
+	}
+	return &attachServer{
+		listener: listener,
+		logFile:  logFile,
+		clients:  make(map[*gonet.UnixConn]*attachClient),
+	}, nil
+}
+
+// attachClient 客户端待发送的输出帧队列，与 attachServer 共用 mu
+// foreground 为发起前台启动的客户端，其队列不限长度，不会因读取缓慢被断开
+type attachClient struct {
+	conn       *gonet.UnixConn
+	foreground bool
+	frames     [][]byte
+	closed     bool // 不再有新的输出，发送完剩余的帧后关闭连接
+	ready      *sync.Cond
+}
+
+// acceptFirst 等待发起前台启动的客户端连接，保证其收到容器的全部输出
+func (s *attachServer) acceptFirst() error {
+	s.listener.SetDeadline(time.Now().Add(attachAcceptTimeout))
+	defer s.listener.SetDeadline(time.Time{})
+
+	conn, err := s.listener.AcceptUnix()
+	if err != nil {
+		return fmt.Errorf("accept attach client: %w", err)
+	}
+	s.addClient(conn, true)
+	return nil
+}
+
+// serve 持续接收客户端连接，直到 listener 被关闭
+func (s *attachServer) serve() {
+	for {
+		conn, err := s.listener.AcceptUnix()
+		if err != nil {
+			return
+		}
+		s.addClient(conn, false)
+	}
+}
+
+func (s *attachServer) addClient(conn *gonet.UnixConn, foreground bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return
+	}
+	client := &attachClient{conn: conn, foreground: foreground, ready: sync.NewCond(&s.mu)}
+	s.clients[conn] = client
+	s.writers.Add(1)
+	go s.writeOutput(client)
+	go s.handleInput(conn)
+}
+
+// removeClient 断开客户端并丢弃尚未发送的输出
+func (s *attachServer) removeClient(conn *gonet.UnixConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropClient(conn, "")
+}
+
+// dropClient 断开客户端并丢弃尚未发送的输出，调用方需持有 s.mu
+// reason 非空时改为向客户端发送该原因后再断开，客户端据此报错退出
+func (s *attachServer) dropClient(conn *gonet.UnixConn, reason string) {
+	client, ok := s.clients[conn]
+	if !ok {
+		return
+	}
+	delete(s.clients, conn)
+	client.frames = nil
+	if reason == "" {
+		conn.Close()
+	} else {
+		client.frames = append(client.frames, encodeFrame(streamError, []byte(reason)))
+	}
+	client.closed = true
+	client.ready.Signal()
+}
+
+// writeOutput 依次发送队列中的输出帧，队列关闭且发送完毕后关闭连接
+func (s *attachServer) writeOutput(client *attachClient) {
+	defer s.writers.Done()
+	defer client.conn.Close()
+	for {
+		frame, ok := s.nextFrame(client)
+		if !ok {
+			return
+		}
+		if _, err := client.conn.Write(frame); err != nil {
+			s.removeClient(client.conn)
+			return
+		}
+	}
+}
+
+// nextFrame 等待并取出客户端的下一帧，队列已关闭且为空时返回 false
+// 写入超时在持有 s.mu 时设置，避免覆盖 close 为前台客户端设置的超时
+func (s *attachServer) nextFrame(client *attachClient) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(client.frames) == 0 && !client.closed {
+		client.ready.Wait()
+	}
+	if len(client.frames) == 0 {
+		return nil, false
+	}
+	frame := client.frames[0]
+	client.frames[0] = nil
+	client.frames = client.frames[1:]
+
+	if client.foreground && !client.closed {
+		client.conn.SetWriteDeadline(time.Time{})
+	} else {
+		client.conn.SetWriteDeadline(time.Now().Add(attachWriteTimeout))
+	}
+	return frame, true
+}
+
+// handleInput 将客户端输入写入容器标准输入，客户端断开（脱离）时不影响容器
+func (s *attachServer) handleInput(conn *gonet.UnixConn) {
+	defer s.removeClient(conn)
+	for {
+		stream, data, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		switch stream {
+		case streamStdin:
+			s.writeStdin(data)
+		case streamResize:
+			s.resize(decodeWinsize(data))
+		}
+	}
+}
+
+// writeStdin 写入容器标准输入，空数据表示客户端输入结束，伪终端模式下忽略
+func (s *attachServer) writeStdin(data []byte) {
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+	if s.stdin == nil {
+		return
+	}
+	if len(data) > 0 {
+		s.stdin.Write(data)
+	} else if s.tty == nil {
+		s.stdin.Close()
+		s.stdin = nil
+	}
+}
+
+func (s *attachServer) resize(ws *unix.Winsize) {
+	if ws == nil {
+		return
+	}
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+	s.winsize = ws
+	if s.tty != nil {
+		util.SetWinsize(s.tty.Fd(), ws)
+	}
+}
+
+// wire 将容器进程的输入输出接入 attach 服务：tty 时分配伪终端，否则 openStdin 时为其创建标准输入管道
+// 返回的子进程一端需要在子进程启动后由父进程关闭
+func (s *attachServer) wire(cmd *exec.Cmd, tty, openStdin bool) (*os.File, error) {
+	if tty {
+		return s.wireTerminal(cmd)
+	}
+
+	cmd.Stdout = &streamWriter{server: s, stream: streamStdout}
+	cmd.Stderr = &streamWriter{server: s, stream: streamStderr}
+	if !openStdin {
+		return nil, nil
+	}
+
+	stdinRead, stdinWrite, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create stdin pipe: %w", err)
+	}
+	cmd.Stdin = stdinRead
+
+	s.stdinMu.Lock()
+	if s.stdin != nil {
+		s.stdin.Close()
+	}
+	s.stdin = stdinWrite
+	s.stdinMu.Unlock()
+	return stdinRead, nil
+}
+
+// wireTerminal 分配伪终端作为容器进程的控制终端，输出统一作为 stdout 转发
+func (s *attachServer) wireTerminal(cmd *exec.Cmd) (*os.File, error) {
+	master, slave, err := util.OpenPty()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+
+	s.stdinMu.Lock()
+	if s.stdin != nil {
+		s.stdin.Close()
+	}
+	s.stdin, s.tty = master, master
+	if s.winsize != nil {
+		util.SetWinsize(master.Fd(), s.winsize)
+	}
+	drained := make(chan struct{})
+	s.ttyDrained = drained
+	s.stdinMu.Unlock()
+
+	go func() {
+		defer close(drained)
+		io.Copy(&streamWriter{server: s, stream: streamStdout}, master) // 从设备全部关闭后读取返回 EIO
+	}()
+	return slave, nil
+}
+
+// closeStdin 容器进程退出后关闭其标准输入，伪终端模式下先等待剩余输出转发完毕
+func (s *attachServer) closeStdin() {
+	s.stdinMu.Lock()
+	drained := s.ttyDrained
+	s.stdinMu.Unlock()
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-time.After(ttyDrainTimeout):
+		}
+	}
+
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+	if s.stdin != nil {
+		s.stdin.Close()
+	}
+	s.stdin, s.tty, s.ttyDrained = nil, nil, nil
+}
+
+// broadcast 将输出写入日志并放入所有客户端的发送队列，不等待网络写入
+// 前台客户端的队列不限长度，其余客户端队列已满时被断开并收到断开原因
+func (s *attachServer) broadcast(stream byte, data []byte) {
+	frame := encodeFrame(stream, data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logFile.Write(data)
+	for conn, client := range s.clients {
+		if !client.foreground && len(client.frames) >= attachQueueSize {
+			s.dropClient(conn, errSlowClient)
+			continue
+		}
+		client.frames = append(client.frames, frame)
+		client.ready.Signal()
+	}
+}
+
+// close 停止接收连接，将剩余输出发送给客户端后断开，客户端据此得知容器已退出
+func (s *attachServer) close() {
+	s.closeOnce.Do(func() {
+		s.listener.Close()
+		os.Remove(s.listener.Addr().String())
+		s.closeStdin()
+
+		s.mu.Lock()
+		s.closed = true
+		for conn, client := range s.clients {
+			// 前台客户端正在进行的写入没有超时，此后的写入均有超时
+			client.conn.SetWriteDeadline(time.Now().Add(attachWriteTimeout))
+			client.closed = true
+			client.ready.Signal()
+			delete(s.clients, conn)
+		}
+		s.mu.Unlock()
+
+		// 每帧的写入有超时，不会无限等待
+		s.writers.Wait()
+		s.mu.Lock()
+		s.logFile.Close()
+		s.mu.Unlock()
+	})
+}
+
+// streamWriter 将容器进程的某一路输出写入 attach 服务
+type streamWriter struct {
+	server *attachServer
+	stream byte
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.server.broadcast(w.stream, p)
+	return len(p), nil
+}
+
+// ========== 客户端侧 ==========
+
+// dialAttach 连接容器的 attach socket
+func dialAttach(containerID string) (*gonet.UnixConn, error) {
+	addr := &gonet.UnixAddr{Name: util.GetContainerAttachSocketPath(containerID), Net: "unix"}
+	conn, err := gonet.DialUnix("unix", nil, addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect attach socket: %w", err)
+	}
+	return conn, nil
+}
+
+// attachStreams 将当前终端连接到容器，直到容器退出或输入脱离按键序列
+// sigProxy 时将连接期间收到的信号转发给容器进程；被监控进程断开时返回其给出的原因
+func (c *container) attachStreams(conn *gonet.UnixConn, withStdin, sigProxy bool, detachKeys []byte) error {
+	defer conn.Close()
+
+	exited := make(chan struct{})
+	var closeErr error
+	go func() {
+		defer close(exited)
+		for {
+			stream, data, err := readFrame(conn)
+			if err != nil {
+				return
+			}
+			switch stream {
+			case streamStdout:
+				os.Stdout.Write(data)
+			case streamStderr:
+				os.Stderr.Write(data)
+			case streamError:
+				closeErr = fmt.Errorf("attach: %s", data)
+				return
+			}
+		}
+	}()
+
+	if c.Tty {
+		stopWinsize := watchWinsize(func(ws *unix.Winsize) { writeFrame(conn, streamResize, encodeWinsize(ws)) })
+		defer stopWinsize()
+		if withStdin {
+			defer rawTerminal()()
+		}
+	}
+
+	detached := make(chan struct{})
+	if withStdin {
+		go func() {
+			if copyInput(conn, os.Stdin, detachKeys) {
+				close(detached)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	if sigProxy {
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+		defer signal.Stop(signals)
+	}
+
+	for {
+		select {
+		case <-exited:
+			return closeErr
+		case <-detached:
+			return nil
+		case sig := <-signals:
+			if err := c.reload(); err == nil && c.PID > 0 {
+				syscall.Kill(c.PID, sig.(syscall.Signal))
+			}
+		}
+	}
+}
+
+// copyInput 将输入转发到容器，返回是否因输入脱离按键序列而结束
+// 匹配到一半的按键暂缓发送，序列不完整时原样补发；输入结束时通知监控进程关闭容器标准输入
+func copyInput(w io.Writer, r io.Reader, detachKeys []byte) bool {
+	buf := make([]byte, 32*1024)
+	matched := 0
+	for {
+		n, err := r.Read(buf)
+		out := make([]byte, 0, n+matched)
+		for _, b := range buf[:n] {
+			if b == detachKeys[matched] {
+				matched++
+				if matched == len(detachKeys) {
+					if len(out) > 0 {
+						writeFrame(w, streamStdin, out)
+					}
+					return true
+				}
+				continue
+			}
+			out = append(out, detachKeys[:matched]...)
+			matched = 0
+			if b == detachKeys[0] {
+				matched = 1
+				continue
+			}
+			out = append(out, b)
+		}
+		if err != nil {
+			out = append(out, detachKeys[:matched]...)
+		}
+		if len(out) > 0 {
+			if writeFrame(w, streamStdin, out) != nil {
+				return false
+			}
+		}
+		if err != nil {
+			writeFrame(w, streamStdin, nil)
+			return false
+		}
+	}
+}
+
+// attach 连接到运行中的容器
+func (c *container) attach(withStdin, sigProxy bool, detachKeys []byte) error {
+	if c.Status == StatusPaused {
+		return errPaused()
+	}
+	if c.Status != StatusRunning && c.Status != StatusRestarting {
+		return fmt.Errorf("cannot attach to a stopped container, start it first")
+	}
+	conn, err := dialAttach(c.ID)
+	if err != nil {
+		return err
+	}
+	return c.attachStreams(conn, withStdin && c.Interactive, sigProxy, detachKeys)
+}
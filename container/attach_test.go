@@ -0,0 +1,280 @@
+package container
+
+import (
+	"bytes"
+	"io"
+	gonet "net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []byte
+		wantErr bool
+	}{
+		{in: "", want: []byte{0x10, 0x11}},
+		{in: "ctrl-p,ctrl-q", want: []byte{0x10, 0x11}},
+		{in: "CTRL-A,x", want: []byte{0x01, 'x'}},
+		{in: "ctrl-@,ctrl-[,ctrl-\\,ctrl-],ctrl-^,ctrl-_", want: []byte{0x00, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f}},
+		{in: "a,b,c", want: []byte{'a', 'b', 'c'}},
+		{in: "ctrl-", wantErr: true},
+		{in: "ctrl-1", wantErr: true},
+		{in: "ctrl-pq", wantErr: true},
+		{in: "ab", wantErr: true},
+		{in: "ctrl-p,", wantErr: true},
+		{in: ",", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDetachKeys(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDetachKeys(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDetachKeys(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("ParseDetachKeys(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// chunkReader 每次 Read 返回一个分块，模拟终端输入被拆分到多次读取中
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+// readStdinFrames 读取 copyInput 写出的全部 stdin 帧
+func readStdinFrames(t *testing.T, buf *bytes.Buffer) (data []byte, closed bool) {
+	t.Helper()
+	for buf.Len() > 0 {
+		stream, frame, err := readFrame(buf)
+		if err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		if stream != streamStdin {
+			t.Fatalf("stream = %d, want stdin", stream)
+		}
+		if len(frame) == 0 {
+			closed = true
+			continue
+		}
+		data = append(data, frame...)
+	}
+	return data, closed
+}
+
+func TestCopyInput(t *testing.T) {
+	keys := []byte{0x10, 0x11} // ctrl-p,ctrl-q
+	tests := []struct {
+		name         string
+		chunks       []string
+		wantData     string
+		wantDetached bool
+	}{
+		{name: "plain input", chunks: []string{"ls\n", "exit\n"}, wantData: "ls\nexit\n"},
+		{name: "detach", chunks: []string{"ls\n\x10\x11ignored"}, wantData: "ls\n", wantDetached: true},
+		{name: "detach across reads", chunks: []string{"ab\x10", "\x11cd"}, wantData: "ab", wantDetached: true},
+		{name: "partial match flushed", chunks: []string{"a\x10", "b"}, wantData: "a\x10b"},
+		{name: "partial match at eof", chunks: []string{"a\x10"}, wantData: "a\x10"},
+		{name: "repeated first key", chunks: []string{"\x10", "\x10\x11"}, wantData: "\x10", wantDetached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &chunkReader{}
+			for _, c := range tt.chunks {
+				r.chunks = append(r.chunks, []byte(c))
+			}
+			var buf bytes.Buffer
+			detached := copyInput(&buf, r, keys)
+			if detached != tt.wantDetached {
+				t.Errorf("detached = %v, want %v", detached, tt.wantDetached)
+			}
+			data, closed := readStdinFrames(t, &buf)
+			if string(data) != tt.wantData {
+				t.Errorf("data = %q, want %q", data, tt.wantData)
+			}
+			// 输入结束时通知关闭容器标准输入，脱离时不关闭
+			if closed == tt.wantDetached {
+				t.Errorf("stdin closed = %v, want %v", closed, !tt.wantDetached)
+			}
+		})
+	}
+}
+
+// newTestAttachServer 在临时目录中创建 attach 服务，返回服务和 socket 路径
+// 服务尚未开始接收连接
+func newTestAttachServer(t *testing.T) (*attachServer, string) {
+	t.Helper()
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "attach.sock")
+	listener, err := gonet.ListenUnix("unix", &gonet.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFile, err := os.Create(filepath.Join(dir, "container.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &attachServer{listener: listener, logFile: logFile, clients: make(map[*gonet.UnixConn]*attachClient)}
+	t.Cleanup(s.close)
+	return s, sock
+}
+
+// dialTestClient 连接 attach 服务并等待服务端登记该客户端
+func dialTestClient(t *testing.T, s *attachServer, sock string) *gonet.UnixConn {
+	t.Helper()
+	s.mu.Lock()
+	before := len(s.clients)
+	s.mu.Unlock()
+	conn, err := gonet.DialUnix("unix", nil, &gonet.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		n := len(s.clients)
+		s.mu.Unlock()
+		if n > before {
+			return conn
+		}
+	}
+	t.Fatal("client not registered")
+	return nil
+}
+
+// broadcastChunks 向客户端广播 n 个 32KiB 的输出块，超时未返回说明广播被客户端阻塞
+func broadcastChunks(t *testing.T, s *attachServer, n int) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		chunk := bytes.Repeat([]byte("x"), 32*1024)
+		for i := 0; i < n; i++ {
+			s.broadcast(streamStdout, chunk)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast blocked by a client that does not read")
+	}
+}
+
+func TestBroadcastSlowClient(t *testing.T) {
+	s, sock := newTestAttachServer(t)
+	go s.serve()
+	conn := dialTestClient(t, s, sock) // 广播期间不读取
+
+	// 不读取的客户端不能阻塞容器输出，队列满后被断开
+	broadcastChunks(t, s, attachQueueSize*4)
+	s.mu.Lock()
+	n := len(s.clients)
+	s.mu.Unlock()
+	if n != 0 {
+		t.Errorf("slow client still attached, clients = %d", n)
+	}
+
+	// 被断开的客户端最后收到断开原因，而不是普通的连接结束
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		stream, data, err := readFrame(conn)
+		if err != nil {
+			t.Fatalf("connection closed without a reason: %v", err)
+		}
+		if stream == streamError {
+			if string(data) != errSlowClient {
+				t.Errorf("reason = %q, want %q", data, errSlowClient)
+			}
+			break
+		}
+	}
+	if _, _, err := readFrame(conn); err != io.EOF {
+		t.Errorf("read after reason: %v, want EOF", err)
+	}
+}
+
+func TestBroadcastForegroundClient(t *testing.T) {
+	s, sock := newTestAttachServer(t)
+	accepted := make(chan error, 1)
+	go func() { accepted <- s.acceptFirst() }()
+	conn, err := gonet.DialUnix("unix", nil, &gonet.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := <-accepted; err != nil {
+		t.Fatal(err)
+	}
+
+	// 发起前台启动的客户端读取缓慢时既不阻塞容器输出，也不会被断开或丢失输出
+	const chunks = attachQueueSize * 4
+	broadcastChunks(t, s, chunks)
+	s.mu.Lock()
+	n := len(s.clients)
+	s.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("foreground client dropped, clients = %d", n)
+	}
+
+	go s.close()
+	total := 0
+	for {
+		stream, data, err := readFrame(conn)
+		if err != nil {
+			break
+		}
+		if stream != streamStdout {
+			t.Fatalf("stream = %d, want stdout", stream)
+		}
+		total += len(data)
+	}
+	if want := chunks * 32 * 1024; total != want {
+		t.Errorf("received %d bytes, want %d", total, want)
+	}
+}
+
+func TestCloseFlushesOutput(t *testing.T) {
+	s, sock := newTestAttachServer(t)
+	go s.serve()
+	conn := dialTestClient(t, s, sock)
+
+	s.broadcast(streamStdout, []byte("hello "))
+	s.broadcast(streamStderr, []byte("world"))
+	s.close()
+
+	// 容器退出前的输出全部送达后连接才关闭
+	var stdout, stderr []byte
+	for {
+		stream, data, err := readFrame(conn)
+		if err != nil {
+			break
+		}
+		switch stream {
+		case streamStdout:
+			stdout = append(stdout, data...)
+		case streamStderr:
+			stderr = append(stderr, data...)
+		}
+	}
+	if string(stdout) != "hello " || string(stderr) != "world" {
+		t.Errorf("stdout = %q, stderr = %q", stdout, stderr)
+	}
+}
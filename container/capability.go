@@ -0,0 +1,245 @@
+package container
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// capabilityAll --cap-add/--cap-drop 中表示全部能力
+const capabilityAll = "ALL"
+
+// capabilities 能力名称 -> 编号
+var capabilities = map[string]int{
+	"CAP_CHOWN":              unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":       unix.CAP_DAC_OVERRIDE,
+	"CAP_DAC_READ_SEARCH":    unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":             unix.CAP_FOWNER,
+	"CAP_FSETID":             unix.CAP_FSETID,
+	"CAP_KILL":               unix.CAP_KILL,
+	"CAP_SETGID":             unix.CAP_SETGID,
+	"CAP_SETUID":             unix.CAP_SETUID,
+	"CAP_SETPCAP":            unix.CAP_SETPCAP,
+	"CAP_LINUX_IMMUTABLE":    unix.CAP_LINUX_IMMUTABLE,
+	"CAP_NET_BIND_SERVICE":   unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_BROADCAST":      unix.CAP_NET_BROADCAST,
+	"CAP_NET_ADMIN":          unix.CAP_NET_ADMIN,
+	"CAP_NET_RAW":            unix.CAP_NET_RAW,
+	"CAP_IPC_LOCK":           unix.CAP_IPC_LOCK,
+	"CAP_IPC_OWNER":          unix.CAP_IPC_OWNER,
+	"CAP_SYS_MODULE":         unix.CAP_SYS_MODULE,
+	"CAP_SYS_RAWIO":          unix.CAP_SYS_RAWIO,
+	"CAP_SYS_CHROOT":         unix.CAP_SYS_CHROOT,
+	"CAP_SYS_PTRACE":         unix.CAP_SYS_PTRACE,
+	"CAP_SYS_PACCT":          unix.CAP_SYS_PACCT,
+	"CAP_SYS_ADMIN":          unix.CAP_SYS_ADMIN,
+	"CAP_SYS_BOOT":           unix.CAP_SYS_BOOT,
+	"CAP_SYS_NICE":           unix.CAP_SYS_NICE,
+	"CAP_SYS_RESOURCE":       unix.CAP_SYS_RESOURCE,
+	"CAP_SYS_TIME":           unix.CAP_SYS_TIME,
+	"CAP_SYS_TTY_CONFIG":     unix.CAP_SYS_TTY_CONFIG,
+	"CAP_MKNOD":              unix.CAP_MKNOD,
+	"CAP_LEASE":              unix.CAP_LEASE,
+	"CAP_AUDIT_WRITE":        unix.CAP_AUDIT_WRITE,
+	"CAP_AUDIT_CONTROL":      unix.CAP_AUDIT_CONTROL,
+	"CAP_SETFCAP":            unix.CAP_SETFCAP,
+	"CAP_MAC_OVERRIDE":       unix.CAP_MAC_OVERRIDE,
+	"CAP_MAC_ADMIN":          unix.CAP_MAC_ADMIN,
+	"CAP_SYSLOG":             unix.CAP_SYSLOG,
+	"CAP_WAKE_ALARM":         unix.CAP_WAKE_ALARM,
+	"CAP_BLOCK_SUSPEND":      unix.CAP_BLOCK_SUSPEND,
+	"CAP_AUDIT_READ":         unix.CAP_AUDIT_READ,
+	"CAP_PERFMON":            unix.CAP_PERFMON,
+	"CAP_BPF":                unix.CAP_BPF,
+	"CAP_CHECKPOINT_RESTORE": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// defaultCapabilities 未指定 --privileged 时容器进程保留的能力，足以运行常见的服务和包管理器，
+// 但不能加载内核模块、挂载文件系统、修改网络配置或跟踪其他进程
+var defaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_RAW",
+	"CAP_SYS_CHROOT",
+	"CAP_MKNOD",
+	"CAP_AUDIT_WRITE",
+	"CAP_SETFCAP",
+}
+
+// ParseCapabilities 校验 --cap-add/--cap-drop 参数并统一为 CAP_ 开头的大写名称，ALL 表示全部能力
+func ParseCapabilities(names []string) ([]string, error) {
+	var parsed []string
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name != capabilityAll && !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+		if _, ok := capabilities[name]; !ok && name != capabilityAll {
+			return nil, fmt.Errorf("unknown capability: %q", name)
+		}
+		if !slices.Contains(parsed, name) {
+			parsed = append(parsed, name)
+		}
+	}
+	return parsed, nil
+}
+
+// capabilitySet 能力集合，第 n 位表示编号为 n 的能力
+type capabilitySet uint64
+
+func allCapabilities() capabilitySet {
+	return 1<<(unix.CAP_LAST_CAP+1) - 1
+}
+
+func newCapabilitySet(names []string) capabilitySet {
+	var set capabilitySet
+	for _, name := range names {
+		set |= 1 << capabilities[name]
+	}
+	return set
+}
+
+// apply 在集合上增删能力：add 含 ALL 时从全部能力开始，drop 含 ALL 时从空集开始，再加入 add 并去掉 drop 中的能力
+func (s capabilitySet) apply(add, drop []string) capabilitySet {
+	if slices.Contains(add, capabilityAll) {
+		s = allCapabilities()
+	}
+	if slices.Contains(drop, capabilityAll) {
+		s = 0
+	}
+	for _, name := range add {
+		if name != capabilityAll {
+			s |= 1 << capabilities[name]
+		}
+	}
+	for _, name := range drop {
+		if name != capabilityAll {
+			s &^= 1 << capabilities[name]
+		}
+	}
+	return s
+}
+
+func (s capabilitySet) has(capability int) bool {
+	return s&(1<<capability) != 0
+}
+
+// names 集合中的能力名称，按名称排序
+func (s capabilitySet) names() []string {
+	var names []string
+	for name, capability := range capabilities {
+		if s.has(capability) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// capabilities 容器进程保留的能力
+func (c *container) capabilities() capabilitySet {
+	if c.Privileged {
+		return allCapabilities()
+	}
+	return newCapabilitySet(defaultCapabilities).apply(c.CapAdd, c.CapDrop)
+}
+
+// ambientCapabilities 以非 root 用户运行时 exec 后仍然有效的能力。内核在切换为非 root 用户和 exec 时清空能力，
+// 只有环境能力（ambient）可以保留；普通用户只获得 --cap-add 显式添加的能力，默认能力不授予普通用户，特权容器获得全部能力
+func (c *container) ambientCapabilities() capabilitySet {
+	if c.Privileged {
+		return allCapabilities()
+	}
+	return c.capabilities() & capabilitySet(0).apply(c.CapAdd, nil)
+}
+
+// list 集合中的能力编号，用于 SysProcAttr.AmbientCaps
+func (s capabilitySet) list() []uintptr {
+	var list []uintptr
+	for capability := 0; capability <= unix.CAP_LAST_CAP; capability++ {
+		if s.has(capability) {
+			list = append(list, uintptr(capability))
+		}
+	}
+	return list
+}
+
+// limitCapabilities 从当前线程的边界集和可继承集中去掉不在 set 中的能力，
+// 之后 exec 的程序即使以 root 运行也无法获得这些能力。
+// 边界集和可继承集属于线程，调用方必须锁定线程并在同一线程上 exec 或 fork；
+// 当前线程的有效能力不受影响，仍可继续切换用户等操作
+func limitCapabilities(set capabilitySet) error {
+	for capability := 0; capability <= unix.CAP_LAST_CAP; capability++ {
+		if set.has(capability) {
+			continue
+		}
+		// 旧内核不认识的能力返回 EINVAL，本来就不存在，可以忽略
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("drop capability %d from bounding set: %w", capability, err)
+		}
+	}
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("get capabilities: %w", err)
+	}
+	data[0].Inheritable &= uint32(set)
+	data[1].Inheritable &= uint32(set >> 32)
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("set capabilities: %w", err)
+	}
+	return nil
+}
+
+// restrictCapabilities 将当前线程的许可集、有效集和可继承集限制在 set 之内，
+// 用于 exec 之后仍继续运行的 init：边界集只约束 exec 后的程序，不影响当前线程已拥有的能力
+func restrictCapabilities(set capabilitySet) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("get capabilities: %w", err)
+	}
+	for i := range data {
+		mask := uint32(set >> (32 * i))
+		data[i].Permitted &= mask
+		data[i].Effective &= mask
+		data[i].Inheritable &= mask
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("set capabilities: %w", err)
+	}
+	return nil
+}
+
+// raiseAmbientCapabilities 将 set 中的能力加入当前线程的可继承集和环境能力集，之后 exec 的普通程序获得这些能力。
+// 环境能力必须同时在许可集中，切换为非 root 用户前需要设置 keepcaps 保留许可集
+func raiseAmbientCapabilities(set capabilitySet) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("get capabilities: %w", err)
+	}
+	data[0].Inheritable |= uint32(set)
+	data[1].Inheritable |= uint32(set >> 32)
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("set capabilities: %w", err)
+	}
+	for _, capability := range set.list() {
+		// 旧内核不认识的能力返回 EINVAL，本来就不存在，可以忽略
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, capability, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("raise ambient capability %d: %w", capability, err)
+		}
+	}
+	return nil
+}
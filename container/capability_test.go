@@ -0,0 +1,119 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"ducker/util"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestAmbientCapabilities(t *testing.T) {
+	netBind := capabilitySet(1 << unix.CAP_NET_BIND_SERVICE)
+	tests := []struct {
+		name string
+		opts RunOptions
+		want capabilitySet
+	}{
+		{name: "defaults are not granted", opts: RunOptions{User: "1000"}, want: 0},
+		{name: "cap-add", opts: RunOptions{User: "1000", CapAdd: []string{"CAP_NET_BIND_SERVICE"}}, want: netBind},
+		{name: "cap-add and cap-drop", opts: RunOptions{User: "1000", CapAdd: []string{"CAP_NET_BIND_SERVICE"}, CapDrop: []string{"CAP_NET_BIND_SERVICE"}}, want: 0},
+		{name: "cap-add ALL", opts: RunOptions{User: "1000", CapAdd: []string{capabilityAll}}, want: allCapabilities()},
+		{name: "privileged", opts: RunOptions{User: "1000", Privileged: true}, want: allCapabilities()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &container{RunOptions: tt.opts}
+			if got := c.ambientCapabilities(); got != tt.want {
+				t.Errorf("ambientCapabilities() = %v, want %v", got.names(), tt.want.names())
+			}
+		})
+	}
+}
+
+func TestCapabilityParseAndApply(t *testing.T) {
+	names, err := ParseCapabilities([]string{"net_admin", "CAP_SYS_ADMIN", "all", "NET_ADMIN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"CAP_NET_ADMIN", "CAP_SYS_ADMIN", capabilityAll}; !slices.Equal(names, want) {
+		t.Errorf("ParseCapabilities = %v, want %v", names, want)
+	}
+	if _, err := ParseCapabilities([]string{"CAP_FOO"}); err == nil {
+		t.Error("ParseCapabilities(CAP_FOO) succeeded, want error")
+	}
+
+	set := newCapabilitySet(defaultCapabilities).apply([]string{"CAP_NET_ADMIN"}, []string{"CAP_CHOWN"})
+	if !set.has(unix.CAP_NET_ADMIN) || set.has(unix.CAP_CHOWN) || !set.has(unix.CAP_KILL) {
+		t.Errorf("apply = %v", set.names())
+	}
+	// drop ALL 先清空，再加入 add 中的能力
+	if set := newCapabilitySet(defaultCapabilities).apply([]string{"CAP_KILL"}, []string{capabilityAll}); !slices.Equal(set.names(), []string{"CAP_KILL"}) {
+		t.Errorf("drop ALL, add KILL = %v", set.names())
+	}
+}
+
+// envSetCredentialHelper 设置时测试进程作为 TestSetCredentialKeepsAddedCapabilities 的子进程运行
+const envSetCredentialHelper = "DUCKER_TEST_SET_CREDENTIAL"
+
+// TestSetCredentialKeepsAddedCapabilities 对应 --user 1000 --cap-add NET_BIND_SERVICE：
+// 限制能力并切换为普通用户后 exec 的程序仍拥有显式添加的能力，且不拥有其他默认能力
+func TestSetCredentialKeepsAddedCapabilities(t *testing.T) {
+	if os.Getenv(envSetCredentialHelper) != "" {
+		runSetCredentialHelper()
+		return
+	}
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSetCredentialKeepsAddedCapabilities$")
+	cmd.Env = append(os.Environ(), envSetCredentialHelper+"=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("helper failed: %v\n%s", err, out)
+	}
+
+	want := fmt.Sprintf("%016x", uint64(1)<<unix.CAP_NET_BIND_SERVICE)
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), ":"); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	if fields["Uid"] == "" || !strings.HasPrefix(fields["Uid"], "1000") {
+		t.Errorf("Uid = %q, want 1000", fields["Uid"])
+	}
+	for _, key := range []string{"CapPrm", "CapEff", "CapAmb"} {
+		if fields[key] != want {
+			t.Errorf("%s = %s, want %s", key, fields[key], want)
+		}
+	}
+}
+
+// runSetCredentialHelper 按 execTask 的顺序限制能力、切换用户后 exec cat 输出自身的能力
+func runSetCredentialHelper() {
+	runtime.LockOSThread()
+	c := &container{RunOptions: RunOptions{User: "1000", CapAdd: []string{"CAP_NET_BIND_SERVICE"}}}
+	if err := limitCapabilities(c.capabilities()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	user := &util.User{UID: 1000, GID: 1000, Groups: []uint32{1000}}
+	if err := setCredential(user, c.ambientCapabilities()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	err := syscall.Exec("/bin/cat", []string{"cat", "/proc/self/status"}, nil)
+	fmt.Println(err)
+	os.Exit(1)
+}
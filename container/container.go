@@ -8,54 +8,123 @@ import (
 	"ducker/util"
 	"ducker/volume"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"runtime"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 type Status string
 
 const (
-	StatusRunning Status = "running"
-	StatusExited  Status = "exited"
-	EnvDuckerID          = "DUCKER_ID"
+	StatusCreated    Status = "created"
+	StatusRunning    Status = "running"
+	StatusPaused     Status = "paused"
+	StatusRestarting Status = "restarting"
+	StatusExited     Status = "exited"
+	StatusDead       Status = "dead"
+	EnvDuckerID             = "DUCKER_ID"
+
+	// exitCodeStartFailed 容器进程未能启动时记录的退出码
+	exitCodeStartFailed = 128
+
+	// 子进程中同步管道和错误管道的文件描述符
+	childSyncFd  = 3
+	childErrorFd = 4
 )
 
 // RunOptions 容器运行时配置（镜像默认配置 + 用户运行时参数）
 type RunOptions struct {
 	// 基本运行选项
-	Interactive bool `json:"interactive"`
-	AutoRemove  bool `json:"auto_remove"`
+	Interactive bool          `json:"interactive"`
+	Tty         bool          `json:"tty"`
+	AutoRemove  bool          `json:"auto_remove"`
+	Restart     RestartPolicy `json:"restart"`
 
 	// 网络和存储
-	Volume  map[string]string `json:"volumes"`
-	Ports   map[string]string `json:"ports"`
-	Network string            `json:"network"`
+	Volume         map[string]string `json:"volumes"`
+	Tmpfs          map[string]string `json:"tmpfs,omitempty"` // 容器内路径 -> 挂载选项，每次启动时重新创建
+	ReadonlyRootfs bool              `json:"readonly_rootfs"` // 根文件系统只读，只有卷、tmpfs 等挂载可写
+	Devices        []Device          `json:"devices,omitempty"`
+	Ports          map[string]string `json:"ports"`
+	Network        string            `json:"network"`
+
+	// 主机名和 DNS 配置，启动时据此生成容器的 hostname、hosts 和 resolv.conf
+	Hostname   string   `json:"hostname,omitempty"`
+	ExtraHosts []string `json:"extra_hosts,omitempty"` // name:ip
+	DNS        []string `json:"dns,omitempty"`
+	DNSSearch  []string `json:"dns_search,omitempty"`
+	DNSOptions []string `json:"dns_options,omitempty"`
+
+	// 命名空间共享方式：空为默认，host 与宿主机共用，container:ID 加入另一个容器的命名空间；
+	// 网络命名空间由 Network 指定（host、none、container:ID 或网络名称）
+	PidMode string `json:"pid_mode,omitempty"`
+	IpcMode string `json:"ipc_mode,omitempty"`
+	UTSMode string `json:"uts_mode,omitempty"`
+	// cgroup 命名空间：空或 private 时容器只能看到自身的 cgroup，host 与宿主机共用
+	CgroupnsMode string `json:"cgroupns_mode,omitempty"`
 
 	// 容器命令配置
 	WorkDir string   `json:"workdir"`
 	Env     []string `json:"env"`
 	Cmd     []string `json:"cmd"`
+	User    string   `json:"user"`
+
+	// 用户命名空间映射，为空时容器与宿主机共用用户命名空间
+	UsernsRemap *UsernsRemap `json:"userns_remap,omitempty"`
+
+	// 能力配置，在默认能力集上增删；Privileged 时保留全部能力
+	Privileged bool     `json:"privileged"`
+	CapAdd     []string `json:"cap_add,omitempty"`
+	CapDrop    []string `json:"cap_drop,omitempty"`
+
+	// --security-opt 原始参数及其解析结果
+	SecurityOpt []string        `json:"security_opt,omitempty"`
+	Security    SecurityOptions `json:"security"`
 
 	// 资源限制
-	CPUs   float64 `json:"cpus"`
-	Memory uint64  `json:"memory"`
+	limit.Resources
+
+	// 以内置 init 作为 PID 1 运行用户命令
+	Init bool `json:"init"`
+
+	// 停止配置
+	StopSignal  string `json:"stop_signal"`
+	StopTimeout *int   `json:"stop_timeout,omitempty"`
 }
 
 type container struct {
-	ID        string    `json:"cid"`
-	Name      string    `json:"name"`
-	ImageTag  string    `json:"image_name"`
-	CreatedAt time.Time `json:"created_at"`
-	PID       int       `json:"pid"`
-	Status    Status    `json:"status"`
+	ID         string    `json:"cid"`
+	Name       string    `json:"name"`
+	ImageTag   string    `json:"image_name"`
+	CreatedAt  time.Time `json:"created_at"`
+	PID        int       `json:"pid"`
+	MonitorPID int       `json:"monitor_pid"`
+	Status     Status    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	OOMKilled  bool      `json:"oom_killed"`
+	Error      string    `json:"error"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// 重启相关状态
+	RestartCount    int  `json:"restart_count"`
+	ManuallyStopped bool `json:"manually_stopped"`
+
+	// 本次启动以来在容器内执行的命令，容器重新启动时清空
+	Execs []*execSession `json:"execs,omitempty"`
 
 	RunOptions `json:"run_options"`
+
+	// 容器标准输入输出，仅在监控进程内有效
+	stdio *attachServer
 }
 
 func newContainer(name, imageTag string, opts *RunOptions) (*container, error) {
@@ -65,17 +134,17 @@ func newContainer(name, imageTag string, opts *RunOptions) (*container, error) {
 		ID:         id,
 		ImageTag:   imageTag,
 		CreatedAt:  time.Now(),
-		Status:     StatusExited,
+		Status:     StatusCreated,
 		RunOptions: *opts,
 	}
 
-	layers, err := image.GetLayers(c.ImageTag)
-	if err != nil {
+	// rootfs 在首次启动时挂载，这里只校验镜像是否存在
+	if _, err := image.GetLayers(c.ImageTag); err != nil {
 		return nil, fmt.Errorf("get image layers: %w", err)
 	}
 
-	if err := c.setupRootfs(layers); err != nil {
-		return nil, fmt.Errorf("setup rootfs: %w", err)
+	if err := util.EnsureDir(util.GetContainerDir(c.ID)); err != nil {
+		return nil, err
 	}
 
 	if err := c.saveConfig(); err != nil {
@@ -84,88 +153,185 @@ func newContainer(name, imageTag string, opts *RunOptions) (*container, error) {
 	return c, nil
 }
 
-func (c *container) start() error {
-	if c.Status == StatusRunning {
-		return fmt.Errorf("container already running")
+// start 由监控进程启动容器，attach 时将当前终端连接到容器直到其退出或脱离
+func (c *container) start(attach, interactive bool, detachKeys []byte) error {
+	if c.isActive() {
+		return fmt.Errorf("container already %s", c.Status)
+	}
+	if c.Status == StatusDead {
+		return fmt.Errorf("container is dead, remove it and create a new one")
+	}
+
+	// 新创建的容器首次启动时挂载 rootfs，主机重启后也需要重新挂载
+	if err := c.ensureRootfs(); err != nil {
+		return fmt.Errorf("setup rootfs: %w", err)
+	}
+
+	// 手动启动时恢复自动重启
+	c.ManuallyStopped = false
+	c.RestartCount = 0
+	if err := c.saveConfig(); err != nil {
+		return err
+	}
+
+	conn, err := c.startMonitor(attach)
+	if err != nil || conn == nil {
+		return err
+	}
+	return c.attachStreams(conn, interactive && c.Interactive, true, detachKeys)
+}
+
+// isActive 容器是否处于运行中、暂停或等待重启
+func (c *container) isActive() bool {
+	return c.Status == StatusRunning || c.Status == StatusPaused || c.Status == StatusRestarting
+}
+
+// launch 启动容器进程并配置资源，当前进程即为该容器的监控进程
+// 启动失败时记录错误信息
+func (c *container) launch() (*exec.Cmd, error) {
+	cmd, err := c.spawn()
+	if err != nil {
+		c.recordStartError(err)
+		return nil, err
 	}
+	return cmd, nil
+}
 
+func (c *container) spawn() (*exec.Cmd, error) {
 	// 1. 准备子进程
-	cmd, syncRead, syncWrite, err := c.prepareChildProcess()
+	cmd, pipes, err := c.prepareChildProcess()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// 2. 启动子进程
-	if err := cmd.Start(); err != nil {
-		syncRead.Close()
-		syncWrite.Close()
-		return fmt.Errorf("start process: %w", err)
+	// 2. 启动子进程，需要加入其他容器的命名空间时在独立的线程上加入后再创建
+	if err := runOnDisposableThread(func() error {
+		if err := c.joinNamespaces(); err != nil {
+			return err
+		}
+		return cmd.Start()
+	}); err != nil {
+		pipes.closeAll()
+		return nil, fmt.Errorf("start process: %w", err)
 	}
-	syncRead.Close() // 父进程关闭读端
+	pipes.closeChildEnds() // 父进程关闭子进程使用的一端
+	defer pipes.errRead.Close()
 	c.PID = cmd.Process.Pid
+	c.MonitorPID = os.Getpid()
 	c.Status = StatusRunning
+	c.StartedAt = time.Now()
+	c.OOMKilled = false
+	c.Error = ""
+	c.Execs = nil
+	os.RemoveAll(util.GetContainerExecDir(c.ID))
 
 	// 3. 配置容器资源（网络、cgroup）
 	if err := c.setupResources(); err != nil {
-		syncWrite.Close()
+		pipes.syncWrite.Close()
 		c.killAndReset()
-		return fmt.Errorf("setup resources: %w", err)
+		cmd.Wait()
+		return nil, fmt.Errorf("setup resources: %w", err)
 	}
 	c.saveConfig()
 
 	// 4. 通知子进程继续执行
-	syncWrite.Write([]byte("GO"))
-	syncWrite.Close()
+	pipes.syncWrite.Write([]byte("GO"))
+	pipes.syncWrite.Close()
 
-	// 5. 等待子进程退出
-	if c.Interactive {
-		c.waitAndCleanup(cmd)
+	// 5. 等待子进程 exec 用户命令，exec 成功时错误管道随之关闭
+	if msg, _ := io.ReadAll(pipes.errRead); len(msg) > 0 {
+		cmd.Wait()
+		c.cleanupNetwork()
+		return nil, errors.New(string(msg))
 	}
-	return nil
+	return cmd, nil
+}
+
+// recordStartError 记录启动失败的状态和错误信息
+func (c *container) recordStartError(err error) {
+	c.Status = StatusExited
+	c.PID = 0
+	c.MonitorPID = 0
+	c.ExitCode = exitCodeStartFailed
+	c.FinishedAt = time.Now()
+	c.Error = err.Error()
+	c.saveConfig()
 }
 
-// prepareChildProcess 准备子进程命令，返回 cmd、同步管道读端和写端
-func (c *container) prepareChildProcess() (*exec.Cmd, *os.File, *os.File, error) {
+// childPipes 父子进程间的管道：sync 由父进程通知子进程继续，error 由子进程回传 exec 前的错误
+type childPipes struct {
+	syncRead, syncWrite *os.File
+	errRead, errWrite   *os.File
+	stdio               *os.File // 容器标准输入管道的读端或伪终端从设备，均未使用时为 nil
+}
+
+func newChildPipes() (*childPipes, error) {
 	syncRead, syncWrite, err := os.Pipe()
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("create sync pipe: %w", err)
+		return nil, fmt.Errorf("create sync pipe: %w", err)
+	}
+	errRead, errWrite, err := os.Pipe()
+	if err != nil {
+		syncRead.Close()
+		syncWrite.Close()
+		return nil, fmt.Errorf("create error pipe: %w", err)
+	}
+	return &childPipes{syncRead: syncRead, syncWrite: syncWrite, errRead: errRead, errWrite: errWrite}, nil
+}
+
+func (p *childPipes) closeChildEnds() {
+	p.syncRead.Close()
+	p.errWrite.Close()
+	if p.stdio != nil {
+		p.stdio.Close()
+	}
+}
+
+func (p *childPipes) closeAll() {
+	p.closeChildEnds()
+	p.syncWrite.Close()
+	p.errRead.Close()
+}
+
+// prepareChildProcess 准备子进程命令及父子进程间的管道
+func (c *container) prepareChildProcess() (*exec.Cmd, *childPipes, error) {
+	pipes, err := newChildPipes()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	cmd := exec.Command("/proc/self/exe", "init")
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET,
+		Cloneflags: c.cloneFlags(),
+	}
+	if c.UsernsRemap != nil {
+		// 容器内的 root 映射为宿主机上的普通用户，允许容器内调用 setgroups 切换用户
+		// 宿主机 root 不在映射内，子进程需要在新的用户命名空间内切换为 root
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = c.UsernsRemap.uidMappings()
+		cmd.SysProcAttr.GidMappings = c.UsernsRemap.gidMappings()
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = true
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
 	}
 	cmd.Env = append(os.Environ(),
 		fmt.Sprintf("%s=%s", EnvDuckerID, c.ID),
-		"DUCKER_SYNC_FD=3",
+		fmt.Sprintf("DUCKER_SYNC_FD=%d", childSyncFd),
 	)
-	cmd.Env = append(cmd.Env, c.Env...)
-	cmd.ExtraFiles = []*os.File{syncRead}
+	cmd.ExtraFiles = []*os.File{pipes.syncRead, pipes.errWrite}
 
-	if err := c.setupIO(cmd); err != nil {
-		syncRead.Close()
-		syncWrite.Close()
-		return nil, nil, nil, err
+	if pipes.stdio, err = c.stdio.wire(cmd, c.Tty, c.Interactive); err != nil {
+		pipes.closeAll()
+		return nil, nil, err
 	}
-
-	return cmd, syncRead, syncWrite, nil
-}
-
-// setupIO 配置子进程的输入输出
-func (c *container) setupIO(cmd *exec.Cmd) error {
-	if c.Interactive {
-		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-		return nil
+	// 容器内的 root 需要能够通过 /dev/console 重新打开终端
+	if c.Tty && c.UsernsRemap != nil {
+		if err := pipes.stdio.Chown(int(c.UsernsRemap.HostUID), int(c.UsernsRemap.HostGID)); err != nil {
+			pipes.closeAll()
+			return nil, nil, fmt.Errorf("chown tty: %w", err)
+		}
 	}
 
-	logPath := util.GetContainerLogPath(c.ID)
-	os.MkdirAll(filepath.Dir(logPath), 0755)
-	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return fmt.Errorf("create log file: %w", err)
-	}
-	cmd.Stdout, cmd.Stderr = logFile, logFile
-	return nil
+	return cmd, pipes, nil
 }
 
 // killAndReset 终止进程并重置状态
@@ -173,25 +339,25 @@ func (c *container) killAndReset() {
 	syscall.Kill(c.PID, syscall.SIGKILL)
 	c.Status = StatusExited
 	c.PID = 0
+	c.MonitorPID = 0
 }
 
-// waitAndCleanup 等待进程退出并清理资源
-func (c *container) waitAndCleanup(cmd *exec.Cmd) {
-	cmd.Wait()
+// recordExit 记录进程退出状态并清理网络资源
+func (c *container) recordExit(exitCode int, oomKilled bool) {
+	c.ExitCode = exitCode
+	c.OOMKilled = oomKilled
+	c.FinishedAt = time.Now()
 	c.Status = StatusExited
 	c.PID = 0
+	c.MonitorPID = 0
 	c.cleanupNetwork()
-	c.saveConfig()
-	if c.AutoRemove {
-		c.remove()
-	}
 }
 
 // cleanupNetwork 清理网络资源（端口映射 + 断开连接）
 func (c *container) cleanupNetwork() {
-	network := c.RunOptions.Network
-	if network == "" {
-		network = net.DefaultNetworkName
+	network, ok := c.bridgeNetwork()
+	if !ok {
+		return
 	}
 	if len(c.RunOptions.Ports) > 0 {
 		net.CleanPortMappings(network, c.ID, c.RunOptions.Ports)
@@ -199,33 +365,60 @@ func (c *container) cleanupNetwork() {
 	net.Disconnect(network, c.ID)
 }
 
+// stop 发送停止信号，超时后强制杀死容器进程，timeoutSec 小于 0 时使用容器配置的超时时间
 func (c *container) stop(timeoutSec int) error {
-	if c.Status != StatusRunning {
-		return fmt.Errorf("container not running")
+	if timeoutSec < 0 {
+		timeoutSec = c.stopTimeout()
 	}
 
-	c.cleanupNetwork()
+	// 标记为手动停止，阻止监控进程自动重启
+	if err := c.withLock(func() error {
+		if c.Status == StatusPaused {
+			return errPaused()
+		}
+		if !c.isActive() {
+			return fmt.Errorf("container not running")
+		}
+		c.ManuallyStopped = true
+		return c.saveConfig()
+	}); err != nil {
+		return err
+	}
 
-	if c.PID > 0 && syscall.Kill(c.PID, 0) == nil {
-		syscall.Kill(c.PID, syscall.SIGTERM)
-		if !c.waitProcessExit(timeoutSec) {
+	if c.Status == StatusRestarting {
+		// 唤醒处于退避等待中的监控进程
+		syscall.Kill(c.MonitorPID, syscall.SIGUSR1)
+	} else if c.PID > 0 && syscall.Kill(c.PID, 0) == nil {
+		syscall.Kill(c.PID, c.stopSignal())
+		if !waitProcessExit(c.PID, timeoutSec) {
 			syscall.Kill(c.PID, syscall.SIGKILL)
 		}
 	}
 
+	// 监控进程存活时由其记录退出状态并清理资源
+	if c.MonitorPID > 0 && syscall.Kill(c.MonitorPID, 0) == nil && waitProcessExit(c.MonitorPID, monitorExitTimeout) {
+		if c.removed() {
+			return nil
+		}
+		return c.reload()
+	}
+
+	c.cleanupNetwork()
 	c.Status = StatusExited
+	c.FinishedAt = time.Now()
 	c.PID = 0
+	c.MonitorPID = 0
 	return c.saveConfig()
 }
 
-// waitProcessExit 等待进程退出，返回是否在超时前退出
-func (c *container) waitProcessExit(timeoutSec int) bool {
+// waitProcessExit 等待进程退出，返回是否在超时前退出，超时为 0 时只检查一次
+func waitProcessExit(pid, timeoutSec int) bool {
 	if timeoutSec <= 0 {
-		return true
+		return syscall.Kill(pid, 0) != nil
 	}
 	deadline := time.Now().Add(time.Duration(timeoutSec) * time.Second)
 	for time.Now().Before(deadline) {
-		if syscall.Kill(c.PID, 0) != nil {
+		if syscall.Kill(pid, 0) != nil {
 			return true
 		}
 		time.Sleep(100 * time.Millisecond)
@@ -233,31 +426,6 @@ func (c *container) waitProcessExit(timeoutSec int) bool {
 	return false
 }
 
-func (c *container) exec(interactive bool, envVars, cmdArgs []string, workDir string) error {
-	if c.Status != StatusRunning {
-		return fmt.Errorf("container not running")
-	}
-	if len(cmdArgs) == 0 {
-		return fmt.Errorf("no command specified")
-	}
-
-	mergedDir := util.GetContainerMergedDir(c.ID)
-	args := []string{"-t", fmt.Sprintf("%d", c.PID), "-m", "-p", "-u", "-i", "-n", "--root=" + mergedDir}
-	if workDir != "" {
-		args = append(args, "--wd="+workDir)
-	}
-	args = append(args, "--")
-	args = append(args, cmdArgs...)
-
-	task := exec.Command("nsenter", args...)
-	task.Env = append(os.Environ(), envVars...)
-	task.Stdout, task.Stderr = os.Stdout, os.Stderr
-	if interactive {
-		task.Stdin = os.Stdin
-	}
-	return task.Run()
-}
-
 func (c *container) logs(follow bool, tailLines int) error {
 	logPath := util.GetContainerLogPath(c.ID)
 	logFile, err := os.Open(logPath)
@@ -306,6 +474,9 @@ func (c *container) copy(srcPath, destPath string, srcInContainer bool) error {
 	if c.Status == StatusRunning {
 		return fmt.Errorf("cannot copy from running container")
 	}
+	if err := c.ensureRootfs(); err != nil {
+		return fmt.Errorf("setup rootfs: %w", err)
+	}
 	if srcInContainer {
 		srcPath = filepath.Join(util.GetContainerMergedDir(c.ID), srcPath)
 	} else {
@@ -314,23 +485,37 @@ func (c *container) copy(srcPath, destPath string, srcInContainer bool) error {
 	if err := util.EnsureDir(filepath.Dir(destPath)); err != nil {
 		return fmt.Errorf("create parent directory: %w", err)
 	}
+	// 复制到已存在的目录时放在该目录下
+	copied := destPath
+	if info, err := os.Stat(destPath); err == nil && info.IsDir() {
+		copied = filepath.Join(destPath, filepath.Base(srcPath))
+	}
 	if err := util.CopyDir(srcPath, destPath); err != nil {
 		return fmt.Errorf("copy: %w", err)
 	}
+	if !srcInContainer && c.UsernsRemap != nil {
+		if err := c.UsernsRemap.shiftToHost(copied); err != nil {
+			return fmt.Errorf("shift owner: %w", err)
+		}
+	}
 	return nil
 }
 
 func (c *container) remove() error {
-	if c.Status == StatusRunning {
+	if c.isActive() {
 		return fmt.Errorf("cannot remove running container")
 	}
 
 	containerDir := util.GetContainerDir(c.ID)
 	mergedDir := util.GetContainerMergedDir(c.ID)
 
-	if err := syscall.Unmount(mergedDir, syscall.MNT_DETACH); err != nil {
+	// 从未启动过或 dead 容器的 rootfs 可能没有挂载
+	if err := syscall.Unmount(mergedDir, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL && err != syscall.ENOENT {
 		return fmt.Errorf("unmount merged dir: %w", err)
 	}
+	if err := c.unmountRemappedLayers(); err != nil {
+		return err
+	}
 
 	if err := os.RemoveAll(containerDir); err != nil {
 		return fmt.Errorf("remove container dir: %w", err)
@@ -345,13 +530,45 @@ func (c *container) commit(newImageTag string) error {
 	if c.Status == StatusRunning {
 		return fmt.Errorf("cannot commit running container")
 	}
-	return image.Create(c.ImageTag, newImageTag, util.GetContainerUpperDir(c.ID), &image.RunOptions{
-		Env:     c.Env,
-		Cmd:     c.Cmd,
-		WorkDir: c.WorkDir,
+	layerDir := util.GetContainerUpperDir(c.ID)
+	if c.UsernsRemap != nil {
+		// upper 目录中的文件属于映射后的宿主机 ID，提交的镜像层需要恢复为容器内的 ID
+		tmpDir, err := os.MkdirTemp("", "ducker-commit-")
+		if err != nil {
+			return fmt.Errorf("create tmp dir: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		layerDir = filepath.Join(tmpDir, "upper")
+		if err := util.CopyDir(util.GetContainerUpperDir(c.ID), layerDir); err != nil {
+			return err
+		}
+		if err := c.UsernsRemap.shiftToContainer(layerDir); err != nil {
+			return fmt.Errorf("shift owner: %w", err)
+		}
+	}
+	return image.Create(c.ImageTag, newImageTag, layerDir, &image.RunOptions{
+		Env:        c.Env,
+		Cmd:        c.Cmd,
+		WorkDir:    c.WorkDir,
+		User:       c.User,
+		StopSignal: c.StopSignal,
 	})
 }
 
+// ensureRootfs rootfs 未挂载时按镜像层重新挂载 overlay
+func (c *container) ensureRootfs() error {
+	mounted, err := util.IsMountPoint(util.GetContainerMergedDir(c.ID))
+	if err != nil || mounted {
+		return err
+	}
+
+	layers, err := image.GetLayers(c.ImageTag)
+	if err != nil {
+		return fmt.Errorf("get image layers: %w", err)
+	}
+	return c.setupRootfs(layers)
+}
+
 func (c *container) setupRootfs(lowerLayerPaths []string) error {
 	upperDir := util.GetContainerUpperDir(c.ID)
 	workDir := util.GetContainerWorkDir(c.ID)
@@ -363,9 +580,17 @@ func (c *container) setupRootfs(lowerLayerPaths []string) error {
 		}
 	}
 
+	if c.UsernsRemap != nil {
+		var err error
+		if lowerLayerPaths, err = c.remapLayers(lowerLayerPaths); err != nil {
+			return fmt.Errorf("remap layers: %w", err)
+		}
+	}
+
 	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s",
-		strings.Join(lowerLayerPaths, ":"), upperDir, workDir)
+		util.OverlayLowerDir(lowerLayerPaths), upperDir, workDir)
 	if err := syscall.Mount("overlay", mergedDir, "overlay", 0, options); err != nil {
+		c.unmountRemappedLayers()
 		return fmt.Errorf("mount overlay: %w", err)
 	}
 	return nil
@@ -373,29 +598,49 @@ func (c *container) setupRootfs(lowerLayerPaths []string) error {
 
 func (c *container) setupResources() error {
 	// 1. 设置资源限制
-	if err := limit.Apply(c.ID, c.PID, c.RunOptions.CPUs, c.RunOptions.Memory); err != nil {
+	if err := limit.Apply(c.ID, c.PID, &c.Resources); err != nil {
 		return fmt.Errorf("set resource limit: %w", err)
 	}
+	rules, err := c.deviceRules()
+	if err != nil {
+		return err
+	}
+	if err := limit.SetDevices(c.ID, rules); err != nil {
+		return fmt.Errorf("set device access: %w", err)
+	}
 
-	// 2. 挂载卷
-	mergedDir := util.GetContainerMergedDir(c.ID)
-	for hostPath, containerPath := range c.RunOptions.Volume {
-		if err := volume.Mount(hostPath, containerPath, mergedDir); err != nil {
-			return fmt.Errorf("mount volume: %w", err)
+	// 2. 创建命名卷，卷由子进程在切换根目录前挂载
+	for source := range c.RunOptions.Volume {
+		if err := volume.Ensure(source); err != nil {
+			return err
 		}
 	}
 
-	// 3. 连接网络
-	networkName := c.RunOptions.Network
-	if networkName == "" {
-		networkName = net.DefaultNetworkName
-		c.RunOptions.Network = networkName
+	// 3. 连接网络并设置端口映射
+	if err := c.connectNetwork(); err != nil {
+		return err
+	}
+
+	// 4. 生成 hostname、hosts 和 resolv.conf，由子进程挂载
+	return c.writeNetworkFiles()
+}
+
+// connectNetwork 将容器连接到网络并设置端口映射，与宿主机或其他容器共用网络命名空间时无需配置
+func (c *container) connectNetwork() error {
+	if c.Network == NetworkNone {
+		if err := net.SetupLoopback(c.PID); err != nil {
+			return fmt.Errorf("setup loopback: %w", err)
+		}
+	}
+	networkName, ok := c.bridgeNetwork()
+	if !ok {
+		return nil
 	}
+	c.RunOptions.Network = networkName
 	if err := net.Connect(networkName, c.ID, c.PID); err != nil {
 		return fmt.Errorf("connect network: %w", err)
 	}
 
-	// 4. 设置端口映射
 	if len(c.RunOptions.Ports) > 0 {
 		if err := net.SetupPortMappings(networkName, c.ID, c.RunOptions.Ports); err != nil {
 			return fmt.Errorf("setup port mapping: %w", err)
@@ -404,6 +649,80 @@ func (c *container) setupResources() error {
 	return nil
 }
 
+// bridgeNetwork 容器连接的网络名称，未指定时为默认网络；不连接网络时 ok 为 false
+func (c *container) bridgeNetwork() (name string, ok bool) {
+	switch {
+	case c.Network == "":
+		return net.DefaultNetworkName, true
+	case c.Network == NetworkNone || c.namespaceMode("net") != NamespacePrivate:
+		return "", false
+	}
+	return c.Network, true
+}
+
+// checkAlive 监控进程和容器进程均已不存在但状态仍为活动时，退出状态已无法获知，将容器标记为 dead
+func (c *container) checkAlive() {
+	if !c.lost() {
+		return
+	}
+	c.withLock(func() error {
+		if !c.lost() {
+			return nil
+		}
+		c.cleanupNetwork()
+		c.Status = StatusDead
+		c.PID = 0
+		c.MonitorPID = 0
+		c.Error = "monitor process exited unexpectedly"
+		return c.saveConfig()
+	})
+}
+
+// lost 容器状态为活动，但没有任何进程负责它
+func (c *container) lost() bool {
+	if !c.isActive() || c.MonitorPID <= 0 || syscall.Kill(c.MonitorPID, 0) == nil {
+		return false
+	}
+	return c.PID <= 0 || syscall.Kill(c.PID, 0) != nil
+}
+
+// withLock 持有容器目录的文件锁，重新加载最新配置后执行 fn
+// 用于监控进程与 stop 等命令之间对容器状态的互斥修改
+func (c *container) withLock(fn func() error) error {
+	dir, err := os.Open(util.GetContainerDir(c.ID))
+	if err != nil {
+		return fmt.Errorf("open container dir: %w", err)
+	}
+	defer dir.Close()
+
+	if err := syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock container: %w", err)
+	}
+	defer syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+
+	if err := c.reload(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// removed 容器目录是否已被删除，使用 --rm 的容器在退出后由监控进程删除
+func (c *container) removed() bool {
+	_, err := os.Stat(util.GetContainerDir(c.ID))
+	return os.IsNotExist(err)
+}
+
+// reload 从磁盘重新加载配置，获取其他进程写入的最新状态
+func (c *container) reload() error {
+	latest, err := util.FindBy[container](util.TypeContainer, c.ID)
+	if err != nil {
+		return fmt.Errorf("reload config: %w", err)
+	}
+	latest.stdio = c.stdio
+	*c = *latest
+	return nil
+}
+
 func (c *container) saveConfig() error {
 	configPath := util.GetContainerConfigPath(c.ID)
 	data, err := json.MarshalIndent(c, "", "  ")
@@ -419,22 +738,46 @@ func (c *container) saveConfig() error {
 
 // ========== 子进程 相关方法 ==========
 
-func (c *container) runChildProc() error {
-	syncFd := os.NewFile(3, "sync")
+func (c *container) runChildProc(errPipe *os.File) error {
+	syncFd := os.NewFile(childSyncFd, "sync")
 	if syncFd != nil {
 		buf := make([]byte, 2)
 		syncFd.Read(buf)
 		syncFd.Close()
 	}
 
+	// 父进程已将当前进程加入容器的 cgroup
+	if err := c.unshareCgroupNamespace(); err != nil {
+		return err
+	}
+
 	mergedDir := util.GetContainerMergedDir(c.ID)
 
+	// 之后的挂载不传播到宿主机
+	if err := syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("make root private: %w", err)
+	}
+
+	if err := c.mountKernelFS(mergedDir); err != nil {
+		return err
+	}
+	if err := c.mountNetworkFiles(mergedDir); err != nil {
+		return err
+	}
+	if err := c.mountVolumes(mergedDir); err != nil {
+		return err
+	}
+
 	if err := c.pivotRoot(mergedDir); err != nil {
 		return fmt.Errorf("pivot root: %w", err)
 	}
-
-	if err := syscall.Mount("proc", "/proc", "proc", 0, ""); err != nil {
-		return fmt.Errorf("mount proc: %w", err)
+	if err := c.maskPaths(); err != nil {
+		return err
+	}
+	if c.Tty {
+		if err := reopenConsole(); err != nil {
+			return err
+		}
 	}
 
 	if c.WorkDir != "" {
@@ -445,15 +788,20 @@ func (c *container) runChildProc() error {
 			return fmt.Errorf("chdir to workdir: %w", err)
 		}
 	}
+	// 只读挂载不影响根目录下的卷、tmpfs 和内核文件系统
+	if c.ReadonlyRootfs {
+		if err := syscall.Mount("", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("remount rootfs read-only: %w", err)
+		}
+	}
 
+	if c.Init {
+		return c.runInit(errPipe)
+	}
 	return c.execTask()
 }
 
 func (c *container) pivotRoot(newRoot string) error {
-	if err := syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
-		return fmt.Errorf("make root private: %w", err)
-	}
-
 	if err := syscall.Mount(newRoot, newRoot, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
 		return fmt.Errorf("bind mount: %w", err)
 	}
@@ -480,17 +828,75 @@ func (c *container) pivotRoot(newRoot string) error {
 }
 
 func (c *container) execTask() error {
+	user, err := c.user()
+	if err != nil {
+		return err
+	}
+	env := c.environ(c.Tty, user.Home)
+	cmdPath := c.taskPath(env)
+
+	// 能力限制和 seccomp 过滤器只作用于当前线程，需要在同一线程上切换用户并 exec
+	runtime.LockOSThread()
+	if err := c.confine(c.capabilities(), false); err != nil {
+		return err
+	}
+	if c.User != "" {
+		if err := setCredential(user, c.ambientCapabilities()); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Exec(cmdPath, c.Cmd, env); err != nil {
+		return fmt.Errorf("exec %s: %w", cmdPath, err)
+	}
+	return nil
+}
+
+// taskPath 按 env 中的 PATH 解析用户命令的可执行文件路径，未指定命令时使用 /bin/sh
+func (c *container) taskPath(env []string) string {
 	if len(c.Cmd) == 0 {
 		c.Cmd = []string{"/bin/sh"}
 	}
 
-	cmdPath, err := exec.LookPath(c.Cmd[0])
+	cmdPath, err := lookPath(c.Cmd[0], env)
 	if err != nil {
 		cmdPath = c.Cmd[0]
 	}
+	return cmdPath
+}
 
-	if err := syscall.Exec(cmdPath, c.Cmd, os.Environ()); err != nil {
-		return fmt.Errorf("exec %s: %w", cmdPath, err)
+// user 按容器内的 /etc/passwd 解析运行用户，未指定时为 root
+// 需要在切换到容器根目录后调用
+func (c *container) user() (*util.User, error) {
+	if c.User == "" {
+		return &util.User{Groups: []uint32{0}, Home: defaultHome}, nil
+	}
+	return util.ResolveUser("/", c.User)
+}
+
+// setCredential 将当前进程切换为指定用户，必须先设置组再放弃 root 身份。
+// 切换为非 root 用户时内核清空能力，先通过 keepcaps 保留许可集，切换后将 ambient 设为环境能力，使其在 exec 后仍然有效
+func setCredential(user *util.User, ambient capabilitySet) error {
+	keepCaps := user.UID != 0 && ambient != 0
+	if keepCaps {
+		if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set keepcaps: %w", err)
+		}
+	}
+	groups := make([]int, len(user.Groups))
+	for i, gid := range user.Groups {
+		groups[i] = int(gid)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(int(user.GID)); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(int(user.UID)); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	if keepCaps {
+		return raiseAmbientCapabilities(ambient)
 	}
 	return nil
 }
@@ -0,0 +1,123 @@
+package container
+
+import (
+	"ducker/limit"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultDevicePermissions --device 未指定权限时容器对设备的访问权限
+const defaultDevicePermissions = "rwm"
+
+// Device --device 指定的设备，启动时在容器的 /dev 中创建设备节点并在 devices cgroup 中放行
+type Device struct {
+	PathOnHost        string `json:"path_on_host"`
+	PathInContainer   string `json:"path_in_container"`
+	CgroupPermissions string `json:"cgroup_permissions"` // r 读、w 写、m 创建设备节点的组合
+}
+
+// ParseDevices 解析 --device 参数 host[:container][:permissions]，容器内路径默认与宿主机相同，权限默认为 rwm
+func ParseDevices(specs []string) ([]Device, error) {
+	devices := make([]Device, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		device := Device{PathOnHost: parts[0], PathInContainer: parts[0], CgroupPermissions: defaultDevicePermissions}
+		switch {
+		case len(parts) == 2 && validDevicePermissions(parts[1]):
+			device.CgroupPermissions = parts[1]
+		case len(parts) == 2:
+			device.PathInContainer = parts[1]
+		case len(parts) == 3:
+			device.PathInContainer, device.CgroupPermissions = parts[1], parts[2]
+		case len(parts) > 3:
+			return nil, fmt.Errorf("invalid device %q", spec)
+		}
+
+		if !validDevicePermissions(device.CgroupPermissions) {
+			return nil, fmt.Errorf("invalid device permissions %q", device.CgroupPermissions)
+		}
+		if _, err := device.rule(); err != nil {
+			return nil, err
+		}
+		// 设备节点创建在容器独立的 /dev 中
+		device.PathInContainer = filepath.Clean(device.PathInContainer)
+		if !strings.HasPrefix(device.PathInContainer, "/dev/") {
+			return nil, fmt.Errorf("invalid device path %q: must be under /dev", device.PathInContainer)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// validDevicePermissions 权限由 r、w、m 组成
+func validDevicePermissions(permissions string) bool {
+	return permissions != "" && strings.Trim(permissions, "rwm") == ""
+}
+
+// stat 读取宿主机上设备的类型、权限和设备号
+func (d *Device) stat() (*unix.Stat_t, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(d.PathOnHost, &st); err != nil {
+		return nil, fmt.Errorf("stat device %s: %w", d.PathOnHost, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFCHR && st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return nil, fmt.Errorf("%s is not a device", d.PathOnHost)
+	}
+	return &st, nil
+}
+
+// rule 设备在 devices cgroup 中的允许规则，设备号在每次启动时从宿主机读取
+func (d *Device) rule() (limit.DeviceRule, error) {
+	st, err := d.stat()
+	if err != nil {
+		return limit.DeviceRule{}, err
+	}
+	rule := limit.DeviceRule{
+		Type:   'c',
+		Major:  int64(unix.Major(st.Rdev)),
+		Minor:  int64(unix.Minor(st.Rdev)),
+		Access: d.CgroupPermissions,
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+		rule.Type = 'b'
+	}
+	return rule, nil
+}
+
+// deviceRules 容器可以访问的设备：特权容器可以访问全部设备，其余容器只能访问默认设备和 --device 指定的设备
+func (c *container) deviceRules() ([]limit.DeviceRule, error) {
+	if c.Privileged {
+		return limit.AllowAllDevices, nil
+	}
+	rules := append([]limit.DeviceRule{}, limit.DefaultDeviceRules...)
+	for _, device := range c.Devices {
+		rule, err := device.rule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// createDevices 在 rootfs 的 /dev 中创建 --device 指定的设备节点，与宿主机上的设备类型、权限和设备号相同
+func (c *container) createDevices(rootfs string) error {
+	for _, device := range c.Devices {
+		st, err := device.stat()
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(rootfs, device.PathInContainer)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("create %s: %w", filepath.Dir(device.PathInContainer), err)
+		}
+		if err := createDevice(path, device.PathOnHost, st.Mode, st.Rdev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
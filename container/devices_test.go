@@ -0,0 +1,96 @@
+package container
+
+import (
+	"ducker/limit"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseDevices(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Device
+		wantErr bool
+	}{
+		{spec: "/dev/null", want: Device{PathOnHost: "/dev/null", PathInContainer: "/dev/null", CgroupPermissions: "rwm"}},
+		{spec: "/dev/null:/dev/mynull", want: Device{PathOnHost: "/dev/null", PathInContainer: "/dev/mynull", CgroupPermissions: "rwm"}},
+		{spec: "/dev/null:r", want: Device{PathOnHost: "/dev/null", PathInContainer: "/dev/null", CgroupPermissions: "r"}},
+		{spec: "/dev/null:/dev/sub/null:rw", want: Device{PathOnHost: "/dev/null", PathInContainer: "/dev/sub/null", CgroupPermissions: "rw"}},
+		{spec: "/dev/null:/dev//x/../mynull:m", want: Device{PathOnHost: "/dev/null", PathInContainer: "/dev/mynull", CgroupPermissions: "m"}},
+		// 第二段不是权限时作为容器内路径
+		{spec: "/dev/null:rx", wantErr: true},
+		{spec: "/dev/null:/dev/mynull:rx", wantErr: true},
+		{spec: "/dev/null:/dev/mynull:", wantErr: true},
+		{spec: "/dev/null:/dev/mynull:rw:m", wantErr: true},
+		{spec: "/dev/null:/tmp/null", wantErr: true},
+		{spec: "/dev/null:/dev", wantErr: true},
+		{spec: "/dev/null:/dev/../etc/null", wantErr: true},
+		{spec: "/dev/does-not-exist", wantErr: true},
+		{spec: "/proc/version:/dev/notdevice", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDevices([]string{tt.spec})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDevices(%q) = %+v, want error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDevices(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("ParseDevices(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestValidDevicePermissions(t *testing.T) {
+	for _, permissions := range []string{"r", "w", "m", "rw", "rwm", "mwr", "rr"} {
+		if !validDevicePermissions(permissions) {
+			t.Errorf("validDevicePermissions(%q) = false, want true", permissions)
+		}
+	}
+	for _, permissions := range []string{"", "x", "rwx", "RW", "r w", "/dev/null"} {
+		if validDevicePermissions(permissions) {
+			t.Errorf("validDevicePermissions(%q) = true, want false", permissions)
+		}
+	}
+}
+
+func TestDeviceRules(t *testing.T) {
+	devices, err := ParseDevices([]string{"/dev/null:/dev/mynull:r", "/dev/zero"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &container{RunOptions: RunOptions{Devices: devices}}
+	rules, err := c.deviceRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(slices.Clone(limit.DefaultDeviceRules),
+		limit.DeviceRule{Type: 'c', Major: 1, Minor: 3, Access: "r"},
+		limit.DeviceRule{Type: 'c', Major: 1, Minor: 5, Access: "rwm"},
+	)
+	if !slices.Equal(rules, want) {
+		t.Errorf("deviceRules() = %v, want %v", rules, want)
+	}
+
+	c.Privileged = true
+	if rules, _ := c.deviceRules(); !slices.Equal(rules, limit.AllowAllDevices) {
+		t.Errorf("privileged deviceRules() = %v, want %v", rules, limit.AllowAllDevices)
+	}
+
+	// 启动时重新读取设备号，宿主机上的设备已不存在时报错
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c = &container{RunOptions: RunOptions{Devices: []Device{{PathOnHost: path, PathInContainer: "/dev/file", CgroupPermissions: "rwm"}}}}
+	if _, err := c.deviceRules(); err == nil {
+		t.Error("deviceRules with a regular file succeeded, want error")
+	}
+}
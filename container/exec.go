@@ -0,0 +1,484 @@
+package container
+
+import (
+	"ducker/limit"
+	"ducker/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// envDuckerExec 传递给 exec 辅助进程的进程配置（JSON 编码的 execProcess）
+	envDuckerExec = "DUCKER_EXEC"
+	// execReady exec 辅助进程启动命令成功后写入就绪管道的消息
+	execReady = "OK"
+	// execReadyFd exec 辅助进程中就绪管道的文件描述符
+	execReadyFd = 3
+)
+
+// ExecOptions 在运行中的容器内执行命令的参数
+type ExecOptions struct {
+	Interactive bool
+	Tty         bool
+	Detach      bool
+	Privileged  bool
+	CapAdd      []string
+	CapDrop     []string
+	User        string
+	Env         []string
+	WorkDir     string
+	Cmd         []string
+}
+
+// execProcess 传递给 exec 辅助进程的命令配置，Env 为命令行指定的环境变量
+type execProcess struct {
+	ID         string   `json:"id"`
+	Args       []string `json:"args"`
+	Env        []string `json:"env"`
+	WorkDir    string   `json:"workdir"`
+	User       string   `json:"user"`
+	Tty        bool     `json:"tty"`
+	Detach     bool     `json:"detach"`
+	Privileged bool     `json:"privileged"`
+	CapAdd     []string `json:"cap_add,omitempty"`
+	CapDrop    []string `json:"cap_drop,omitempty"`
+}
+
+// execSession 记录在容器状态中的 exec 会话，由 exec 辅助进程在命令启动和退出时更新
+type execSession struct {
+	ID         string    `json:"id"`
+	Cmd        []string  `json:"cmd"`
+	User       string    `json:"user,omitempty"`
+	Tty        bool      `json:"tty"`
+	Detach     bool      `json:"detach"`
+	Privileged bool      `json:"privileged"`
+	PID        int       `json:"pid"`
+	Running    bool      `json:"running"`
+	ExitCode   int       `json:"exit_code"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// execNamespaces exec 进程加入的命名空间，与当前进程相同的会跳过
+// mnt 必须最后加入，切换后宿主机的 /proc 不再可见
+var execNamespaces = []struct {
+	name string
+	flag int
+}{
+	{"ipc", unix.CLONE_NEWIPC},
+	{"uts", unix.CLONE_NEWUTS},
+	{"net", unix.CLONE_NEWNET},
+	{"pid", unix.CLONE_NEWPID},
+	{"cgroup", unix.CLONE_NEWCGROUP},
+	{"mnt", unix.CLONE_NEWNS},
+}
+
+// exec 通过 nsexec 辅助进程在容器内执行命令，命令继承容器的环境变量和工作目录
+// 前台执行时返回命令的退出码；后台执行时输出写入 exec 日志，打印会话 ID 后立即返回
+func (c *container) exec(opts *ExecOptions) (int, error) {
+	if c.Status == StatusPaused {
+		return 0, errPaused()
+	}
+	if c.Status != StatusRunning {
+		return 0, fmt.Errorf("container not running")
+	}
+	if len(opts.Cmd) == 0 {
+		return 0, fmt.Errorf("no command specified")
+	}
+	// exec 进程不在容器的用户命名空间中（见 execUser），授予的能力将在宿主机上生效
+	if c.UsernsRemap != nil && (opts.Privileged || len(opts.CapAdd) > 0) {
+		return 0, fmt.Errorf("exec --privileged and --cap-add are not supported for containers with --userns-remap")
+	}
+
+	// 后台执行的命令没有终端可以连接
+	tty := opts.Tty && !opts.Detach
+	execID := util.GenerateID("")
+	proc, err := json.Marshal(&execProcess{
+		ID:         execID,
+		Args:       opts.Cmd,
+		Env:        opts.Env,
+		WorkDir:    opts.WorkDir,
+		User:       opts.User,
+		Tty:        tty,
+		Detach:     opts.Detach,
+		Privileged: opts.Privileged,
+		CapAdd:     opts.CapAdd,
+		CapDrop:    opts.CapDrop,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("marshal exec process: %w", err)
+	}
+
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("create ready pipe: %w", err)
+	}
+	defer readyRead.Close()
+	defer readyWrite.Close()
+
+	task := exec.Command("/proc/self/exe", "nsexec")
+	task.Env = []string{
+		fmt.Sprintf("%s=%s", EnvDuckerID, c.ID),
+		fmt.Sprintf("%s=%s", envDuckerExec, proc),
+	}
+	task.ExtraFiles = []*os.File{readyWrite}
+
+	var runErr error
+	switch {
+	case opts.Detach:
+		runErr = startDetached(task, util.GetContainerExecLogPath(c.ID, execID))
+	case tty:
+		runErr = runInTerminal(task, opts.Interactive)
+	default:
+		task.Stdout, task.Stderr = os.Stdout, os.Stderr
+		if opts.Interactive {
+			task.Stdin = os.Stdin
+		}
+		runErr = task.Run()
+	}
+	readyWrite.Close()
+
+	// 前台执行时辅助进程已退出，后台执行时等待其上报启动结果
+	msg, err := io.ReadAll(readyRead)
+	if err != nil {
+		return 0, fmt.Errorf("read exec status: %w", err)
+	}
+	if string(msg) != execReady {
+		if opts.Detach && task.Process != nil {
+			task.Wait()
+		}
+		if len(msg) > 0 {
+			return 0, errors.New(string(msg))
+		}
+		if runErr != nil && exitCodeOf(runErr) < 0 {
+			return 0, runErr
+		}
+		return 0, fmt.Errorf("exec helper exited unexpectedly")
+	}
+
+	if opts.Detach {
+		task.Process.Release()
+		fmt.Println(execID)
+		return 0, nil
+	}
+	return exitCodeOf(runErr), nil
+}
+
+// startDetached 在新会话中启动辅助进程，标准输出和标准错误追加写入日志文件
+func startDetached(task *exec.Cmd, logPath string) error {
+	if err := util.EnsureDir(filepath.Dir(logPath)); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open exec log: %w", err)
+	}
+	defer logFile.Close()
+
+	task.Stdout, task.Stderr = logFile, logFile
+	task.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return task.Start()
+}
+
+// RunNsexec exec 辅助进程入口：加入容器后启动命令并记录 exec 会话，转发收到的信号，
+// 以命令的退出状态退出。启动失败的原因通过就绪管道上报给 exec 发起方
+func RunNsexec() error {
+	syscall.CloseOnExec(execReadyFd)
+	ready := os.NewFile(execReadyFd, "ready")
+	report := func(msg string) {
+		ready.WriteString(msg)
+		ready.Close()
+	}
+
+	cont, err := util.FindBy[container](util.TypeContainer, os.Getenv(EnvDuckerID))
+	if err != nil {
+		report(fmt.Sprintf("load config: %v", err))
+		return nil
+	}
+	var proc execProcess
+	if err := json.Unmarshal([]byte(os.Getenv(envDuckerExec)), &proc); err != nil {
+		report(fmt.Sprintf("parse exec process: %v", err))
+		return nil
+	}
+
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals)
+	pid, err := cont.startExec(&proc)
+	if err != nil {
+		report(err.Error())
+		return nil
+	}
+	cont.addExecSession(&proc, pid)
+	report(execReady)
+
+	exitCode := reapChildren(pid, signals)
+	cont.finishExecSession(proc.ID, exitCode)
+	os.Exit(exitCode)
+	return nil
+}
+
+// startExec 加入容器的命名空间和 cgroup 后启动命令，返回其在宿主机上的进程号
+func (c *container) startExec(proc *execProcess) (int, error) {
+	// 加入 mnt 命名空间后宿主机的 cgroup 文件系统不再可见，需要提前打开
+	procs, err := limit.OpenProcs(c.ID)
+	if err != nil {
+		return 0, err
+	}
+	defer procs.Close()
+
+	// 命名空间、能力和 seccomp 过滤器都属于线程，在独立的线程上加入容器并启动命令，
+	// 其余线程留在宿主机上读写容器状态
+	var pid int
+	err = runOnDisposableThread(func() error {
+		pid, err = c.startExecInContainer(proc, procs)
+		return err
+	})
+	return pid, err
+}
+
+// startExecInContainer 在当前线程上加入容器并启动命令，调用后该线程不能再用于其他操作
+func (c *container) startExecInContainer(proc *execProcess, procs *limit.Procs) (int, error) {
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+
+	workDir := proc.WorkDir
+	if workDir == "" {
+		workDir = c.WorkDir
+	}
+	if workDir != "" {
+		if err := os.Chdir(workDir); err != nil {
+			return 0, fmt.Errorf("chdir to workdir: %w", err)
+		}
+	}
+
+	// 未指定用户时使用容器的运行用户
+	if proc.User == "" {
+		proc.User = c.User
+	}
+	user, err := c.execUser(proc.User)
+	if err != nil {
+		return 0, err
+	}
+	attr := &syscall.SysProcAttr{Credential: user.Credential()}
+	env := c.environ(proc.Tty, user.Home, proc.Env...)
+	cmdPath, err := lookPath(proc.Args[0], env)
+	if err != nil {
+		return 0, err
+	}
+
+	// 命令在 exec 后立即停止，加入 cgroup 后再继续运行，确保它创建的所有进程都受容器资源限制；
+	// 辅助进程自身不加入 cgroup，其运行时线程不计入容器的进程数限制
+	attr.Ptrace = true
+	if proc.Tty {
+		attr.Setpgid, attr.Foreground = true, true
+	}
+	// 命令从当前线程 fork，继承其受限的能力和 seccomp 过滤器
+	caps, ambient := c.execCapabilities(proc)
+	if err := c.confine(caps, false); err != nil {
+		return 0, err
+	}
+	// 非 root 用户的能力在切换用户和 exec 时被清空，需要作为环境能力保留
+	if user.UID != 0 {
+		attr.AmbientCaps = ambient.list()
+	}
+	task := &exec.Cmd{Path: cmdPath, Args: proc.Args, Env: env, SysProcAttr: attr}
+	task.Stdin, task.Stdout, task.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := task.Start(); err != nil {
+		return 0, fmt.Errorf("exec %s: %w", proc.Args[0], err)
+	}
+	pid := task.Process.Pid
+	if err := joinStopped(procs, pid); err != nil {
+		unix.Kill(pid, unix.SIGKILL)
+		return 0, err
+	}
+	return pid, nil
+}
+
+// execCapabilities exec 命令的能力边界集和以非 root 用户运行时保留的环境能力，特权命令保留全部能力
+// 启用用户命名空间映射时命令以映射后的宿主机身份留在宿主机的用户命名空间中，
+// 环境能力和带文件能力的程序获得的能力都会在宿主机上生效，因此边界集和环境能力均为空，即使容器本身是特权容器
+func (c *container) execCapabilities(proc *execProcess) (caps, ambient capabilitySet) {
+	if c.UsernsRemap != nil {
+		return 0, 0
+	}
+	caps = c.capabilities().apply(proc.CapAdd, proc.CapDrop)
+	ambient = (c.ambientCapabilities() | capabilitySet(0).apply(proc.CapAdd, nil)) & caps
+	if proc.Privileged {
+		caps, ambient = allCapabilities(), allCapabilities()
+	}
+	return caps, ambient
+}
+
+// joinStopped 等待被跟踪的进程在 exec 后停止，将其加入容器 cgroup 后解除跟踪
+func joinStopped(procs *limit.Procs, pid int) error {
+	var status unix.WaitStatus
+	if _, err := unix.Wait4(pid, &status, 0, nil); err != nil {
+		return fmt.Errorf("wait for exec: %w", err)
+	}
+	if !status.Stopped() {
+		return fmt.Errorf("process exited before joining cgroup")
+	}
+	if err := procs.Add(pid); err != nil {
+		return fmt.Errorf("join cgroup: %w", err)
+	}
+	if err := unix.PtraceDetach(pid); err != nil {
+		return fmt.Errorf("detach process: %w", err)
+	}
+	return nil
+}
+
+// addExecSession 记录已启动的 exec 会话
+func (c *container) addExecSession(proc *execProcess, pid int) {
+	c.withLock(func() error {
+		c.Execs = append(c.Execs, &execSession{
+			ID:         proc.ID,
+			Cmd:        proc.Args,
+			User:       proc.User,
+			Tty:        proc.Tty,
+			Detach:     proc.Detach,
+			Privileged: proc.Privileged,
+			PID:        pid,
+			Running:    true,
+			StartedAt:  time.Now(),
+		})
+		return c.saveConfig()
+	})
+}
+
+// finishExecSession 记录 exec 会话的退出状态，容器已重新启动或被删除时忽略
+func (c *container) finishExecSession(execID string, exitCode int) {
+	c.withLock(func() error {
+		for _, session := range c.Execs {
+			if session.ID == execID {
+				session.Running = false
+				session.ExitCode = exitCode
+				session.FinishedAt = time.Now()
+				return c.saveConfig()
+			}
+		}
+		return nil
+	})
+}
+
+// execUser 解析 exec 命令的运行用户，需要在加入容器的 mnt 命名空间后调用
+// 多线程的进程无法加入用户命名空间，容器启用用户命名空间映射时命令留在宿主机的用户命名空间中，
+// 以映射后的宿主机身份运行：对容器文件的访问与容器内的同一用户一致，但不具备任何能力（见 execCapabilities）
+func (c *container) execUser(spec string) (*util.User, error) {
+	user := &util.User{Groups: []uint32{0}, Home: defaultHome}
+	if spec != "" {
+		var err error
+		if user, err = util.ResolveUser("/", spec); err != nil {
+			return nil, err
+		}
+	}
+	if c.UsernsRemap != nil {
+		return c.UsernsRemap.hostUser(user), nil
+	}
+	return user, nil
+}
+
+// enter 将当前线程加入容器的命名空间，之后 fork 的子进程即位于容器内
+func (c *container) enter() error {
+	// 与其他线程共享文件系统信息（根目录、工作目录）时无法加入 mnt 命名空间
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return fmt.Errorf("unshare fs: %w", err)
+	}
+
+	// 先打开所有命名空间，加入 mnt 后容器进程的 /proc 路径不再可用
+	fds := make(map[string]int)
+	defer func() {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+	}()
+	for _, ns := range execNamespaces {
+		target := fmt.Sprintf("/proc/%d/ns/%s", c.PID, ns.name)
+		if sameNamespace(target, "/proc/self/ns/"+ns.name) {
+			continue
+		}
+		fd, err := unix.Open(target, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open %s namespace: %w", ns.name, err)
+		}
+		fds[ns.name] = fd
+	}
+	for _, ns := range execNamespaces {
+		if fd, ok := fds[ns.name]; ok {
+			if err := unix.Setns(fd, ns.flag); err != nil {
+				return fmt.Errorf("setns %s: %w", ns.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sameNamespace 两个命名空间文件是否指向同一个命名空间，读取失败时视为不同
+func sameNamespace(a, b string) bool {
+	linkA, errA := os.Readlink(a)
+	linkB, errB := os.Readlink(b)
+	return errA == nil && errB == nil && linkA == linkB
+}
+
+const (
+	// defaultPath 容器环境变量未设置 PATH 时使用的默认值
+	defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	// defaultHome 以 root 运行时 HOME 的默认值
+	defaultHome = "/root"
+)
+
+// environ 容器进程的环境变量：默认值、镜像和运行参数中的配置，最后追加 extra，同名变量后者覆盖前者
+// home 为 HOME 的默认值，通常是运行用户的主目录
+func (c *container) environ(tty bool, home string, extra ...string) []string {
+	env := []string{"PATH=" + defaultPath, "HOME=" + home}
+	if tty {
+		env = append(env, "TERM=xterm")
+	}
+	env = append(env, c.Env...)
+	env = append(env, extra...)
+
+	// 同名变量只保留最后一个，保持首次出现的位置
+	index := make(map[string]int, len(env))
+	var result []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[name]; ok {
+			result[i] = kv
+			continue
+		}
+		index[name] = len(result)
+		result = append(result, kv)
+	}
+	return result
+}
+
+// lookPath 按 env 中的 PATH 查找可执行文件，名称包含 / 时直接使用
+func lookPath(file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	path := defaultPath
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "PATH="); ok {
+			path = value
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		candidate := filepath.Join(dir, file)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("exec %s: executable file not found in $PATH", file)
+}
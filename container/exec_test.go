@@ -0,0 +1,64 @@
+package container
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestExecCapabilities(t *testing.T) {
+	remap := &UsernsRemap{HostUID: defaultRemapID, HostGID: defaultRemapID}
+	netAdmin := capabilitySet(1 << unix.CAP_NET_ADMIN)
+	defaults := newCapabilitySet(defaultCapabilities)
+	tests := []struct {
+		name        string
+		opts        RunOptions
+		proc        execProcess
+		wantCaps    capabilitySet
+		wantAmbient capabilitySet
+	}{
+		{name: "defaults", wantCaps: defaults, wantAmbient: 0},
+		{name: "cap-add", proc: execProcess{CapAdd: []string{"CAP_NET_ADMIN"}}, wantCaps: defaults | netAdmin, wantAmbient: netAdmin},
+		{name: "privileged exec", proc: execProcess{Privileged: true}, wantCaps: allCapabilities(), wantAmbient: allCapabilities()},
+		{name: "privileged container", opts: RunOptions{Privileged: true}, wantCaps: allCapabilities(), wantAmbient: allCapabilities()},
+		// 命令留在宿主机的用户命名空间中，任何能力都会在宿主机上生效
+		{name: "userns remap", opts: RunOptions{UsernsRemap: remap}, wantCaps: 0, wantAmbient: 0},
+		{name: "userns remap with container cap-add", opts: RunOptions{UsernsRemap: remap, CapAdd: []string{"CAP_SYS_ADMIN"}}, wantCaps: 0, wantAmbient: 0},
+		{name: "userns remap privileged container", opts: RunOptions{UsernsRemap: remap, Privileged: true}, wantCaps: 0, wantAmbient: 0},
+		{name: "userns remap privileged exec", opts: RunOptions{UsernsRemap: remap}, proc: execProcess{Privileged: true, CapAdd: []string{capabilityAll}}, wantCaps: 0, wantAmbient: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &container{RunOptions: tt.opts}
+			caps, ambient := c.execCapabilities(&tt.proc)
+			if caps != tt.wantCaps {
+				t.Errorf("caps = %v, want %v", caps.names(), tt.wantCaps.names())
+			}
+			if ambient != tt.wantAmbient {
+				t.Errorf("ambient = %v, want %v", ambient.names(), tt.wantAmbient.names())
+			}
+		})
+	}
+}
+
+func TestExecUsernsRemapRejectsCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ExecOptions
+	}{
+		{name: "privileged", opts: ExecOptions{Privileged: true}},
+		{name: "cap-add", opts: ExecOptions{CapAdd: []string{"CAP_NET_ADMIN"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &container{Status: StatusRunning}
+			c.UsernsRemap = &UsernsRemap{HostUID: defaultRemapID, HostGID: defaultRemapID}
+			tt.opts.Cmd = []string{"true"}
+			_, err := c.exec(&tt.opts)
+			if err == nil || !strings.Contains(err.Error(), "--userns-remap") {
+				t.Errorf("exec() error = %v, want userns remap error", err)
+			}
+		})
+	}
+}
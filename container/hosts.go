@@ -0,0 +1,272 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"ducker/net"
+	"ducker/util"
+	"errors"
+	"fmt"
+	gonet "net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// hostHostsPath、hostResolvConfPath 宿主机的 hosts 和 DNS 配置，容器的配置以其为基础生成
+var (
+	hostHostsPath      = "/etc/hosts"
+	hostResolvConfPath = "/etc/resolv.conf"
+)
+
+const (
+	// maxHostnameLen 主机名的最大长度
+	maxHostnameLen = 64
+
+	// defaultHosts 容器 hosts 文件中的默认条目
+	defaultHosts = `127.0.0.1	localhost
+::1	localhost ip6-localhost ip6-loopback
+fe00::0	ip6-localnet
+ff00::0	ip6-mcastprefix
+ff02::1	ip6-allnodes
+ff02::2	ip6-allrouters
+`
+)
+
+// defaultNameservers 宿主机上没有容器可以访问的 DNS 服务器时使用
+var defaultNameservers = []string{"8.8.8.8", "8.8.4.4"}
+
+// hostnamePattern 主机名由字母、数字、连字符和点组成，首尾只能是字母或数字
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+
+// ValidateHostname 检查 --hostname 参数，为空时使用默认主机名
+func ValidateHostname(name string) error {
+	if name != "" && (len(name) > maxHostnameLen || !hostnamePattern.MatchString(name)) {
+		return fmt.Errorf("invalid hostname %q", name)
+	}
+	return nil
+}
+
+// ValidateExtraHosts 检查 --add-host 参数 name:ip，IPv6 地址中的冒号属于 IP
+func ValidateExtraHosts(hosts []string) error {
+	for _, host := range hosts {
+		name, ip, _ := strings.Cut(host, ":")
+		if name == "" || ValidateHostname(name) != nil || gonet.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid extra host %q, expected name:ip", host)
+		}
+	}
+	return nil
+}
+
+// ValidateNameservers 检查 --dns 参数中的 DNS 服务器地址
+func ValidateNameservers(servers []string) error {
+	for _, server := range servers {
+		if gonet.ParseIP(server) == nil {
+			return fmt.Errorf("invalid dns server %q", server)
+		}
+	}
+	return nil
+}
+
+// networkFilesID 提供 hostname、hosts 和 resolv.conf 的容器：加入其他容器的网络命名空间时使用该容器的文件
+func (c *container) networkFilesID() string {
+	if target, ok := strings.CutPrefix(c.namespaceMode("net"), NamespaceContainerPrefix); ok {
+		return target
+	}
+	return c.ID
+}
+
+// hostname 容器的主机名：未指定时为容器 ID，与宿主机或其他容器共用 UTS 或网络命名空间时为其主机名
+func (c *container) hostname() string {
+	if c.Hostname != "" {
+		return c.Hostname
+	}
+	for _, kind := range []string{"uts", "net"} {
+		if target, ok := strings.CutPrefix(c.namespaceMode(kind), NamespaceContainerPrefix); ok {
+			if name, err := os.ReadFile(util.GetContainerHostnamePath(target)); err == nil {
+				return strings.TrimSpace(string(name))
+			}
+		}
+	}
+	if c.namespaceMode("uts") == NamespaceHost || c.namespaceMode("net") == NamespaceHost {
+		if name, err := os.Hostname(); err == nil {
+			return name
+		}
+	}
+	return c.ID
+}
+
+// writeNetworkFiles 在容器目录下生成 hostname、hosts 和 resolv.conf，需要在连接网络后调用
+func (c *container) writeNetworkFiles() error {
+	if c.networkFilesID() != c.ID {
+		return nil
+	}
+	hostname := c.hostname()
+	hosts, err := c.hosts(hostname)
+	if err != nil {
+		return err
+	}
+	resolvConf, err := c.resolvConf()
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		util.GetContainerHostnamePath(c.ID):   hostname + "\n",
+		util.GetContainerHostsPath(c.ID):      hosts,
+		util.GetContainerResolvConfPath(c.ID): resolvConf,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+		}
+		// 容器内的 root 可以修改这些文件
+		if c.UsernsRemap != nil {
+			if err := os.Chown(path, int(c.UsernsRemap.HostUID), int(c.UsernsRemap.HostGID)); err != nil {
+				return fmt.Errorf("chown %s: %w", filepath.Base(path), err)
+			}
+		}
+	}
+	return nil
+}
+
+// hosts 生成容器的 hosts 文件：与宿主机共用网络时以宿主机的 hosts 为基础，之后是 --add-host 的条目和容器自身的地址
+func (c *container) hosts(hostname string) (string, error) {
+	var b strings.Builder
+	if c.namespaceMode("net") == NamespaceHost {
+		data, err := os.ReadFile(hostHostsPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("read %s: %w", hostHostsPath, err)
+		}
+		b.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			b.WriteByte('\n')
+		}
+	} else {
+		b.WriteString(defaultHosts)
+	}
+
+	for _, host := range c.ExtraHosts {
+		name, ip, _ := strings.Cut(host, ":")
+		fmt.Fprintf(&b, "%s\t%s\n", ip, name)
+	}
+	if network, ok := c.bridgeNetwork(); ok {
+		if ip, err := net.GetContainerIP(network, c.ID); err == nil {
+			fmt.Fprintf(&b, "%s\t%s\n", ip, hostname)
+		}
+	}
+	return b.String(), nil
+}
+
+// resolvConf 生成容器的 resolv.conf：以宿主机的配置为基础，--dns、--dns-search、--dns-option 分别替换其中的对应部分。
+// 容器使用独立的网络命名空间时无法访问宿主机回环地址上的 DNS 服务（如 systemd-resolved），这些地址被过滤
+func (c *container) resolvConf() (string, error) {
+	nameservers, search, options, err := readResolvConf(hostResolvConfPath)
+	if err != nil {
+		return "", err
+	}
+	if c.namespaceMode("net") != NamespaceHost {
+		nameservers = slices.DeleteFunc(nameservers, func(server string) bool {
+			ip := gonet.ParseIP(server)
+			return ip != nil && ip.IsLoopback()
+		})
+		if len(nameservers) == 0 {
+			nameservers = defaultNameservers
+		}
+	}
+	if len(c.DNS) > 0 {
+		nameservers = c.DNS
+	}
+	if len(c.DNSSearch) > 0 {
+		search = c.DNSSearch
+		// --dns-search . 表示不使用搜索域
+		if slices.Equal(search, []string{"."}) {
+			search = nil
+		}
+	}
+	if len(c.DNSOptions) > 0 {
+		options = c.DNSOptions
+	}
+
+	var b strings.Builder
+	for _, server := range nameservers {
+		fmt.Fprintf(&b, "nameserver %s\n", server)
+	}
+	if len(search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(search, " "))
+	}
+	if len(options) > 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(options, " "))
+	}
+	return b.String(), nil
+}
+
+// readResolvConf 读取 resolv.conf 中的 DNS 服务器、搜索域和选项，文件不存在时均为空
+func readResolvConf(path string) (nameservers, search, options []string, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			nameservers = append(nameservers, fields[1])
+		case "search", "domain":
+			// 以最后一个 search 或 domain 为准
+			search = fields[1:]
+		case "options":
+			options = append(options, fields[1:]...)
+		}
+	}
+	return nameservers, search, options, nil
+}
+
+// mountNetworkFiles 设置主机名，并将 hostname、hosts 和 resolv.conf 绑定挂载到 rootfs 的 /etc 下，需要在切换根目录前调用
+func (c *container) mountNetworkFiles(rootfs string) error {
+	id := c.networkFilesID()
+	if c.namespaceMode("uts") == NamespacePrivate {
+		name, err := os.ReadFile(util.GetContainerHostnamePath(id))
+		if err != nil {
+			return fmt.Errorf("read hostname: %w", err)
+		}
+		if err := unix.Sethostname(bytes.TrimSpace(name)); err != nil {
+			return fmt.Errorf("set hostname: %w", err)
+		}
+	}
+
+	files := map[string]string{
+		"/etc/hostname":    util.GetContainerHostnamePath(id),
+		"/etc/hosts":       util.GetContainerHostsPath(id),
+		"/etc/resolv.conf": util.GetContainerResolvConfPath(id),
+	}
+	for target, source := range files {
+		path := filepath.Join(rootfs, target)
+		// 镜像中的符号链接会按宿主机的根目录解析，替换为普通文件后再挂载
+		if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSymlink != 0 {
+			os.Remove(path)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("create %s: %w", filepath.Dir(target), err)
+			}
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				return fmt.Errorf("create %s: %w", target, err)
+			}
+		}
+		if err := unix.Mount(source, path, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("mount %s: %w", target, err)
+		}
+	}
+	return nil
+}
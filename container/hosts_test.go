@@ -0,0 +1,222 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useHostFiles 将宿主机的 hosts 和 resolv.conf 替换为临时文件，内容为空时文件不存在
+func useHostFiles(t *testing.T, hosts, resolvConf string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldHosts, oldResolvConf := hostHostsPath, hostResolvConfPath
+	hostHostsPath = filepath.Join(dir, "hosts")
+	hostResolvConfPath = filepath.Join(dir, "resolv.conf")
+	t.Cleanup(func() { hostHostsPath, hostResolvConfPath = oldHosts, oldResolvConf })
+
+	for path, content := range map[string]string{hostHostsPath: hosts, hostResolvConfPath: resolvConf} {
+		if content == "" {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	for _, name := range []string{"", "web", "web-1", "a.example.com", "0123456789ab"} {
+		if err := ValidateHostname(name); err != nil {
+			t.Errorf("ValidateHostname(%q) error: %v", name, err)
+		}
+	}
+	long := strings.Repeat("a", maxHostnameLen+1)
+	for _, name := range []string{"-web", "web-", "web_1", "a b", ".web", long} {
+		if err := ValidateHostname(name); err == nil {
+			t.Errorf("ValidateHostname(%q) succeeded, want error", name)
+		}
+	}
+}
+
+func TestValidateExtraHosts(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{host: "db:10.0.0.2"},
+		{host: "db.local:10.0.0.2"},
+		{host: "v6:::1"},
+		{host: "v6:fe80::1"},
+		{host: "db", wantErr: true},
+		{host: "db:", wantErr: true},
+		{host: ":10.0.0.2", wantErr: true},
+		{host: "db:example.com", wantErr: true},
+		{host: "db_1:10.0.0.2", wantErr: true},
+		{host: "db:10.0.0.256", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := ValidateExtraHosts([]string{tt.host})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateExtraHosts(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateNameservers(t *testing.T) {
+	if err := ValidateNameservers([]string{"1.1.1.1", "2001:4860:4860::8888"}); err != nil {
+		t.Errorf("ValidateNameservers error: %v", err)
+	}
+	if err := ValidateNameservers([]string{"1.1.1.1", "dns.example.com"}); err == nil {
+		t.Error("ValidateNameservers with a hostname succeeded, want error")
+	}
+}
+
+func TestHostname(t *testing.T) {
+	hostHostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		options RunOptions
+		want    string
+	}{
+		{name: "default to container id", want: "0123456789ab"},
+		{name: "explicit", options: RunOptions{Hostname: "web"}, want: "web"},
+		{name: "explicit with host uts", options: RunOptions{Hostname: "web", UTSMode: NamespaceHost}, want: "web"},
+		{name: "host uts", options: RunOptions{UTSMode: NamespaceHost}, want: hostHostname},
+		{name: "host network", options: RunOptions{Network: NamespaceHost}, want: hostHostname},
+		{name: "other network", options: RunOptions{Network: "mynet"}, want: "0123456789ab"},
+		// 目标容器的 hostname 文件不存在时使用自身 ID
+		{name: "missing target container", options: RunOptions{UTSMode: NamespaceContainerPrefix + "does-not-exist"}, want: "0123456789ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &container{ID: "0123456789ab", RunOptions: tt.options}
+			if got := c.hostname(); got != tt.want {
+				t.Errorf("hostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostHosts string
+		options   RunOptions
+		want      string
+	}{
+		{
+			name:    "default",
+			options: RunOptions{Network: NetworkNone},
+			want:    defaultHosts,
+		},
+		{
+			name:    "add host",
+			options: RunOptions{Network: NetworkNone, ExtraHosts: []string{"db:10.0.0.2", "v6:fe80::1"}},
+			want:    defaultHosts + "10.0.0.2\tdb\nfe80::1\tv6\n",
+		},
+		{
+			// 宿主机网络以宿主机的 hosts 为基础，补齐末尾换行
+			name:      "host network",
+			hostHosts: "127.0.0.1\tlocalhost\n10.1.1.1\thost-only",
+			options:   RunOptions{Network: NamespaceHost, ExtraHosts: []string{"db:10.0.0.2"}},
+			want:      "127.0.0.1\tlocalhost\n10.1.1.1\thost-only\n10.0.0.2\tdb\n",
+		},
+		{
+			name:    "host network without hosts file",
+			options: RunOptions{Network: NamespaceHost},
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useHostFiles(t, tt.hostHosts, "")
+			c := &container{ID: "0123456789ab", RunOptions: tt.options}
+			got, err := c.hosts("web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("hosts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvConf(t *testing.T) {
+	const stubResolver = "nameserver 127.0.0.53\nsearch lan\noptions edns0 trust-ad\n"
+	tests := []struct {
+		name       string
+		hostResolv string
+		options    RunOptions
+		want       string
+	}{
+		{
+			name:       "host servers",
+			hostResolv: "# generated\nnameserver 10.0.0.1\nnameserver 10.0.0.2\nsearch example.com\n",
+			want:       "nameserver 10.0.0.1\nnameserver 10.0.0.2\nsearch example.com\n",
+		},
+		{
+			// systemd-resolved 的回环地址在容器网络命名空间中不可访问
+			name:       "loopback resolver falls back to defaults",
+			hostResolv: stubResolver,
+			want:       "nameserver 8.8.8.8\nnameserver 8.8.4.4\nsearch lan\noptions edns0 trust-ad\n",
+		},
+		{
+			name:       "loopback resolver filtered",
+			hostResolv: "nameserver 127.0.0.53\nnameserver ::1\nnameserver 10.0.0.1\n",
+			want:       "nameserver 10.0.0.1\n",
+		},
+		{
+			name:       "host network keeps loopback resolver",
+			hostResolv: stubResolver,
+			options:    RunOptions{Network: NamespaceHost},
+			want:       stubResolver,
+		},
+		{
+			name:       "missing host resolv.conf",
+			hostResolv: "",
+			want:       "nameserver 8.8.8.8\nnameserver 8.8.4.4\n",
+		},
+		{
+			name:       "last search or domain wins",
+			hostResolv: "nameserver 10.0.0.1\nsearch a.com b.com\ndomain c.com\n",
+			want:       "nameserver 10.0.0.1\nsearch c.com\n",
+		},
+		{
+			name:       "dns replaces host servers",
+			hostResolv: stubResolver,
+			options:    RunOptions{DNS: []string{"1.1.1.1", "127.0.0.1"}},
+			want:       "nameserver 1.1.1.1\nnameserver 127.0.0.1\nsearch lan\noptions edns0 trust-ad\n",
+		},
+		{
+			name:       "dns search and options",
+			hostResolv: stubResolver,
+			options:    RunOptions{DNSSearch: []string{"a.com", "b.com"}, DNSOptions: []string{"ndots:2"}},
+			want:       "nameserver 8.8.8.8\nnameserver 8.8.4.4\nsearch a.com b.com\noptions ndots:2\n",
+		},
+		{
+			name:       "dns search dot clears search",
+			hostResolv: "nameserver 10.0.0.1\nsearch lan\n",
+			options:    RunOptions{DNSSearch: []string{"."}},
+			want:       "nameserver 10.0.0.1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useHostFiles(t, "", tt.hostResolv)
+			c := &container{ID: "0123456789ab", RunOptions: tt.options}
+			got, err := c.resolvConf()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolvConf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// runInit 内置 init：作为容器的 PID 1 启动用户命令，转发收到的信号、回收孤儿进程，
+// 并以用户命令的退出状态退出。用户命令启动后不再返回。
+// init 与用户命令受同样的限制：在主线程上限制能力并切换用户，seccomp 过滤器和 no_new_privs 同步到所有线程，
+// 用户命令从主线程 fork 并继承这些限制。切换用户时所有线程一并切换；以 root 运行时，
+// 运行时在限制前创建的其他线程仍保留原有能力，但 init 的系统调用都在锁定的主线程上执行
+func (c *container) runInit(errPipe *os.File) error {
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals)
+
+	user, err := c.user()
+	if err != nil {
+		return err
+	}
+	env := c.environ(c.Tty, user.Home)
+	task := exec.Command(c.taskPath(env))
+	task.Args = c.Cmd
+	task.Env = env
+	task.Stdin, task.Stdout, task.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if c.Tty {
+		// 用户命令作为终端的前台进程组，终端产生的信号直接送达
+		task.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Foreground: true, Ctty: 0}
+	}
+
+	// 当前 goroutine 锁定在主线程上，主线程已加入容器的 cgroup 命名空间
+	caps := c.capabilities()
+	if err := c.confine(caps, true); err != nil {
+		return err
+	}
+	if c.User != "" {
+		ambient := c.ambientCapabilities()
+		if err := setCredential(user, ambient); err != nil {
+			return err
+		}
+		// keepcaps 保留了完整的许可集，普通用户下只保留需要传给用户命令的环境能力
+		if user.UID != 0 {
+			caps = ambient
+		}
+	}
+	if err := restrictCapabilities(caps); err != nil {
+		return err
+	}
+	if err := task.Start(); err != nil {
+		return fmt.Errorf("exec %s: %w", c.Cmd[0], err)
+	}
+	errPipe.Close() // 通知父进程用户命令已启动
+
+	os.Exit(reapChildren(task.Process.Pid, signals))
+	return nil
+}
+
+// reapChildren 回收所有退出的子进程并将其余信号转发给用户命令，返回用户命令的退出码
+func reapChildren(pid int, signals chan os.Signal) int {
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGCHLD:
+			for {
+				var status syscall.WaitStatus
+				child, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+				if err != nil || child <= 0 {
+					break
+				}
+				if child == pid {
+					if status.Signaled() {
+						return 128 + int(status.Signal())
+					}
+					return status.ExitStatus()
+				}
+			}
+		case syscall.SIGURG: // Go 运行时用于抢占调度
+		default:
+			syscall.Kill(pid, sig.(syscall.Signal))
+		}
+	}
+	return 0
+}
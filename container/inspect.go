@@ -0,0 +1,356 @@
+package container
+
+import (
+	"ducker/image"
+	"ducker/limit"
+	"ducker/net"
+	"ducker/util"
+	"ducker/volume"
+	"sort"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// InspectInfo 容器详情（inspect 输出结构）
+type InspectInfo struct {
+	ID              string
+	Name            string
+	Image           string
+	Created         time.Time
+	State           StateInfo
+	RestartCount    int
+	Config          ConfigInfo
+	HostConfig      HostConfigInfo
+	Mounts          []MountPoint
+	NetworkSettings NetworkSettings
+	Cgroup          CgroupInfo
+	GraphDriver     GraphDriverInfo
+	LogPath         string
+	HostnamePath    string
+	HostsPath       string
+	ResolvConfPath  string
+	ExecSessions    []ExecSessionInfo
+}
+
+// StateInfo 容器运行状态
+type StateInfo struct {
+	Status     Status
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	Pid        int
+	MonitorPid int
+	ExitCode   int
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// ConfigInfo 容器进程配置
+type ConfigInfo struct {
+	Hostname    string
+	Cmd         []string
+	Env         []string
+	WorkingDir  string
+	User        string
+	Interactive bool
+	Tty         bool
+	StopSignal  string
+	StopTimeout int
+}
+
+// HostConfigInfo 容器在主机侧的配置
+type HostConfigInfo struct {
+	AutoRemove     bool
+	Init           bool
+	RestartPolicy  RestartPolicyInfo
+	NetworkMode    string
+	PidMode        string
+	IpcMode        string
+	UTSMode        string
+	CgroupnsMode   string
+	Dns            []string
+	DnsSearch      []string
+	DnsOptions     []string
+	ExtraHosts     []string
+	PortBindings   map[string]string
+	ReadonlyRootfs bool
+	Tmpfs          map[string]string
+	Devices        []DeviceInfo
+	UsernsRemap    *UsernsRemapInfo
+	Privileged     bool
+	CapAdd         []string
+	CapDrop        []string
+	Capabilities   []string
+	SecurityOpt    []string
+
+	CPUs                float64
+	CPUShares           uint64
+	CpusetCpus          string
+	CpusetMems          string
+	Memory              uint64
+	MemorySwap          int64
+	MemoryReservation   uint64
+	OOMKillDisable      bool
+	PidsLimit           int64
+	BlkioDeviceReadBps  []ThrottleDeviceInfo
+	BlkioDeviceWriteBps []ThrottleDeviceInfo
+}
+
+// RestartPolicyInfo 重启策略
+type RestartPolicyInfo struct {
+	Name              string
+	MaximumRetryCount int
+}
+
+// DeviceInfo --device 添加到容器中的设备，CgroupPermissions 为 r、w、m 的组合
+type DeviceInfo struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
+}
+
+// ThrottleDeviceInfo 块设备的 I/O 速率限制，Rate 单位为字节每秒
+type ThrottleDeviceInfo struct {
+	Path string
+	Rate uint64
+}
+
+// UsernsRemapInfo 用户命名空间映射，容器内从 0 开始的 Size 个 ID 映射到宿主机上从 HostUID/HostGID 开始的区间
+type UsernsRemapInfo struct {
+	HostUID uint32
+	HostGID uint32
+	Size    uint32
+}
+
+// MountPoint 挂载点，Type 为 bind 或 volume
+type MountPoint struct {
+	Type        string
+	Name        string
+	Source      string
+	Destination string
+}
+
+// NetworkSettings 容器网络信息，Networks 为 网络名 -> 连接信息
+type NetworkSettings struct {
+	Networks map[string]net.Endpoint
+	Ports    map[string]string
+}
+
+// CgroupInfo 容器 cgroup 路径，cgroup v2 下各子系统路径相同
+type CgroupInfo struct {
+	Version int
+	CPU     string
+	Memory  string
+	Freezer string
+}
+
+// ExecSessionInfo 容器本次启动以来的 exec 会话，LogPath 为后台执行的命令的输出日志
+type ExecSessionInfo struct {
+	ID         string
+	Cmd        []string
+	User       string
+	Tty        bool
+	Detach     bool
+	Privileged bool
+	Pid        int
+	Running    bool
+	ExitCode   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	LogPath    string
+}
+
+// GraphDriverInfo overlay 文件系统各层路径
+type GraphDriverInfo struct {
+	Name      string
+	LowerDirs []string
+	UpperDir  string
+	WorkDir   string
+	MergedDir string
+}
+
+// Inspect 获取容器详情
+func Inspect(target string) (*InspectInfo, error) {
+	c, err := Get(target)
+	if err != nil {
+		return nil, err
+	}
+	return c.inspect(), nil
+}
+
+func (c *container) inspect() *InspectInfo {
+	info := &InspectInfo{
+		ID:           c.ID,
+		Name:         c.Name,
+		Image:        c.ImageTag,
+		Created:      c.CreatedAt,
+		RestartCount: c.RestartCount,
+		State: StateInfo{
+			Status:     c.Status,
+			Running:    c.Status == StatusRunning || c.Status == StatusPaused,
+			Paused:     c.Status == StatusPaused,
+			Restarting: c.Status == StatusRestarting,
+			OOMKilled:  c.OOMKilled,
+			Dead:       c.Status == StatusDead,
+			Pid:        c.PID,
+			MonitorPid: c.MonitorPID,
+			ExitCode:   c.ExitCode,
+			Error:      c.Error,
+			StartedAt:  c.StartedAt,
+			FinishedAt: c.FinishedAt,
+		},
+		Config: ConfigInfo{
+			Hostname:    c.hostname(),
+			Cmd:         c.Cmd,
+			Env:         c.Env,
+			WorkingDir:  c.WorkDir,
+			User:        c.User,
+			Interactive: c.Interactive,
+			Tty:         c.Tty,
+			StopSignal:  unix.SignalName(c.stopSignal()),
+			StopTimeout: c.stopTimeout(),
+		},
+		HostConfig: HostConfigInfo{
+			AutoRemove: c.AutoRemove,
+			Init:       c.Init,
+			RestartPolicy: RestartPolicyInfo{
+				Name:              c.Restart.name(),
+				MaximumRetryCount: c.Restart.MaximumRetryCount,
+			},
+			NetworkMode:    c.Network,
+			PidMode:        c.namespaceMode("pid"),
+			IpcMode:        c.namespaceMode("ipc"),
+			UTSMode:        c.namespaceMode("uts"),
+			CgroupnsMode:   c.namespaceMode("cgroup"),
+			Dns:            c.DNS,
+			DnsSearch:      c.DNSSearch,
+			DnsOptions:     c.DNSOptions,
+			ExtraHosts:     c.ExtraHosts,
+			PortBindings:   c.Ports,
+			ReadonlyRootfs: c.ReadonlyRootfs,
+			Tmpfs:          c.Tmpfs,
+			Devices:        c.devices(),
+			UsernsRemap:    c.usernsRemapInfo(),
+			Privileged:     c.Privileged,
+			CapAdd:         c.CapAdd,
+			CapDrop:        c.CapDrop,
+			Capabilities:   c.capabilities().names(),
+			SecurityOpt:    c.SecurityOpt,
+
+			CPUs:                c.CPUs,
+			CPUShares:           c.CPUShares,
+			CpusetCpus:          c.CpusetCpus,
+			CpusetMems:          c.CpusetMems,
+			Memory:              c.Memory,
+			MemorySwap:          c.MemorySwap,
+			MemoryReservation:   c.MemoryReservation,
+			OOMKillDisable:      c.OOMKillDisable,
+			PidsLimit:           c.PidsLimit,
+			BlkioDeviceReadBps:  throttleDevices(c.DeviceReadBps),
+			BlkioDeviceWriteBps: throttleDevices(c.DeviceWriteBps),
+		},
+		Mounts: c.mountPoints(),
+		NetworkSettings: NetworkSettings{
+			Networks: net.ContainerEndpoints(c.ID),
+			Ports:    c.Ports,
+		},
+		Cgroup: CgroupInfo{
+			Version: limit.Version(),
+			CPU:     limit.Path(c.ID, "cpu"),
+			Memory:  limit.Path(c.ID, "memory"),
+			Freezer: limit.Path(c.ID, "freezer"),
+		},
+		GraphDriver: GraphDriverInfo{
+			Name:      "overlay",
+			UpperDir:  util.GetContainerUpperDir(c.ID),
+			WorkDir:   util.GetContainerWorkDir(c.ID),
+			MergedDir: util.GetContainerMergedDir(c.ID),
+		},
+		LogPath:        util.GetContainerLogPath(c.ID),
+		HostnamePath:   util.GetContainerHostnamePath(c.networkFilesID()),
+		HostsPath:      util.GetContainerHostsPath(c.networkFilesID()),
+		ResolvConfPath: util.GetContainerResolvConfPath(c.networkFilesID()),
+		ExecSessions:   c.execSessions(),
+	}
+	if layers, err := image.GetLayers(c.ImageTag); err == nil {
+		info.GraphDriver.LowerDirs = layers
+	}
+	return info
+}
+
+// execSessions 将 exec 会话记录转换为 inspect 输出
+func (c *container) execSessions() []ExecSessionInfo {
+	sessions := make([]ExecSessionInfo, 0, len(c.Execs))
+	for _, s := range c.Execs {
+		info := ExecSessionInfo{
+			ID:         s.ID,
+			Cmd:        s.Cmd,
+			User:       s.User,
+			Tty:        s.Tty,
+			Detach:     s.Detach,
+			Privileged: s.Privileged,
+			Pid:        s.PID,
+			Running:    s.Running,
+			ExitCode:   s.ExitCode,
+			StartedAt:  s.StartedAt,
+			FinishedAt: s.FinishedAt,
+		}
+		if s.Detach {
+			info.LogPath = util.GetContainerExecLogPath(c.ID, s.ID)
+		}
+		sessions = append(sessions, info)
+	}
+	return sessions
+}
+
+// devices 将 --device 配置转换为 inspect 输出
+func (c *container) devices() []DeviceInfo {
+	devices := make([]DeviceInfo, 0, len(c.Devices))
+	for _, d := range c.Devices {
+		devices = append(devices, DeviceInfo{
+			PathOnHost:        d.PathOnHost,
+			PathInContainer:   d.PathInContainer,
+			CgroupPermissions: d.CgroupPermissions,
+		})
+	}
+	return devices
+}
+
+// throttleDevices 将块设备 I/O 速率限制转换为 inspect 输出
+func throttleDevices(devices []limit.ThrottleDevice) []ThrottleDeviceInfo {
+	infos := make([]ThrottleDeviceInfo, 0, len(devices))
+	for _, d := range devices {
+		infos = append(infos, ThrottleDeviceInfo{Path: d.Path, Rate: d.Rate})
+	}
+	return infos
+}
+
+// usernsRemapInfo 将用户命名空间映射转换为 inspect 输出，未启用时为 nil
+func (c *container) usernsRemapInfo() *UsernsRemapInfo {
+	if c.UsernsRemap == nil {
+		return nil
+	}
+	return &UsernsRemapInfo{HostUID: c.UsernsRemap.HostUID, HostGID: c.UsernsRemap.HostGID, Size: remapSize}
+}
+
+// mountPoints 将卷配置转换为挂载点列表，按容器内路径排序
+func (c *container) mountPoints() []MountPoint {
+	mounts := make([]MountPoint, 0, len(c.Volume))
+	for source, destination := range c.Volume {
+		hostPath, named := volume.ResolveSource(source)
+		mount := MountPoint{Type: "bind", Source: hostPath, Destination: destination}
+		if named {
+			mount.Type = "volume"
+			mount.Name = source
+		}
+		mounts = append(mounts, mount)
+	}
+	sort.Slice(mounts, func(i, j int) bool {
+		return mounts[i].Destination < mounts[j].Destination
+	})
+	return mounts
+}
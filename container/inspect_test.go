@@ -0,0 +1,50 @@
+package container
+
+import (
+	"ducker/limit"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// inspectJSON 将 inspect 输出的一部分编码为 JSON，字段名应与其余部分一致使用 PascalCase
+func inspectJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "_") {
+		t.Errorf("snake_case key in inspect output: %s", data)
+	}
+	return string(data)
+}
+
+func TestInspectUsernsRemap(t *testing.T) {
+	c := &container{}
+	if info := c.usernsRemapInfo(); info != nil {
+		t.Errorf("usernsRemapInfo() = %+v, want nil", info)
+	}
+
+	c.UsernsRemap = &UsernsRemap{HostUID: 200000, HostGID: 300000}
+	got := inspectJSON(t, HostConfigInfo{UsernsRemap: c.usernsRemapInfo()})
+	if want := `"UsernsRemap":{"HostUID":200000,"HostGID":300000,"Size":65536}`; !strings.Contains(got, want) {
+		t.Errorf("HostConfig = %s, want %s", got, want)
+	}
+}
+
+func TestInspectDevices(t *testing.T) {
+	c := &container{}
+	c.Devices = []Device{{PathOnHost: "/dev/sdb", PathInContainer: "/dev/xvdb", CgroupPermissions: "r"}}
+	got := inspectJSON(t, HostConfigInfo{Devices: c.devices()})
+	if want := `"Devices":[{"PathOnHost":"/dev/sdb","PathInContainer":"/dev/xvdb","CgroupPermissions":"r"}]`; !strings.Contains(got, want) {
+		t.Errorf("HostConfig = %s, want %s", got, want)
+	}
+}
+
+func TestInspectThrottleDevices(t *testing.T) {
+	got := inspectJSON(t, HostConfigInfo{BlkioDeviceReadBps: throttleDevices([]limit.ThrottleDevice{{Path: "/dev/sda", Rate: 1 << 20}})})
+	if want := `"BlkioDeviceReadBps":[{"Path":"/dev/sda","Rate":1048576}]`; !strings.Contains(got, want) {
+		t.Errorf("HostConfig = %s, want %s", got, want)
+	}
+}
@@ -1,15 +1,18 @@
 package container
 
 import (
+	"ducker/limit"
 	"ducker/util"
 	"fmt"
 	"os"
 	"slices"
 	"strings"
+	"syscall"
 	"text/tabwriter"
+	"time"
 )
 
-func Run(name, imageTag string, opts *RunOptions) (*container, error) {
+func Create(name, imageTag string, opts *RunOptions) (*container, error) {
 	if name != "" {
 		if _, err := Get(name); err == nil {
 			return nil, fmt.Errorf("container name %s already exists", name)
@@ -20,27 +23,66 @@ func Run(name, imageTag string, opts *RunOptions) (*container, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create container: %w", err)
 	}
+	return cont, nil
+}
+
+// Run 创建并启动容器，未 detach 时将当前终端连接到容器
+func Run(name, imageTag string, opts *RunOptions, detach bool, detachKeys string) (*container, error) {
+	keys, err := ParseDetachKeys(detachKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	cont, err := Create(name, imageTag, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := cont.start(); err != nil {
+	if err := cont.start(!detach, opts.Interactive, keys); err != nil {
 		return nil, fmt.Errorf("run container: %w", err)
 	}
 
 	return cont, nil
 }
 
-func Start(targets []string, attach, interactive bool) error {
+// Start 启动容器，attach 时连接容器输出，interactive 同时连接标准输入
+func Start(targets []string, attach, interactive bool, detachKeys string) error {
+	attach = attach || interactive
+	if attach && len(targets) > 1 {
+		return fmt.Errorf("you cannot start and attach multiple containers at once")
+	}
+	keys, err := ParseDetachKeys(detachKeys)
+	if err != nil {
+		return err
+	}
 	for _, target := range targets {
 		cont, err := Get(target)
 		if err != nil {
 			return fmt.Errorf("find container %s: %w", target, err)
 		}
-		if err := cont.start(); err != nil {
+		if err := cont.start(attach, interactive, keys); err != nil {
 			return fmt.Errorf("start container %s: %w", target, err)
 		}
 	}
 	return nil
 }
 
+// Attach 将当前终端连接到运行中的容器
+func Attach(target string, noStdin, sigProxy bool, detachKeys string) error {
+	keys, err := ParseDetachKeys(detachKeys)
+	if err != nil {
+		return err
+	}
+	cont, err := Get(target)
+	if err != nil {
+		return fmt.Errorf("find container %s: %w", target, err)
+	}
+	if err := cont.attach(!noStdin, sigProxy, keys); err != nil {
+		return fmt.Errorf("attach container %s: %w", target, err)
+	}
+	return nil
+}
+
 func Stop(targets []string, timeout int) error {
 	for _, target := range targets {
 		cont, err := Get(target)
@@ -54,17 +96,76 @@ func Stop(targets []string, timeout int) error {
 	return nil
 }
 
-func Exec(target string, interactive bool, env, cmd []string, workDir string) error {
-	cont, err := Get(target)
+func Kill(targets []string, signal string) error {
+	sig, err := util.ParseSignal(signal)
 	if err != nil {
-		return fmt.Errorf("find container %s: %w", target, err)
+		return err
+	}
+	for _, target := range targets {
+		cont, err := Get(target)
+		if err != nil {
+			return fmt.Errorf("find container %s: %w", target, err)
+		}
+		if err := cont.kill(sig); err != nil {
+			return fmt.Errorf("kill container %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+func Pause(targets []string) error {
+	for _, target := range targets {
+		cont, err := Get(target)
+		if err != nil {
+			return fmt.Errorf("find container %s: %w", target, err)
+		}
+		if err := cont.pause(); err != nil {
+			return fmt.Errorf("pause container %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+func Unpause(targets []string) error {
+	for _, target := range targets {
+		cont, err := Get(target)
+		if err != nil {
+			return fmt.Errorf("find container %s: %w", target, err)
+		}
+		if err := cont.unpause(); err != nil {
+			return fmt.Errorf("unpause container %s: %w", target, err)
+		}
 	}
-	if err := cont.exec(interactive, env, cmd, workDir); err != nil {
-		return fmt.Errorf("exec container %s: %w", target, err)
+	return nil
+}
+
+// Update 修改一个或多个容器的资源限制和重启策略
+func Update(targets []string, changes *limit.Resources, restart *RestartPolicy) error {
+	for _, target := range targets {
+		cont, err := Get(target)
+		if err != nil {
+			return fmt.Errorf("find container %s: %w", target, err)
+		}
+		if err := cont.update(changes, restart); err != nil {
+			return fmt.Errorf("update container %s: %w", target, err)
+		}
 	}
 	return nil
 }
 
+// Exec 在运行中的容器内执行命令，返回前台执行的命令的退出码
+func Exec(target string, opts *ExecOptions) (int, error) {
+	cont, err := Get(target)
+	if err != nil {
+		return 0, fmt.Errorf("find container %s: %w", target, err)
+	}
+	exitCode, err := cont.exec(opts)
+	if err != nil {
+		return 0, fmt.Errorf("exec container %s: %w", target, err)
+	}
+	return exitCode, nil
+}
+
 func Copy(srcPath, destPath string) error {
 	srcParts := strings.Split(srcPath, ":")
 	destParts := strings.Split(destPath, ":")
@@ -105,13 +206,21 @@ func Rm(targets []string, force, volumes bool) error {
 		if err != nil {
 			return fmt.Errorf("find container %s: %w", target, err)
 		}
-		if cont.Status == StatusRunning {
+		if cont.isActive() {
 			if !force {
 				return fmt.Errorf("container %s is running, use -f to force remove", target)
 			}
+			if cont.Status == StatusPaused {
+				if err := cont.unpause(); err != nil {
+					return fmt.Errorf("unpause container %s: %w", target, err)
+				}
+			}
 			if err := cont.stop(0); err != nil {
 				return fmt.Errorf("stop container %s: %w", target, err)
 			}
+			if cont.removed() {
+				continue
+			}
 		}
 		if err := cont.remove(); err != nil {
 			return fmt.Errorf("remove container %s: %w", target, err)
@@ -128,7 +237,7 @@ func List(showAll, quiet bool) error {
 
 	if !showAll {
 		containers = slices.DeleteFunc(containers, func(c *container) bool {
-			return c.Status != StatusRunning
+			return !c.isActive()
 		})
 	}
 
@@ -146,6 +255,43 @@ func List(showAll, quiet bool) error {
 	return nil
 }
 
+// Top 列出容器内运行的进程
+func Top(target string) error {
+	c, err := Get(target)
+	if err != nil {
+		return fmt.Errorf("find container %s: %w", target, err)
+	}
+	if err := c.top(); err != nil {
+		return fmt.Errorf("list processes of %s: %w", target, err)
+	}
+	return nil
+}
+
+// Stats 显示容器资源使用情况，未指定容器时显示所有运行中的容器
+// noStream 为 false 时每隔 statsInterval 刷新一次，直到被中断
+func Stats(targets []string, noStream bool) error {
+	containers, err := statsTargets(targets)
+	if err != nil {
+		return err
+	}
+	prev := collectStats(containers)
+	for {
+		time.Sleep(statsInterval)
+		if containers, err = statsTargets(targets); err != nil {
+			return err
+		}
+		curr := collectStats(containers)
+		if !noStream {
+			fmt.Print("\033[2J\033[H") // 清屏并将光标移到左上角
+		}
+		printStats(containers, prev, curr)
+		if noStream {
+			return nil
+		}
+		prev = curr
+	}
+}
+
 func Commit(target, tag string) error {
 	c, err := Get(target)
 	if err != nil {
@@ -184,10 +330,23 @@ func Get(nameOrID string) (*container, error) {
 	if !util.IsValidID(nameOrID) && cont.Name != nameOrID {
 		return nil, fmt.Errorf("container not found: %s", nameOrID)
 	}
+	cont.checkAlive()
 	return cont, nil
 }
 
 func getAllContainers() ([]*container, error) {
+	containers, err := loadAllContainers()
+	if err != nil {
+		return nil, err
+	}
+	for _, cont := range containers {
+		cont.checkAlive()
+	}
+	return containers, nil
+}
+
+// loadAllContainers 读取全部容器的配置，不检查监控进程是否存活
+func loadAllContainers() ([]*container, error) {
 	entries, err := os.ReadDir(util.GetContainerRootDir())
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -211,18 +370,57 @@ func printContainerInfo(containers []*container) {
 	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	defer writer.Flush()
 
-	fmt.Fprintln(writer, "CONTAINER ID\tIMAGE\tCOMMAND\tCREATED\tSTATUS\tNAMES")
+	fmt.Fprintln(writer, "CONTAINER ID\tIMAGE\tCOMMAND\tCREATED\tSTATUS\tRESTARTS\tNAMES")
 	for _, cont := range containers {
-		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
 			cont.ID, cont.ImageTag,
 			strings.Join(cont.Cmd, " "),
 			util.FormatDuration(cont.CreatedAt),
-			string(cont.Status), cont.Name,
+			cont.statusText(), cont.RestartCount, cont.Name,
 		)
 	}
 }
 
+// statusText ps 中显示的状态描述，如 "Up 5 minutes"、"Exited (137) 5 minutes ago"
+func (c *container) statusText() string {
+	startedAt := c.StartedAt
+	if startedAt.IsZero() {
+		startedAt = c.CreatedAt
+	}
+	switch c.Status {
+	case StatusCreated:
+		return "Created"
+	case StatusRunning:
+		return "Up " + util.FormatElapsed(startedAt)
+	case StatusPaused:
+		return fmt.Sprintf("Up %s (Paused)", util.FormatElapsed(startedAt))
+	case StatusRestarting:
+		return fmt.Sprintf("Restarting (%d) %s", c.ExitCode, util.FormatDuration(c.FinishedAt))
+	case StatusExited:
+		if c.FinishedAt.IsZero() {
+			return "Exited"
+		}
+		return fmt.Sprintf("Exited (%d) %s", c.ExitCode, util.FormatDuration(c.FinishedAt))
+	case StatusDead:
+		return "Dead"
+	default:
+		return string(c.Status)
+	}
+}
+
 func InitChildProc() error {
+	// 错误管道在 exec 用户命令时自动关闭，exec 之前的错误经由它回传给父进程
+	syscall.CloseOnExec(childErrorFd)
+	errPipe := os.NewFile(childErrorFd, "error")
+
+	err := initChildProc(errPipe)
+	if err != nil && errPipe != nil {
+		errPipe.WriteString(err.Error())
+	}
+	return err
+}
+
+func initChildProc(errPipe *os.File) error {
 	containerID := os.Getenv(EnvDuckerID)
 	if containerID == "" {
 		return fmt.Errorf("container ID not set")
@@ -233,7 +431,7 @@ func InitChildProc() error {
 		return fmt.Errorf("load config: %w", err)
 	}
 
-	if err := cont.runChildProc(); err != nil {
+	if err := cont.runChildProc(errPipe); err != nil {
 		return fmt.Errorf("init container: %w", err)
 	}
 	return nil
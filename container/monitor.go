@@ -0,0 +1,244 @@
+package container
+
+import (
+	"ducker/limit"
+	"ducker/util"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	gonet "net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// monitorReady 监控进程启动容器成功后写入就绪管道的消息
+	monitorReady = "OK"
+	// monitorExitTimeout 容器进程退出后等待监控进程完成清理的秒数
+	monitorExitTimeout = 5
+
+	// envDuckerAttach 前台启动时设置，监控进程等待客户端连接后再启动容器
+	envDuckerAttach = "DUCKER_ATTACH"
+
+	// 监控进程中就绪管道和 attach socket 的文件描述符
+	monitorReadyFd  = 3
+	monitorSocketFd = 4
+)
+
+// startMonitor 启动独立的监控进程（shim），由其拉起容器进程、回收退出状态并清理资源
+// 通过就绪管道等待容器启动结果，启动失败时返回监控进程上报的错误
+// attach 时在容器启动前连接 attach socket 并返回该连接
+func (c *container) startMonitor(attach bool) (conn *gonet.UnixConn, err error) {
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create ready pipe: %w", err)
+	}
+	defer readyRead.Close()
+
+	// attach socket 由当前进程创建后交给监控进程持有
+	sockPath := util.GetContainerAttachSocketPath(c.ID)
+	os.Remove(sockPath)
+	listener, err := gonet.ListenUnix("unix", &gonet.UnixAddr{Name: sockPath, Net: "unix"})
+	if err != nil {
+		readyWrite.Close()
+		return nil, fmt.Errorf("listen attach socket: %w", err)
+	}
+	listener.SetUnlinkOnClose(false)
+	defer listener.Close()
+	listenerFile, err := listener.File()
+	if err != nil {
+		readyWrite.Close()
+		return nil, fmt.Errorf("get attach socket file: %w", err)
+	}
+	defer listenerFile.Close()
+
+	cmd := exec.Command("/proc/self/exe", "monitor")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true} // 脱离当前会话，ducker 退出后继续运行
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", EnvDuckerID, c.ID))
+	if attach {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=1", envDuckerAttach))
+	}
+	cmd.ExtraFiles = []*os.File{readyWrite, listenerFile}
+
+	if err := cmd.Start(); err != nil {
+		readyWrite.Close()
+		os.Remove(sockPath)
+		return nil, fmt.Errorf("start monitor: %w", err)
+	}
+	readyWrite.Close()
+
+	if attach {
+		if conn, err = dialAttach(c.ID); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				conn.Close()
+			}
+		}()
+	}
+
+	msg, err := io.ReadAll(readyRead)
+	if err != nil {
+		return nil, fmt.Errorf("read monitor status: %w", err)
+	}
+	switch string(msg) {
+	case monitorReady:
+		cmd.Process.Release()
+	case "":
+		cmd.Wait()
+		return nil, fmt.Errorf("monitor exited unexpectedly")
+	default:
+		cmd.Wait()
+		return nil, errors.New(string(msg))
+	}
+	return conn, c.reload()
+}
+
+// RunMonitor 监控进程入口：启动容器进程，上报启动结果后等待其退出
+func RunMonitor() error {
+	syscall.CloseOnExec(monitorReadyFd)
+	syscall.CloseOnExec(monitorSocketFd)
+	ready := os.NewFile(monitorReadyFd, "ready")
+	report := func(msg string) {
+		ready.WriteString(msg)
+		ready.Close()
+	}
+
+	containerID := os.Getenv(EnvDuckerID)
+	if containerID == "" {
+		report("container ID not set")
+		return fmt.Errorf("container ID not set")
+	}
+
+	cont, err := util.FindBy[container](util.TypeContainer, containerID)
+	if err != nil {
+		report(err.Error())
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	stdio, err := newMonitorStdio(cont.ID)
+	if err != nil {
+		report(err.Error())
+		return err
+	}
+	defer stdio.close()
+	if os.Getenv(envDuckerAttach) != "" {
+		if err := stdio.acceptFirst(); err != nil {
+			report(err.Error())
+			return err
+		}
+	}
+	go stdio.serve()
+	cont.stdio = stdio
+
+	cmd, err := cont.launch()
+	if err != nil {
+		report(err.Error())
+		return fmt.Errorf("launch container: %w", err)
+	}
+	report(monitorReady)
+
+	cont.supervise(cmd)
+	return nil
+}
+
+// newMonitorStdio 使用启动方传入的 attach socket 创建 attach 服务
+func newMonitorStdio(containerID string) (*attachServer, error) {
+	socketFile := os.NewFile(monitorSocketFd, "attach")
+	defer socketFile.Close()
+	listener, err := gonet.FileListener(socketFile)
+	if err != nil {
+		return nil, fmt.Errorf("open attach socket: %w", err)
+	}
+	return newAttachServer(containerID, listener.(*gonet.UnixListener))
+}
+
+// supervise 等待容器进程退出并记录状态，按重启策略以指数退避重新拉起
+func (c *container) supervise(cmd *exec.Cmd) {
+	// stop 通过 SIGUSR1 唤醒退避等待中的监控进程
+	wake := make(chan os.Signal, 1)
+	signal.Notify(wake, syscall.SIGUSR1)
+	defer signal.Stop(wake)
+
+	backoff := restartBackoffMin
+	launchedAt := time.Now()
+	for {
+		oomBase := limit.OOMKillCount(c.ID)
+		exitCode := exitCodeOf(cmd.Wait())
+		oomKilled := limit.OOMKillCount(c.ID) > oomBase
+		c.stdio.closeStdin()
+		if time.Since(launchedAt) >= restartResetAfter {
+			backoff = restartBackoffMin
+		}
+
+		restart := false
+		c.withLock(func() error {
+			c.recordExit(exitCode, oomKilled)
+			restart = c.Restart.shouldRestart(exitCode, c.RestartCount, c.ManuallyStopped)
+			if restart {
+				c.Status = StatusRestarting
+				c.MonitorPID = os.Getpid()
+			}
+			return c.saveConfig()
+		})
+		if !restart {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-wake:
+		}
+		backoff = nextBackoff(backoff)
+
+		var next *exec.Cmd
+		err := c.withLock(func() error {
+			if c.ManuallyStopped {
+				c.Status = StatusExited
+				c.MonitorPID = 0
+				return c.saveConfig()
+			}
+			c.RestartCount++
+			var err error
+			next, err = c.launch()
+			return err
+		})
+		if err != nil {
+			slog.Error("restart container failed", "id", c.ID, "err", err)
+			break
+		}
+		if next == nil {
+			break
+		}
+		cmd = next
+		launchedAt = time.Now()
+	}
+
+	// 断开 attach 客户端后再删除容器目录
+	c.stdio.close()
+	if c.AutoRemove {
+		c.remove()
+	}
+}
+
+// exitCodeOf 将进程等待结果转换为退出码，被信号终止时返回 128+信号值
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return -1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
@@ -0,0 +1,355 @@
+package container
+
+import (
+	"ducker/limit"
+	"ducker/volume"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultDevices 容器 /dev 中创建的设备
+var defaultDevices = []struct {
+	name         string
+	major, minor uint32
+}{
+	{"null", 1, 3},
+	{"zero", 1, 5},
+	{"full", 1, 7},
+	{"random", 1, 8},
+	{"urandom", 1, 9},
+	{"tty", 5, 0},
+}
+
+// defaultDevLinks 容器 /dev 中的符号链接，链接名 -> 目标
+var defaultDevLinks = [][2]string{
+	{"fd", "/proc/self/fd"},
+	{"stdin", "/proc/self/fd/0"},
+	{"stdout", "/proc/self/fd/1"},
+	{"stderr", "/proc/self/fd/2"},
+	{"ptmx", "pts/ptmx"},
+}
+
+// maskedPaths 对容器隐藏的内核信息，目录以空的只读 tmpfs 覆盖，文件以 /dev/null 覆盖
+var maskedPaths = []string{
+	"/proc/acpi",
+	"/proc/asound",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// readonlyPaths 容器内只读的内核接口
+var readonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// tmpfsFlags --tmpfs 中可以指定的挂载标志，set 为真时设置 flag，否则清除
+var tmpfsFlags = map[string]struct {
+	flag uintptr
+	set  bool
+}{
+	"ro":     {unix.MS_RDONLY, true},
+	"rw":     {unix.MS_RDONLY, false},
+	"nosuid": {unix.MS_NOSUID, true},
+	"suid":   {unix.MS_NOSUID, false},
+	"nodev":  {unix.MS_NODEV, true},
+	"dev":    {unix.MS_NODEV, false},
+	"noexec": {unix.MS_NOEXEC, true},
+	"exec":   {unix.MS_NOEXEC, false},
+}
+
+// tmpfsParams --tmpfs 中传给 tmpfs 的参数
+var tmpfsParams = []string{"size", "mode", "uid", "gid", "nr_inodes", "nr_blocks"}
+
+// procMountFlags 容器 /proc 的挂载标志，只读重新挂载其下的路径时需要保留
+const procMountFlags = unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC
+
+// mountKernelFS 在 rootfs 下挂载 /proc、/sys 和 /dev，需要在切换根目录前调用：
+// 用户命名空间内只有宿主机的 proc 和 sysfs 仍然可见时才允许挂载新的实例
+func (c *container) mountKernelFS(rootfs string) error {
+	if err := mountAt(rootfs, "/proc", "proc", procMountFlags, ""); err != nil {
+		return err
+	}
+
+	// 特权容器可以通过 /sys 修改内核参数
+	sysFlags := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if !c.Privileged {
+		sysFlags |= unix.MS_RDONLY
+	}
+	if err := mountAt(rootfs, "/sys", "sysfs", sysFlags, ""); err != nil {
+		return err
+	}
+	if err := c.mountCgroup(rootfs); err != nil {
+		return err
+	}
+	return c.setupDev(rootfs)
+}
+
+// mountCgroup 将容器自身的 cgroup 挂载到 /sys/fs/cgroup，与 cgroup 命名空间一致，容器看不到其他 cgroup；
+// 非特权容器只读。与宿主机共用 cgroup 命名空间时不挂载
+func (c *container) mountCgroup(rootfs string) error {
+	if c.namespaceMode("cgroup") != NamespacePrivate {
+		return nil
+	}
+	flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if !c.Privileged {
+		flags |= unix.MS_RDONLY
+	}
+
+	hierarchies := limit.Hierarchies(c.ID)
+	if dir, ok := hierarchies[""]; ok {
+		return bindAt(rootfs, "/sys/fs/cgroup", dir, flags)
+	}
+	// cgroup v1 的各层级挂载在 tmpfs 下的同名目录中
+	if err := mountAt(rootfs, "/sys/fs/cgroup", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=755"); err != nil {
+		return err
+	}
+	for name, dir := range hierarchies {
+		if err := bindAt(rootfs, filepath.Join("/sys/fs/cgroup", name), dir, flags); err != nil {
+			return err
+		}
+	}
+	if err := unix.Mount("", filepath.Join(rootfs, "/sys/fs/cgroup"), "", unix.MS_REMOUNT|flags, "mode=755"); err != nil {
+		return fmt.Errorf("remount /sys/fs/cgroup: %w", err)
+	}
+	return nil
+}
+
+// setupDev 以 tmpfs 作为容器的 /dev，只提供标准设备，并挂载独立的 devpts、共享内存和消息队列
+func (c *container) setupDev(rootfs string) error {
+	if err := mountAt(rootfs, "/dev", "tmpfs", unix.MS_NOSUID|unix.MS_STRICTATIME, "mode=755,size=65536k"); err != nil {
+		return err
+	}
+	dev := filepath.Join(rootfs, "dev")
+	for _, d := range defaultDevices {
+		if err := createDevice(filepath.Join(dev, d.name), filepath.Join("/dev", d.name), unix.S_IFCHR|0666, unix.Mkdev(d.major, d.minor)); err != nil {
+			return err
+		}
+	}
+	for _, link := range defaultDevLinks {
+		if err := os.Symlink(link[1], filepath.Join(dev, link[0])); err != nil {
+			return fmt.Errorf("create /dev/%s: %w", link[0], err)
+		}
+	}
+
+	// 独立的 devpts 实例，容器内新建的伪终端与宿主机互不可见
+	if err := mountAt(rootfs, "/dev/pts", "devpts", unix.MS_NOSUID|unix.MS_NOEXEC, "newinstance,ptmxmode=0666,mode=0620,gid=5"); err != nil {
+		return err
+	}
+	if err := mountAt(rootfs, "/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777,size=65536k"); err != nil {
+		return err
+	}
+	// 消息队列属于挂载时所在的 IPC 命名空间，容器使用独立的 IPC 命名空间时与宿主机隔离
+	if err := mountAt(rootfs, "/dev/mqueue", "mqueue", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return err
+	}
+	if err := c.createDevices(rootfs); err != nil {
+		return err
+	}
+
+	// 容器的终端同时作为 /dev/console；终端属于宿主机的 devpts，需要按路径挂载
+	if c.Tty {
+		tty, err := os.Readlink("/proc/self/fd/0")
+		if err != nil {
+			return fmt.Errorf("resolve tty: %w", err)
+		}
+		console := filepath.Join(dev, "console")
+		if err := os.WriteFile(console, nil, 0600); err != nil {
+			return fmt.Errorf("create /dev/console: %w", err)
+		}
+		if err := unix.Mount(tty, console, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("mount /dev/console: %w", err)
+		}
+	}
+	return nil
+}
+
+// reopenConsole 通过 /dev/console 重新打开标准输入输出，使容器内的 ttyname 能够找到终端，需要在切换根目录后调用
+func reopenConsole() error {
+	console, err := unix.Open("/dev/console", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open /dev/console: %w", err)
+	}
+	defer unix.Close(console)
+	for fd := 0; fd <= 2; fd++ {
+		if err := unix.Dup3(console, fd, 0); err != nil {
+			return fmt.Errorf("dup console: %w", err)
+		}
+	}
+	return nil
+}
+
+// createDevice 创建设备节点，用户命名空间内不允许 mknod，改为绑定挂载宿主机上的 hostPath
+func createDevice(path, hostPath string, mode uint32, rdev uint64) error {
+	err := unix.Mknod(path, mode, int(rdev))
+	if err == nil {
+		// mknod 受 umask 影响
+		return os.Chmod(path, os.FileMode(mode&0777))
+	}
+	if !errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("mknod %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, nil, os.FileMode(mode&0777)); err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	if err := unix.Mount(hostPath, path, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind mount %s: %w", hostPath, err)
+	}
+	return nil
+}
+
+// maskPaths 隐藏敏感的内核信息并将内核接口设为只读，需要在切换根目录后调用；特权容器不做限制
+func (c *container) maskPaths() error {
+	if c.Privileged {
+		return nil
+	}
+	for _, path := range maskedPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // 当前内核没有该路径
+		}
+		if info.IsDir() {
+			err = unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, "")
+		} else {
+			err = unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+		}
+		if err != nil {
+			return fmt.Errorf("mask %s: %w", path, err)
+		}
+	}
+
+	for _, path := range readonlyPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind mount %s: %w", path, err)
+		}
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|procMountFlags, ""); err != nil {
+			return fmt.Errorf("remount %s read-only: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// ParseTmpfs 解析 --tmpfs 参数 /path[:options]，返回容器内路径 -> 挂载选项，
+// 选项以逗号分隔，如 size=64m,mode=1777,exec
+func ParseTmpfs(specs []string) (map[string]string, error) {
+	tmpfs := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		path, options, _ := strings.Cut(spec, ":")
+		if !filepath.IsAbs(path) || filepath.Clean(path) == "/" {
+			return nil, fmt.Errorf("invalid tmpfs path %q", path)
+		}
+		if _, _, err := tmpfsOptions(options); err != nil {
+			return nil, err
+		}
+		tmpfs[filepath.Clean(path)] = options
+	}
+	return tmpfs, nil
+}
+
+// tmpfsOptions 将 --tmpfs 的选项拆分为挂载标志和 tmpfs 参数，默认 nosuid、nodev、noexec
+func tmpfsOptions(options string) (uintptr, string, error) {
+	flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	var params []string
+	for _, option := range strings.Split(options, ",") {
+		if option == "" {
+			continue
+		}
+		if f, ok := tmpfsFlags[option]; ok {
+			if f.set {
+				flags |= f.flag
+			} else {
+				flags &^= f.flag
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(option, "=")
+		if !slices.Contains(tmpfsParams, key) {
+			return 0, "", fmt.Errorf("unsupported tmpfs option %q", option)
+		}
+		if value == "" {
+			return 0, "", fmt.Errorf("tmpfs option %q requires a value", key)
+		}
+		params = append(params, option)
+	}
+	return flags, strings.Join(params, ","), nil
+}
+
+// mountVolumes 在 rootfs 下挂载卷和 tmpfs，需要在切换根目录前调用。
+// 按容器内路径排序挂载，嵌套的挂载点在其父目录之后挂载
+func (c *container) mountVolumes(rootfs string) error {
+	targets := make([]string, 0, len(c.Volume)+len(c.Tmpfs))
+	sources := make(map[string]string, len(c.Volume))
+	for source, target := range c.Volume {
+		targets = append(targets, target)
+		sources[target] = source
+	}
+	for target := range c.Tmpfs {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		if source, ok := sources[target]; ok {
+			if err := volume.Mount(source, target, rootfs); err != nil {
+				return fmt.Errorf("mount volume %s: %w", target, err)
+			}
+			continue
+		}
+		flags, params, err := tmpfsOptions(c.Tmpfs[target])
+		if err != nil {
+			return err
+		}
+		if err := mountAt(rootfs, target, "tmpfs", flags, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindAt 将 source 绑定挂载到 rootfs 下的 target 处并设置挂载标志，挂载点不存在时创建
+func bindAt(rootfs, target, source string, flags uintptr) error {
+	path := filepath.Join(rootfs, target)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("create %s: %w", target, err)
+	}
+	if err := unix.Mount(source, path, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind mount %s: %w", target, err)
+	}
+	if err := unix.Mount(source, path, "", unix.MS_BIND|unix.MS_REMOUNT|flags, ""); err != nil {
+		return fmt.Errorf("remount %s: %w", target, err)
+	}
+	return nil
+}
+
+// mountAt 在 rootfs 下的 target 处挂载文件系统，挂载点不存在时创建
+func mountAt(rootfs, target, fstype string, flags uintptr, data string) error {
+	path := filepath.Join(rootfs, target)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("create %s: %w", target, err)
+	}
+	if err := unix.Mount(fstype, path, fstype, flags, data); err != nil {
+		return fmt.Errorf("mount %s: %w", target, err)
+	}
+	return nil
+}
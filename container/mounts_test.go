@@ -0,0 +1,78 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseTmpfs(t *testing.T) {
+	tests := []struct {
+		specs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{specs: []string{"/tmp"}, want: map[string]string{"/tmp": ""}},
+		{specs: []string{"/run/", "/var//cache:size=64m,mode=1777"}, want: map[string]string{"/run": "", "/var/cache": "size=64m,mode=1777"}},
+		{specs: []string{"/tmp:exec,uid=1000,gid=1000,nr_inodes=100"}, want: map[string]string{"/tmp": "exec,uid=1000,gid=1000,nr_inodes=100"}},
+		{specs: []string{"tmp"}, wantErr: true},
+		{specs: []string{"/"}, wantErr: true},
+		{specs: []string{"/tmp/.."}, wantErr: true},
+		{specs: []string{":size=1m"}, wantErr: true},
+		{specs: []string{"/tmp:size=1m,foo=bar"}, wantErr: true},
+		{specs: []string{"/tmp:bind"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTmpfs(tt.specs)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTmpfs(%q) = %v, want error", tt.specs, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTmpfs(%q) error: %v", tt.specs, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTmpfs(%q) = %v, want %v", tt.specs, got, tt.want)
+		}
+	}
+}
+
+func TestTmpfsOptions(t *testing.T) {
+	const defaults = unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC
+	tests := []struct {
+		options    string
+		wantFlags  uintptr
+		wantParams string
+	}{
+		{options: "", wantFlags: defaults},
+		{options: "size=64m", wantFlags: defaults, wantParams: "size=64m"},
+		{options: "size=64m,mode=1777", wantFlags: defaults, wantParams: "size=64m,mode=1777"},
+		{options: "noexec,nosuid", wantFlags: defaults},
+		{options: "exec", wantFlags: unix.MS_NOSUID | unix.MS_NODEV},
+		{options: "exec,noexec", wantFlags: defaults},
+		{options: "suid,dev,exec", wantFlags: 0},
+		{options: "ro,size=1m", wantFlags: defaults | unix.MS_RDONLY, wantParams: "size=1m"},
+		{options: "ro,rw", wantFlags: defaults},
+		{options: "mode=0700,,uid=1", wantFlags: defaults, wantParams: "mode=0700,uid=1"},
+	}
+	for _, tt := range tests {
+		flags, params, err := tmpfsOptions(tt.options)
+		if err != nil {
+			t.Errorf("tmpfsOptions(%q) error: %v", tt.options, err)
+			continue
+		}
+		if flags != tt.wantFlags || params != tt.wantParams {
+			t.Errorf("tmpfsOptions(%q) = %#x, %q, want %#x, %q", tt.options, flags, params, tt.wantFlags, tt.wantParams)
+		}
+	}
+
+	for _, options := range []string{"size", "mode=", "foo", "size=1m,remount", "noatime"} {
+		if _, _, err := tmpfsOptions(options); err == nil {
+			t.Errorf("tmpfsOptions(%q) succeeded, want error", options)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package container
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// NamespacePrivate 容器使用独立的命名空间
+	NamespacePrivate = "private"
+	// NamespaceHost 容器与宿主机共用命名空间
+	NamespaceHost = "host"
+	// NetworkNone 容器使用只有回环接口的独立网络命名空间
+	NetworkNone = "none"
+
+	// NamespaceContainerPrefix container:ID 表示加入另一个容器的命名空间
+	NamespaceContainerPrefix = "container:"
+)
+
+// sharedNamespaces 可以与宿主机或其他容器共享的命名空间
+var sharedNamespaces = []struct {
+	name string
+	flag uintptr
+	// modes 支持的取值，包含 container: 时可以加入其他容器的命名空间
+	modes []string
+}{
+	{"net", unix.CLONE_NEWNET, []string{NamespaceHost, NetworkNone, NamespaceContainerPrefix}},
+	{"pid", unix.CLONE_NEWPID, []string{NamespaceHost, NamespaceContainerPrefix}},
+	{"ipc", unix.CLONE_NEWIPC, []string{NamespacePrivate, NamespaceHost, NamespaceContainerPrefix}},
+	{"uts", unix.CLONE_NEWUTS, []string{NamespaceHost, NamespaceContainerPrefix}},
+	{"cgroup", unix.CLONE_NEWCGROUP, []string{NamespacePrivate, NamespaceHost}},
+}
+
+// ParseNamespaceMode 解析 --network、--pid、--ipc、--uts、--cgroupns 参数，kind 为命名空间名称。
+// container:NAME 中的容器必须已存在，转换为 container:ID 保存；--network 的其余取值为网络名称
+func ParseNamespaceMode(kind, mode string) (string, error) {
+	if mode == "" {
+		return mode, nil
+	}
+	for _, ns := range sharedNamespaces {
+		if ns.name != kind {
+			continue
+		}
+		if target, ok := strings.CutPrefix(mode, NamespaceContainerPrefix); ok && slices.Contains(ns.modes, NamespaceContainerPrefix) {
+			other, err := Get(target)
+			if err != nil {
+				return "", fmt.Errorf("find container %s: %w", target, err)
+			}
+			return NamespaceContainerPrefix + other.ID, nil
+		}
+		if kind == "net" || slices.Contains(ns.modes, mode) {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s namespace mode %q", kind, mode)
+}
+
+// namespaceMode 容器某个命名空间的配置：private、host 或 container:ID
+func (c *container) namespaceMode(kind string) string {
+	var mode string
+	switch kind {
+	case "net":
+		if c.Network == NamespaceHost || strings.HasPrefix(c.Network, NamespaceContainerPrefix) {
+			mode = c.Network
+		}
+	case "pid":
+		mode = c.PidMode
+	case "ipc":
+		mode = c.IpcMode
+	case "uts":
+		mode = c.UTSMode
+	case "cgroup":
+		mode = c.CgroupnsMode
+	}
+	if mode == "" {
+		return NamespacePrivate
+	}
+	return mode
+}
+
+// cloneFlags 创建容器进程时新建的命名空间
+// cgroup 命名空间以创建时所在的 cgroup 为根，由子进程在加入容器 cgroup 后通过 unshareCgroupNamespace 创建
+func (c *container) cloneFlags() uintptr {
+	flags := uintptr(unix.CLONE_NEWNS)
+	for _, ns := range sharedNamespaces {
+		if ns.flag != unix.CLONE_NEWCGROUP && c.namespaceMode(ns.name) == NamespacePrivate {
+			flags |= ns.flag
+		}
+	}
+	return flags
+}
+
+// joinNamespaces 将当前线程加入要共享的其他容器的命名空间，之后在该线程上创建的容器进程即位于其中
+func (c *container) joinNamespaces() error {
+	for _, ns := range sharedNamespaces {
+		target, ok := strings.CutPrefix(c.namespaceMode(ns.name), NamespaceContainerPrefix)
+		if !ok {
+			continue
+		}
+		other, err := Get(target)
+		if err != nil {
+			return fmt.Errorf("find container %s: %w", target, err)
+		}
+		if other.Status != StatusRunning && other.Status != StatusPaused {
+			return fmt.Errorf("cannot join %s namespace of container %s: container not running", ns.name, other.Name)
+		}
+
+		fd, err := unix.Open(fmt.Sprintf("/proc/%d/ns/%s", other.PID, ns.name), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open %s namespace: %w", ns.name, err)
+		}
+		err = unix.Setns(fd, int(ns.flag))
+		unix.Close(fd)
+		if err != nil {
+			return fmt.Errorf("setns %s: %w", ns.name, err)
+		}
+	}
+	return nil
+}
+
+// unshareCgroupNamespace 以容器的 cgroup 为根创建 cgroup 命名空间，容器内看到的 cgroup 路径均为 /。
+// 需要在父进程将容器进程加入 cgroup 之后调用，只对当前线程生效
+func (c *container) unshareCgroupNamespace() error {
+	if c.namespaceMode("cgroup") != NamespacePrivate {
+		return nil
+	}
+	if err := unix.Unshare(unix.CLONE_NEWCGROUP); err != nil {
+		return fmt.Errorf("unshare cgroup namespace: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package container
+
+import (
+	"ducker/limit"
+	"fmt"
+)
+
+// pause 通过 freezer cgroup 冻结容器内的所有进程
+func (c *container) pause() error {
+	return c.withLock(func() error {
+		if c.Status == StatusPaused {
+			return fmt.Errorf("container already paused")
+		}
+		if c.Status != StatusRunning {
+			return fmt.Errorf("container not running")
+		}
+		if err := limit.Freeze(c.ID); err != nil {
+			return fmt.Errorf("freeze: %w", err)
+		}
+		c.Status = StatusPaused
+		return c.saveConfig()
+	})
+}
+
+// unpause 解冻容器内的所有进程
+func (c *container) unpause() error {
+	return c.withLock(func() error {
+		if c.Status != StatusPaused {
+			return fmt.Errorf("container not paused")
+		}
+		if err := limit.Thaw(c.ID); err != nil {
+			return fmt.Errorf("thaw: %w", err)
+		}
+		c.Status = StatusRunning
+		return c.saveConfig()
+	})
+}
+
+// errPaused 冻结的进程无法处理信号或新进程，需要先解冻
+func errPaused() error {
+	return fmt.Errorf("container is paused, unpause it first")
+}
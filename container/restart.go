@@ -0,0 +1,187 @@
+package container
+
+import (
+	"bytes"
+	"ducker/util"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	RestartNo            = "no"
+	RestartOnFailure     = "on-failure"
+	RestartAlways        = "always"
+	RestartUnlessStopped = "unless-stopped"
+
+	restartBackoffMin = 100 * time.Millisecond
+	restartBackoffMax = time.Minute
+	// restartResetAfter 容器持续运行超过该时长后重置退避时间
+	restartResetAfter = 10 * time.Second
+
+	// bootIDPath 内核每次启动时生成的随机 ID
+	bootIDPath = "/proc/sys/kernel/random/boot_id"
+	// exitCodeHostReboot 主机重启前仍在运行的容器记录的退出码
+	exitCodeHostReboot = 255
+)
+
+// RestartPolicy 容器重启策略
+type RestartPolicy struct {
+	Name              string `json:"name"`
+	MaximumRetryCount int    `json:"maximum_retry_count"`
+}
+
+// ParseRestartPolicy 解析重启策略，格式: no | on-failure[:N] | always | unless-stopped
+func ParseRestartPolicy(s string) (RestartPolicy, error) {
+	if s == "" {
+		return RestartPolicy{Name: RestartNo}, nil
+	}
+
+	name, count, hasCount := strings.Cut(s, ":")
+	policy := RestartPolicy{Name: name}
+	switch name {
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+		if hasCount {
+			return policy, fmt.Errorf("maximum retry count cannot be used with restart policy %q", name)
+		}
+	case RestartOnFailure:
+		if hasCount {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				return policy, fmt.Errorf("invalid maximum retry count: %s", count)
+			}
+			policy.MaximumRetryCount = n
+		}
+	default:
+		return policy, fmt.Errorf("invalid restart policy: %s", s)
+	}
+	return policy, nil
+}
+
+func (p RestartPolicy) String() string {
+	if p.Name == RestartOnFailure && p.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", p.Name, p.MaximumRetryCount)
+	}
+	return p.name()
+}
+
+// name 策略名称，未设置时为 no
+func (p RestartPolicy) name() string {
+	if p.Name == "" {
+		return RestartNo
+	}
+	return p.Name
+}
+
+// IsNone 是否未设置重启策略
+func (p RestartPolicy) IsNone() bool {
+	return p.name() == RestartNo
+}
+
+// shouldRestart 根据退出码和已重启次数判断容器退出后是否需要重启，手动停止后都不再重启
+// always 与 unless-stopped 的区别在于主机重启后的行为，见 restartOnBoot
+func (p RestartPolicy) shouldRestart(exitCode, restartCount int, manuallyStopped bool) bool {
+	if manuallyStopped {
+		return false
+	}
+	switch p.Name {
+	case RestartAlways, RestartUnlessStopped:
+		return true
+	case RestartOnFailure:
+		return exitCode != 0 && (p.MaximumRetryCount == 0 || restartCount < p.MaximumRetryCount)
+	default:
+		return false
+	}
+}
+
+// restartOnBoot 主机重启后是否自动启动容器：always 总是启动，unless-stopped 只启动重启前没有被手动停止的容器
+func (p RestartPolicy) restartOnBoot(manuallyStopped bool) bool {
+	switch p.Name {
+	case RestartAlways:
+		return true
+	case RestartUnlessStopped:
+		return !manuallyStopped
+	default:
+		return false
+	}
+}
+
+// RestoreAfterBoot 主机重启后首次执行 ducker 命令时恢复容器：此前处于活动状态的容器记录为已退出，
+// 再按重启策略启动。首次记录启动 ID 时无从判断，不做处理
+func RestoreAfterBoot() error {
+	bootID, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return fmt.Errorf("read boot id: %w", err)
+	}
+	if err := util.EnsureDir(util.GetContainerRootDir()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(util.GetContainerBootIDPath(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open boot id: %w", err)
+	}
+	defer f.Close()
+	// 并发执行的命令中只有一个负责恢复，其余等待恢复完成
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock boot id: %w", err)
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	recorded, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("read boot id: %w", err)
+	}
+	if bytes.Equal(recorded, bootID) {
+		return nil
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("write boot id: %w", err)
+	}
+	if _, err := f.WriteAt(bootID, 0); err != nil {
+		return fmt.Errorf("write boot id: %w", err)
+	}
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	containers, err := loadAllContainers()
+	if err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if err := c.restoreAfterBoot(); err != nil {
+			slog.Warn("restore container failed", "id", c.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+// restoreAfterBoot 记录主机重启前仍在运行的容器已退出，按重启策略重新启动
+func (c *container) restoreAfterBoot() error {
+	if c.isActive() {
+		if err := c.withLock(func() error {
+			c.recordExit(exitCodeHostReboot, false)
+			c.Error = "host rebooted"
+			return c.saveConfig()
+		}); err != nil {
+			return err
+		}
+		if c.AutoRemove {
+			return c.remove()
+		}
+	}
+	if c.Status != StatusExited || !c.Restart.restartOnBoot(c.ManuallyStopped) {
+		return nil
+	}
+	return c.start(false, false, nil)
+}
+
+// nextBackoff 指数退避，上限 restartBackoffMax
+func nextBackoff(current time.Duration) time.Duration {
+	return min(current*2, restartBackoffMax)
+}
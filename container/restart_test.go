@@ -0,0 +1,93 @@
+package container
+
+import "testing"
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RestartPolicy
+		wantErr bool
+	}{
+		{in: "", want: RestartPolicy{Name: RestartNo}},
+		{in: "no", want: RestartPolicy{Name: RestartNo}},
+		{in: "always", want: RestartPolicy{Name: RestartAlways}},
+		{in: "unless-stopped", want: RestartPolicy{Name: RestartUnlessStopped}},
+		{in: "on-failure", want: RestartPolicy{Name: RestartOnFailure}},
+		{in: "on-failure:3", want: RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 3}},
+		{in: "on-failure:0", want: RestartPolicy{Name: RestartOnFailure}},
+		{in: "on-failure:-1", wantErr: true},
+		{in: "on-failure:x", wantErr: true},
+		{in: "always:3", wantErr: true},
+		{in: "unless-stopped:1", wantErr: true},
+		{in: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRestartPolicy(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRestartPolicy(%q) = %+v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRestartPolicy(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRestartPolicy(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	onFailure3 := RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 3}
+	tests := []struct {
+		name            string
+		policy          RestartPolicy
+		exitCode        int
+		restartCount    int
+		manuallyStopped bool
+		want            bool
+	}{
+		{name: "no", policy: RestartPolicy{Name: RestartNo}, exitCode: 1, want: false},
+		{name: "unset", policy: RestartPolicy{}, exitCode: 1, want: false},
+		{name: "always success", policy: RestartPolicy{Name: RestartAlways}, exitCode: 0, want: true},
+		{name: "always failure", policy: RestartPolicy{Name: RestartAlways}, exitCode: 1, restartCount: 100, want: true},
+		{name: "always stopped", policy: RestartPolicy{Name: RestartAlways}, exitCode: 137, manuallyStopped: true, want: false},
+		{name: "unless-stopped", policy: RestartPolicy{Name: RestartUnlessStopped}, exitCode: 0, want: true},
+		{name: "unless-stopped stopped", policy: RestartPolicy{Name: RestartUnlessStopped}, exitCode: 143, manuallyStopped: true, want: false},
+		{name: "on-failure success", policy: onFailure3, exitCode: 0, want: false},
+		{name: "on-failure below limit", policy: onFailure3, exitCode: 1, restartCount: 2, want: true},
+		{name: "on-failure at limit", policy: onFailure3, exitCode: 1, restartCount: 3, want: false},
+		{name: "on-failure unlimited", policy: RestartPolicy{Name: RestartOnFailure}, exitCode: 1, restartCount: 1000, want: true},
+		{name: "on-failure stopped", policy: onFailure3, exitCode: 1, manuallyStopped: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.shouldRestart(tt.exitCode, tt.restartCount, tt.manuallyStopped); got != tt.want {
+				t.Errorf("shouldRestart(%d, %d, %v) = %v, want %v", tt.exitCode, tt.restartCount, tt.manuallyStopped, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartOnBoot(t *testing.T) {
+	tests := []struct {
+		policy          string
+		manuallyStopped bool
+		want            bool
+	}{
+		{policy: RestartNo, want: false},
+		{policy: RestartOnFailure, want: false},
+		{policy: RestartAlways, want: true},
+		{policy: RestartAlways, manuallyStopped: true, want: true},
+		{policy: RestartUnlessStopped, want: true},
+		{policy: RestartUnlessStopped, manuallyStopped: true, want: false},
+	}
+	for _, tt := range tests {
+		p := RestartPolicy{Name: tt.policy}
+		if got := p.restartOnBoot(tt.manuallyStopped); got != tt.want {
+			t.Errorf("%s.restartOnBoot(%v) = %v, want %v", tt.policy, tt.manuallyStopped, got, tt.want)
+		}
+	}
+}
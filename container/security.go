@@ -0,0 +1,113 @@
+package container
+
+import (
+	"ducker/seccomp"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// SecurityOptions --security-opt 的解析结果
+type SecurityOptions struct {
+	// Seccomp 为空时使用默认配置，为 unconfined 时不过滤系统调用，否则为自定义配置的 JSON 内容
+	Seccomp string `json:"seccomp,omitempty"`
+	// NewPrivileges 为 true 时不设置 no_new_privs，容器内的 setuid 程序可以提升权限
+	NewPrivileges bool `json:"new_privileges,omitempty"`
+}
+
+// ParseSecurityOpts 解析 --security-opt 参数，支持 seccomp=unconfined、seccomp=配置文件路径
+// 和 no-new-privileges[=true|false]。配置文件在创建容器时读取并保存，之后修改文件不影响已创建的容器
+func ParseSecurityOpts(specs []string) (*SecurityOptions, error) {
+	opts := &SecurityOptions{}
+	for _, spec := range specs {
+		if spec == "no-new-privileges" {
+			continue // 默认即设置
+		}
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			// 兼容 Docker 的 seccomp:path 写法
+			key, value, ok = strings.Cut(spec, ":")
+		}
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid security option %q: expected key=value", spec)
+		}
+
+		switch key {
+		case "seccomp":
+			if value == seccomp.Unconfined {
+				opts.Seccomp = seccomp.Unconfined
+				continue
+			}
+			data, err := seccomp.Read(value)
+			if err != nil {
+				return nil, err
+			}
+			opts.Seccomp = string(data)
+		case "no-new-privileges":
+			noNewPrivileges, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid security option %q: expected true or false", spec)
+			}
+			opts.NewPrivileges = !noNewPrivileges
+		default:
+			return nil, fmt.Errorf("unsupported security option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+// seccompFilter 容器进程的 seccomp 过滤器，caps 为进程拥有的能力；特权容器和 unconfined 时为空
+func (c *container) seccompFilter(caps capabilitySet) ([]unix.SockFilter, error) {
+	if c.Privileged || c.Security.Seccomp == seccomp.Unconfined {
+		return nil, nil
+	}
+	profile := seccomp.Default()
+	if c.Security.Seccomp != "" {
+		var err error
+		if profile, err = seccomp.Parse([]byte(c.Security.Seccomp)); err != nil {
+			return nil, err
+		}
+	}
+	return profile.Compile(caps.names())
+}
+
+// confine 限制当前线程的能力、设置 no_new_privs 并加载 seccomp 过滤器，之后在该线程上 fork 或 exec 的进程都受其约束。
+// allThreads 为 true 时过滤器和 no_new_privs 同步到进程的所有线程，用于 exec 之后仍继续运行的 init。
+// 需要在切换用户前以 root 身份调用：修改边界集需要 CAP_SETPCAP，未设置 no_new_privs 时加载过滤器需要 CAP_SYS_ADMIN，
+// 切换为普通用户后这些能力都已失去。因此过滤器需要放行之后切换用户所需的 setgroups、setgid、setuid、capset 和 prctl
+func (c *container) confine(caps capabilitySet, allThreads bool) error {
+	if err := limitCapabilities(caps); err != nil {
+		return err
+	}
+	// 特权容器保留 setuid 程序提升权限的能力
+	if !c.Privileged && !c.Security.NewPrivileges {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set no_new_privs: %w", err)
+		}
+	}
+	prog, err := c.seccompFilter(caps)
+	if err != nil {
+		return err
+	}
+	if prog == nil {
+		return nil
+	}
+	if allThreads {
+		return seccomp.InstallAllThreads(prog)
+	}
+	return seccomp.Install(prog)
+}
+
+// runOnDisposableThread 在一个锁定的新线程上执行 fn，结束后不解除锁定，运行时随即销毁该线程，
+// 用于加入命名空间、加载过滤器等无法撤销的线程级操作
+func runOnDisposableThread(fn func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		errc <- fn()
+	}()
+	return <-errc
+}
@@ -0,0 +1,55 @@
+package container
+
+import (
+	"ducker/util"
+	"fmt"
+	"syscall"
+)
+
+const (
+	defaultStopSignal  = syscall.SIGTERM
+	defaultStopTimeout = 10
+)
+
+// stopSignal 停止容器时发送的信号：--stop-signal 或镜像的 STOPSIGNAL，默认 SIGTERM
+func (c *container) stopSignal() syscall.Signal {
+	if c.StopSignal == "" {
+		return defaultStopSignal
+	}
+	sig, err := util.ParseSignal(c.StopSignal)
+	if err != nil {
+		return defaultStopSignal
+	}
+	return sig
+}
+
+// stopTimeout 停止容器时等待进程退出的秒数
+func (c *container) stopTimeout() int {
+	if c.StopTimeout == nil {
+		return defaultStopTimeout
+	}
+	return *c.StopTimeout
+}
+
+// kill 向容器主进程发送信号
+// 发送 SIGKILL 或停止信号视为手动停止，不再触发重启策略
+func (c *container) kill(sig syscall.Signal) error {
+	return c.withLock(func() error {
+		if c.Status == StatusPaused {
+			return errPaused()
+		}
+		if c.Status != StatusRunning {
+			return fmt.Errorf("container not running")
+		}
+		if sig == syscall.SIGKILL || sig == c.stopSignal() {
+			c.ManuallyStopped = true
+			if err := c.saveConfig(); err != nil {
+				return err
+			}
+		}
+		if err := syscall.Kill(c.PID, sig); err != nil {
+			return fmt.Errorf("send signal %d: %w", sig, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,125 @@
+package container
+
+import (
+	"bufio"
+	"ducker/limit"
+	"ducker/net"
+	"ducker/util"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// statsInterval 两次采样的间隔，CPU 使用率为该区间内的平均值
+const statsInterval = time.Second
+
+// statsSample 某一时刻的容器资源使用情况
+type statsSample struct {
+	*limit.Stats
+	NetRx, NetTx uint64
+	At           time.Time
+}
+
+// sampleStats 读取容器当前的资源使用情况
+func (c *container) sampleStats() *statsSample {
+	sample := &statsSample{Stats: limit.GetStats(c.ID), At: time.Now()}
+	sample.NetRx, sample.NetTx, _ = net.TrafficStats(c.ID)
+	return sample
+}
+
+// statsTargets 获取要统计的容器，未指定时为所有运行中的容器
+func statsTargets(targets []string) ([]*container, error) {
+	if len(targets) == 0 {
+		containers, err := getAllContainers()
+		if err != nil {
+			return nil, fmt.Errorf("get containers: %w", err)
+		}
+		var running []*container
+		for _, c := range containers {
+			if c.Status == StatusRunning || c.Status == StatusPaused {
+				running = append(running, c)
+			}
+		}
+		slices.SortFunc(running, func(a, b *container) int {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+		return running, nil
+	}
+
+	containers := make([]*container, 0, len(targets))
+	for _, target := range targets {
+		c, err := Get(target)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+func collectStats(containers []*container) map[string]*statsSample {
+	samples := make(map[string]*statsSample, len(containers))
+	for _, c := range containers {
+		samples[c.ID] = c.sampleStats()
+	}
+	return samples
+}
+
+func printStats(containers []*container, prev, curr map[string]*statsSample) {
+	hostMemory := readHostMemory()
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, "CONTAINER ID\tNAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS")
+	for _, c := range containers {
+		sample := curr[c.ID]
+
+		var cpuPercent float64
+		if last, ok := prev[c.ID]; ok && sample.CPUUsage >= last.CPUUsage {
+			if wall := sample.At.Sub(last.At); wall > 0 {
+				cpuPercent = float64(sample.CPUUsage-last.CPUUsage) / float64(wall.Nanoseconds()) * 100
+			}
+		}
+
+		memLimit := sample.MemoryLimit
+		if memLimit == 0 || (hostMemory > 0 && memLimit > hostMemory) {
+			memLimit = hostMemory
+		}
+		var memPercent float64
+		if memLimit > 0 {
+			memPercent = float64(sample.MemoryUsage) / float64(memLimit) * 100
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\t%d\n",
+			c.ID, c.Name, cpuPercent,
+			util.FormatSize(int64(sample.MemoryUsage)), util.FormatSize(int64(memLimit)), memPercent,
+			util.FormatSize(int64(sample.NetRx)), util.FormatSize(int64(sample.NetTx)),
+			util.FormatSize(int64(sample.BlockRead)), util.FormatSize(int64(sample.BlockWrite)),
+			sample.Pids,
+		)
+	}
+}
+
+// readHostMemory 从 /proc/meminfo 读取主机总内存，作为未限制内存的容器的上限
+func readHostMemory() uint64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 格式: MemTotal:       16318424 kB
+		if value, ok := strings.CutPrefix(scanner.Text(), "MemTotal:"); ok {
+			kb, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			return kb * util.KB
+		}
+	}
+	return 0
+}
@@ -0,0 +1,160 @@
+package container
+
+import (
+	"bufio"
+	"ducker/limit"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// clockTicks /proc 中以时钟滴答计的时间单位（USER_HZ），Linux 上固定为 100
+const clockTicks = 100
+
+// procInfo 从 /proc 读取的进程信息
+type procInfo struct {
+	PID       int
+	PPID      int
+	NSPID     int // 容器 PID 命名空间中的 PID
+	UID       string
+	StartTime time.Time
+	CPUTime   time.Duration
+	Cmd       string
+}
+
+// top 列出容器 cgroup 中的进程
+func (c *container) top() error {
+	if c.Status != StatusRunning && c.Status != StatusPaused {
+		return fmt.Errorf("container not running")
+	}
+	pids, err := limit.Pids(c.ID)
+	if err != nil {
+		return err
+	}
+	bootTime, err := readBootTime()
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer writer.Flush()
+
+	fmt.Fprintln(writer, "UID\tPID\tPPID\tNSPID\tSTIME\tTIME\tCMD")
+	for _, pid := range pids {
+		proc, err := readProcInfo(pid, bootTime)
+		if err != nil {
+			continue // 进程已退出
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			proc.UID, proc.PID, proc.PPID, proc.NSPID,
+			formatStartTime(proc.StartTime), formatCPUTime(proc.CPUTime), proc.Cmd,
+		)
+	}
+	return nil
+}
+
+func readProcInfo(pid int, bootTime time.Time) (*procInfo, error) {
+	procDir := fmt.Sprintf("/proc/%d", pid)
+	stat, err := os.ReadFile(procDir + "/stat")
+	if err != nil {
+		return nil, err
+	}
+
+	// 格式: pid (comm) state ppid ...，comm 可能包含空格和括号
+	data := string(stat)
+	open, end := strings.IndexByte(data, '('), strings.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return nil, fmt.Errorf("parse %s/stat", procDir)
+	}
+	comm := data[open+1 : end]
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("parse %s/stat", procDir)
+	}
+	// fields[0] 为 state，其后依次为原文件的第 4 个字段起
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	startTicks, _ := strconv.ParseUint(fields[19], 10, 64)
+
+	proc := &procInfo{
+		PID:       pid,
+		PPID:      ppid,
+		NSPID:     pid,
+		StartTime: bootTime.Add(time.Duration(startTicks) * time.Second / clockTicks),
+		CPUTime:   time.Duration(utime+stime) * time.Second / clockTicks,
+		Cmd:       "[" + comm + "]",
+	}
+
+	if status, err := os.Open(procDir + "/status"); err == nil {
+		scanner := bufio.NewScanner(status)
+		for scanner.Scan() {
+			key, value, _ := strings.Cut(scanner.Text(), ":")
+			values := strings.Fields(value)
+			if len(values) == 0 {
+				continue
+			}
+			switch key {
+			case "Uid":
+				proc.UID = lookupUser(values[0])
+			case "NSpid":
+				// 最后一个为最内层命名空间中的 PID
+				proc.NSPID, _ = strconv.Atoi(values[len(values)-1])
+			}
+		}
+		status.Close()
+	}
+
+	if cmdline, err := os.ReadFile(procDir + "/cmdline"); err == nil && len(cmdline) > 0 {
+		proc.Cmd = strings.Join(strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"), " ")
+	}
+	return proc, nil
+}
+
+// readBootTime 从 /proc/stat 读取系统启动时间
+func readBootTime() (time.Time, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read boot time: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("parse boot time: %w", err)
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("boot time not found in /proc/stat")
+}
+
+// lookupUser 将 UID 转换为主机上的用户名，找不到时返回 UID
+func lookupUser(uid string) string {
+	if u, err := user.LookupId(uid); err == nil {
+		return u.Username
+	}
+	return uid
+}
+
+// formatStartTime 当天启动的进程显示时分，否则显示月日
+func formatStartTime(t time.Time) string {
+	now := time.Now()
+	if t.YearDay() == now.YearDay() && t.Year() == now.Year() {
+		return t.Format("15:04")
+	}
+	return t.Format("Jan02")
+}
+
+// formatCPUTime 格式化为 ps 风格的 hh:mm:ss
+func formatCPUTime(d time.Duration) string {
+	seconds := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
@@ -0,0 +1,129 @@
+package container
+
+import (
+	"ducker/util"
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ttyDrainTimeout 进程退出后等待伪终端剩余输出的最长时间，后台子进程可能仍持有从设备
+const ttyDrainTimeout = time.Second
+
+// encodeWinsize 窗口大小帧的数据：2 字节行数 + 2 字节列数
+func encodeWinsize(ws *unix.Winsize) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data, ws.Row)
+	binary.BigEndian.PutUint16(data[2:], ws.Col)
+	return data
+}
+
+func decodeWinsize(data []byte) *unix.Winsize {
+	if len(data) != 4 {
+		return nil
+	}
+	return &unix.Winsize{
+		Row: binary.BigEndian.Uint16(data),
+		Col: binary.BigEndian.Uint16(data[2:]),
+	}
+}
+
+// rawTerminal 标准输入为终端时切换为 raw 模式，返回恢复函数
+func rawTerminal() func() {
+	fd := os.Stdin.Fd()
+	if !util.IsTerminal(fd) {
+		return func() {}
+	}
+	state, err := util.MakeRaw(fd)
+	if err != nil {
+		return func() {}
+	}
+	return func() { util.RestoreTerminal(fd, state) }
+}
+
+// watchWinsize 立即及每次收到 SIGWINCH 时以当前终端窗口大小调用 apply，返回停止函数
+func watchWinsize(apply func(*unix.Winsize)) func() {
+	fd := os.Stdout.Fd()
+	if !util.IsTerminal(fd) {
+		fd = os.Stdin.Fd()
+	}
+	if !util.IsTerminal(fd) {
+		return func() {}
+	}
+
+	update := func() {
+		if ws, err := util.GetWinsize(fd); err == nil {
+			apply(ws)
+		}
+	}
+	update()
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-winch:
+				update()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
+
+// runInTerminal 为进程分配伪终端作为其控制终端并在前台运行
+// 当前终端在运行期间处于 raw 模式并同步窗口大小，退出时恢复
+func runInTerminal(cmd *exec.Cmd, withStdin bool) error {
+	master, slave, err := util.OpenPty()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+
+	stopWinsize := watchWinsize(func(ws *unix.Winsize) { util.SetWinsize(master.Fd(), ws) })
+	defer stopWinsize()
+	if withStdin {
+		defer rawTerminal()()
+	}
+
+	err = cmd.Start()
+	slave.Close()
+	if err != nil {
+		return err
+	}
+
+	if withStdin {
+		go io.Copy(master, os.Stdin)
+	}
+	output := make(chan struct{})
+	go func() {
+		defer close(output)
+		io.Copy(os.Stdout, master) // 从设备全部关闭后读取返回 EIO
+	}()
+
+	err = cmd.Wait()
+	select {
+	case <-output:
+	case <-time.After(ttyDrainTimeout):
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package container
+
+import (
+	"ducker/limit"
+	"fmt"
+)
+
+// update 修改容器的资源限制和重启策略，changes 中未设置的（零值）限制保持不变，restart 为 nil 时不修改
+// 运行中的容器立即写入 cgroup，其余状态的容器在下次启动时生效
+func (c *container) update(changes *limit.Resources, restart *RestartPolicy) error {
+	return c.withLock(func() error {
+		if c.Status == StatusDead {
+			return fmt.Errorf("container is dead")
+		}
+
+		resources := c.Resources
+		resources.Merge(changes)
+		if err := resources.Validate(); err != nil {
+			return err
+		}
+		if restart != nil {
+			if c.AutoRemove && !restart.IsNone() {
+				return fmt.Errorf("restart policy cannot be updated because auto-remove is enabled for the container")
+			}
+			c.Restart = *restart
+		}
+
+		// 重启退避期间没有进程但 cgroup 仍然保留，同样立即生效
+		if c.isActive() {
+			if err := limit.Update(c.ID, &resources); err != nil {
+				return fmt.Errorf("update cgroup: %w", err)
+			}
+		}
+		c.Resources = resources
+		return c.saveConfig()
+	})
+}
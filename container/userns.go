@@ -0,0 +1,192 @@
+package container
+
+import (
+	"ducker/util"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// UsernsRemapDefault --userns-remap 使用默认映射区间
+	UsernsRemapDefault = "default"
+	// defaultRemapID 默认映射区间在宿主机上的起始 UID/GID
+	defaultRemapID = 100000
+	// remapSize 映射的 ID 数量，容器内的 0-65535 映射到宿主机上的连续区间
+	remapSize = 65536
+)
+
+// UsernsRemap 用户命名空间的 ID 映射，容器内的 root 对应宿主机上的 HostUID/HostGID
+type UsernsRemap struct {
+	HostUID uint32 `json:"host_uid"`
+	HostGID uint32 `json:"host_gid"`
+}
+
+// ParseUsernsRemap 解析 --userns-remap 参数：default 或 uid[:gid]，未指定 gid 时与 uid 相同，空字符串表示不启用
+func ParseUsernsRemap(spec string) (*UsernsRemap, error) {
+	switch spec {
+	case "":
+		return nil, nil
+	case UsernsRemapDefault:
+		return &UsernsRemap{HostUID: defaultRemapID, HostGID: defaultRemapID}, nil
+	}
+
+	uidStr, gidStr, hasGID := strings.Cut(spec, ":")
+	if !hasGID {
+		gidStr = uidStr
+	}
+	uid, errUID := strconv.ParseUint(uidStr, 10, 32)
+	gid, errGID := strconv.ParseUint(gidStr, 10, 32)
+	if errUID != nil || errGID != nil || uid == 0 || gid == 0 {
+		return nil, fmt.Errorf("invalid userns remap %q: expected default or a non-root uid[:gid]", spec)
+	}
+	if uid+remapSize > 1<<32-1 || gid+remapSize > 1<<32-1 {
+		return nil, fmt.Errorf("invalid userns remap %q: id range out of bounds", spec)
+	}
+	return &UsernsRemap{HostUID: uint32(uid), HostGID: uint32(gid)}, nil
+}
+
+func (r *UsernsRemap) uidMappings() []syscall.SysProcIDMap {
+	return []syscall.SysProcIDMap{{ContainerID: 0, HostID: int(r.HostUID), Size: remapSize}}
+}
+
+func (r *UsernsRemap) gidMappings() []syscall.SysProcIDMap {
+	return []syscall.SysProcIDMap{{ContainerID: 0, HostID: int(r.HostGID), Size: remapSize}}
+}
+
+// hostUser 将容器内的用户身份转换为宿主机上对应的身份
+func (r *UsernsRemap) hostUser(user *util.User) *util.User {
+	host := &util.User{UID: r.HostUID + user.UID, GID: r.HostGID + user.GID, Home: user.Home}
+	for _, gid := range user.Groups {
+		host.Groups = append(host.Groups, r.HostGID+gid)
+	}
+	return host
+}
+
+// openUserns 创建具有该映射的用户命名空间并返回其文件描述符
+// 多线程的进程无法创建用户命名空间，借助一个在 exec 后即被跟踪停止的子进程创建，打开后即可将其杀死
+func (r *UsernsRemap) openUserns() (int, error) {
+	cmd := exec.Command("/proc/self/exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: r.uidMappings(),
+		GidMappings: r.gidMappings(),
+		Ptrace:      true,
+	}
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("create user namespace: %w", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		// 被跟踪的进程先报告停止，需要一直等到其退出
+		for {
+			var status unix.WaitStatus
+			if _, err := unix.Wait4(cmd.Process.Pid, &status, 0, nil); err != nil || status.Exited() || status.Signaled() {
+				break
+			}
+		}
+	}()
+
+	fd, err := unix.Open(fmt.Sprintf("/proc/%d/ns/user", cmd.Process.Pid), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("open user namespace: %w", err)
+	}
+	return fd, nil
+}
+
+// remapLayers 为镜像层创建 ID 映射挂载并返回映射后的路径：磁盘上属于 root 的文件在容器内仍属于 root，
+// 镜像层无需复制即可在不同映射的容器间共享
+// upper 目录不做映射，其中的文件以宿主机上平移后的 ID 保存，宿主机 root 可以直接写入容器的文件系统
+func (c *container) remapLayers(layers []string) ([]string, error) {
+	if err := c.unmountRemappedLayers(); err != nil {
+		return nil, err
+	}
+	usernsFd, err := c.UsernsRemap.openUserns()
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(usernsFd)
+
+	idmapDir := util.GetContainerIDMapDir(c.ID)
+	remapped := make([]string, 0, len(layers))
+	for i, layer := range layers {
+		target := filepath.Join(idmapDir, fmt.Sprintf("layer%d", i))
+		if err := util.EnsureDir(target); err != nil {
+			return nil, err
+		}
+		if err := util.IDMapMount(layer, target, usernsFd); err != nil {
+			c.unmountRemappedLayers()
+			return nil, err
+		}
+		remapped = append(remapped, target)
+	}
+
+	// 容器根目录的属主取自 upper 目录
+	if err := os.Lchown(util.GetContainerUpperDir(c.ID), int(c.UsernsRemap.HostUID), int(c.UsernsRemap.HostGID)); err != nil {
+		c.unmountRemappedLayers()
+		return nil, fmt.Errorf("chown upper dir: %w", err)
+	}
+	return remapped, nil
+}
+
+// shiftToHost 将 dir 下容器内 ID 的文件属主平移为宿主机上映射后的 ID，用于复制到容器内的文件
+func (r *UsernsRemap) shiftToHost(dir string) error {
+	return shiftOwner(dir, 0, r.HostUID, 0, r.HostGID)
+}
+
+// shiftToContainer 将 dir 下映射后的宿主机 ID 平移回容器内的 ID，用于提交容器的 upper 目录
+func (r *UsernsRemap) shiftToContainer(dir string) error {
+	return shiftOwner(dir, r.HostUID, 0, r.HostGID, 0)
+}
+
+// shiftOwner 将属主位于 [fromUID, fromUID+remapSize) 区间的文件平移到 toUID 起始的区间，组同理，区间外的 ID 保持不变
+func shiftOwner(dir string, fromUID, toUID, fromGID, toGID uint32) error {
+	shift := func(id, from, to uint32) int {
+		if id >= from && id-from < remapSize {
+			return int(id - from + to)
+		}
+		return int(id)
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		if err := os.Lchown(path, shift(st.Uid, fromUID, toUID), shift(st.Gid, fromGID, toGID)); err != nil {
+			return fmt.Errorf("chown %s: %w", path, err)
+		}
+		// chown 会清除 setuid/setgid 位，需要恢复
+		if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 && info.Mode()&os.ModeSymlink == 0 {
+			return os.Chmod(path, info.Mode())
+		}
+		return nil
+	})
+}
+
+// unmountRemappedLayers 卸载 ID 映射挂载，删除容器目录前必须成功，否则会删除镜像层中的文件
+func (c *container) unmountRemappedLayers() error {
+	idmapDir := util.GetContainerIDMapDir(c.ID)
+	entries, err := os.ReadDir(idmapDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read idmap dir: %w", err)
+	}
+	for _, entry := range entries {
+		target := filepath.Join(idmapDir, entry.Name())
+		if err := syscall.Unmount(target, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL {
+			return fmt.Errorf("unmount %s: %w", target, err)
+		}
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", target, err)
+		}
+	}
+	return nil
+}
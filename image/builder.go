@@ -7,7 +7,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 )
@@ -84,6 +83,10 @@ func (b *Builder) execute(inst *instruction) error {
 		b.opts.Port = append(b.opts.Port, inst.args...)
 	case "CMD":
 		b.opts.Cmd = inst.args
+	case "STOPSIGNAL":
+		b.opts.StopSignal = inst.args[0]
+	case "USER":
+		b.opts.User = inst.args[0]
 	case "COPY":
 		return b.execCopy(inst)
 	case "RUN":
@@ -136,13 +139,22 @@ func (b *Builder) execRun(inst *instruction) error {
 	}
 
 	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s",
-		strings.Join(b.currentLowerDirs(), ":"), upperDir, workDir)
+		util.OverlayLowerDir(b.currentLowerDirs()), upperDir, workDir)
 	if err := syscall.Mount("overlay", mergedDir, "overlay", 0, options); err != nil {
 		return fmt.Errorf("mount overlayfs: %w", err)
 	}
 	defer syscall.Unmount(mergedDir, syscall.MNT_DETACH)
 
-	cmd := exec.Command("chroot", mergedDir, "/bin/sh", "-c", inst.args[0])
+	// 以 USER 指定的用户执行，用户按当前构建的文件系统解析
+	cmd := &exec.Cmd{Path: "/bin/sh", Args: []string{"/bin/sh", "-c", inst.args[0]}, Dir: "/"}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Chroot: mergedDir}
+	if b.opts.User != "" {
+		user, err := util.ResolveUser(mergedDir, b.opts.User)
+		if err != nil {
+			return fmt.Errorf("resolve user: %w", err)
+		}
+		cmd.SysProcAttr.Credential = user.Credential()
+	}
 	cmd.Env = b.opts.Env
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -10,10 +10,12 @@ import (
 
 // RunOptions 镜像的默认运行配置（来自 Dockerfile）
 type RunOptions struct {
-	WorkDir string   `json:"workdir"`
-	Env     []string `json:"env"`
-	Port    []string `json:"port"`
-	Cmd     []string `json:"cmd"`
+	WorkDir    string   `json:"workdir"`
+	Env        []string `json:"env"`
+	Port       []string `json:"port"`
+	Cmd        []string `json:"cmd"`
+	User       string   `json:"user"`
+	StopSignal string   `json:"stop_signal"`
 }
 
 type Image struct {
@@ -0,0 +1,61 @@
+package image
+
+import "time"
+
+// InspectInfo 镜像详情（inspect 输出结构）
+type InspectInfo struct {
+	ID      string
+	Tag     string
+	Created time.Time
+	Size    int64
+	Hidden  bool
+	Config  ConfigInfo
+	RootFS  RootFSInfo
+}
+
+// ConfigInfo 镜像默认运行配置
+type ConfigInfo struct {
+	WorkingDir   string
+	Env          []string
+	ExposedPorts []string
+	Cmd          []string
+	User         string
+	StopSignal   string
+}
+
+// RootFSInfo 镜像层信息，Layers 与 LayerPaths 一一对应，由底层到顶层
+type RootFSInfo struct {
+	Layers     []string
+	LayerPaths []string
+}
+
+// Inspect 获取镜像详情
+func Inspect(tagOrID string) (*InspectInfo, error) {
+	img, err := Get(tagOrID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &InspectInfo{
+		ID:      img.ID,
+		Tag:     img.Tag,
+		Created: img.CreatedAt,
+		Size:    img.Size,
+		Hidden:  img.Hidden,
+		RootFS: RootFSInfo{
+			Layers:     img.Layers,
+			LayerPaths: img.getLayers(),
+		},
+	}
+	if img.RunOptions != nil {
+		info.Config = ConfigInfo{
+			WorkingDir:   img.WorkDir,
+			Env:          img.Env,
+			ExposedPorts: img.Port,
+			Cmd:          img.Cmd,
+			User:         img.User,
+			StopSignal:   img.StopSignal,
+		}
+	}
+	return info, nil
+}
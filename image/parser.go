@@ -2,6 +2,7 @@ package image
 
 import (
 	"bufio"
+	"ducker/util"
 	"fmt"
 	"log/slog"
 	"os"
@@ -20,7 +21,7 @@ type instruction struct {
 // 支持的命令列表
 var supportedCommands = map[string]bool{
 	"FROM": true, "RUN": true, "ENV": true, "WORKDIR": true,
-	"EXPOSE": true, "CMD": true, "COPY": true,
+	"EXPOSE": true, "CMD": true, "COPY": true, "STOPSIGNAL": true, "USER": true,
 }
 
 func isCommandSupported(command string) bool {
@@ -124,6 +125,8 @@ func (dp *duckerfileParser) parseCommand(command, argsStr string) ([]string, err
 		return dp.parseCopyArgs(argsStr)
 	case "EXPOSE":
 		return strings.Fields(argsStr), nil
+	case "STOPSIGNAL":
+		return dp.parseStopSignalArgs(argsStr)
 	default:
 		return []string{argsStr}, nil
 	}
@@ -172,6 +175,13 @@ func (dp *duckerfileParser) parseEnvArgs(argsStr string) ([]string, error) {
 	return parts, nil
 }
 
+func (dp *duckerfileParser) parseStopSignalArgs(argsStr string) ([]string, error) {
+	if _, err := util.ParseSignal(argsStr); err != nil {
+		return nil, err
+	}
+	return []string{argsStr}, nil
+}
+
 func (dp *duckerfileParser) getInstructions() []*instruction {
 	return dp.instructions
 }
@@ -0,0 +1,352 @@
+package limit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	freezerFrozen = "FROZEN"
+	freezerThawed = "THAWED"
+
+	// cpuPeriod CFS 调度周期，单位微秒，配额按 CPU 数换算
+	cpuPeriod = 100000
+
+	// memoryUnlimited cgroup v1 中不小于该值的内存限制视为未限制
+	memoryUnlimited = 1 << 62
+)
+
+// v1Subsystems 容器加入的 cgroup v1 子系统，cpu 与 cpuacct 合并挂载时重复加入同一 cgroup 无副作用
+var v1Subsystems = []string{"cpu", "cpuacct", "cpuset", "memory", "blkio", "pids", "freezer", "devices"}
+
+// v1Manager cgroup v1 后端，每个子系统为独立的层级，容器在各层级下使用以 ID 命名的 cgroup
+type v1Manager struct {
+	root string
+}
+
+func (m *v1Manager) version() int {
+	return 1
+}
+
+func (m *v1Manager) path(containerID, subsystem string) string {
+	return filepath.Join(m.root, subsystem, containerID)
+}
+
+// mounted 主机是否挂载了该子系统的层级
+func (m *v1Manager) mounted(subsystem string) bool {
+	_, err := os.Stat(filepath.Join(m.root, subsystem))
+	return err == nil
+}
+
+// hasSubsystem 子系统已挂载时返回 true；未挂载时只有设置了该子系统的限制（required）才返回错误，否则跳过
+func (m *v1Manager) hasSubsystem(subsystem string, required bool) (bool, error) {
+	if m.mounted(subsystem) {
+		return true, nil
+	}
+	if required {
+		return false, fmt.Errorf("cgroup subsystem %s is not mounted", subsystem)
+	}
+	return false, nil
+}
+
+// requiresSubsystem resources 中是否设置了需要该子系统的限制
+func requiresSubsystem(subsystem string, resources *Resources) bool {
+	switch subsystem {
+	case "cpu":
+		return resources.CPUs > 0 || resources.CPUShares > 0
+	case "cpuset":
+		return resources.CpusetCpus != "" || resources.CpusetMems != ""
+	case "memory":
+		return resources.Memory > 0 || resources.MemorySwap > 0 || resources.MemoryReservation > 0 || resources.OOMKillDisable
+	case "blkio":
+		return len(resources.DeviceReadBps) > 0 || len(resources.DeviceWriteBps) > 0
+	case "pids":
+		return resources.PidsLimit > 0
+	}
+	return false
+}
+
+func (m *v1Manager) availableCpuset(kind string) string {
+	return readTrimmed(filepath.Join(m.root, "cpuset"), "cpuset."+kind)
+}
+
+// apply 在已挂载的子系统中创建容器 cgroup，未挂载的子系统只在设置了对应限制时报错
+func (m *v1Manager) apply(containerID string, pid int, resources *Resources) error {
+	for _, subsystem := range v1Subsystems {
+		ok, err := m.hasSubsystem(subsystem, requiresSubsystem(subsystem, resources))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(m.path(containerID, subsystem), 0755); err != nil {
+			return fmt.Errorf("create %s cgroup: %w", subsystem, err)
+		}
+	}
+	// 确保重新启动的容器不会继承上一次的冻结状态
+	if m.mounted("freezer") {
+		if err := writeFile(m.path(containerID, "freezer"), "freezer.state", freezerThawed); err != nil {
+			return err
+		}
+	}
+	if err := m.setResources(containerID, resources); err != nil {
+		return err
+	}
+
+	return join(m.dirs(containerID), pid)
+}
+
+// dirs 加入所有已挂载的子系统，未设置限制的子系统用于统计资源使用
+func (m *v1Manager) dirs(containerID string) []string {
+	dirs := make([]string, 0, len(v1Subsystems))
+	for _, subsystem := range m.subsystems() {
+		dirs = append(dirs, m.path(containerID, subsystem))
+	}
+	return dirs
+}
+
+// subsystems 主机上已挂载的 v1Subsystems
+func (m *v1Manager) subsystems() []string {
+	var subsystems []string
+	for _, subsystem := range v1Subsystems {
+		if m.mounted(subsystem) {
+			subsystems = append(subsystems, subsystem)
+		}
+	}
+	return subsystems
+}
+
+// procsDir 用于列出容器进程的 cgroup，各层级中的进程相同，优先使用 freezer
+func (m *v1Manager) procsDir(containerID string) string {
+	if !m.mounted("freezer") {
+		if dirs := m.dirs(containerID); len(dirs) > 0 {
+			return dirs[0]
+		}
+	}
+	return m.path(containerID, "freezer")
+}
+
+// setResources 将资源限制写入各子系统，未设置的限制恢复为默认值，跳过未挂载且未设置限制的子系统
+func (m *v1Manager) setResources(containerID string, resources *Resources) error {
+	for _, set := range []struct {
+		subsystem string
+		fn        func(containerID string, resources *Resources) error
+	}{
+		{"cpu", m.setCPU},
+		{"cpuset", m.setCpuset},
+		{"memory", m.setMemory},
+		{"pids", m.setPids},
+		{"blkio", m.setBlkio},
+	} {
+		ok, err := m.hasSubsystem(set.subsystem, requiresSubsystem(set.subsystem, resources))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := set.fn(containerID, resources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *v1Manager) setCPU(containerID string, resources *Resources) error {
+	cpuPath := m.path(containerID, "cpu")
+	quota := "-1"
+	if resources.CPUs > 0 {
+		quota = strconv.Itoa(int(resources.CPUs * cpuPeriod))
+		if err := writeFile(cpuPath, "cpu.cfs_period_us", strconv.Itoa(cpuPeriod)); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(cpuPath, "cpu.cfs_quota_us", quota); err != nil {
+		return err
+	}
+	return writeFile(cpuPath, "cpu.shares", strconv.FormatUint(orDefault(resources.CPUShares, defaultCPUShares), 10))
+}
+
+func (m *v1Manager) setCpuset(containerID string, resources *Resources) error {
+	// 新建的 cpuset cgroup 为空，未指定时沿用根 cgroup 的全部 CPU 和节点，否则无法加入进程
+	cpusetPath := m.path(containerID, "cpuset")
+	if err := writeFile(cpusetPath, "cpuset.cpus", orDefault(resources.CpusetCpus, m.availableCpuset("cpus"))); err != nil {
+		return err
+	}
+	return writeFile(cpusetPath, "cpuset.mems", orDefault(resources.CpusetMems, m.availableCpuset("mems")))
+}
+
+func (m *v1Manager) setPids(containerID string, resources *Resources) error {
+	pidsMax := "max"
+	if resources.PidsLimit > 0 {
+		pidsMax = strconv.FormatInt(resources.PidsLimit, 10)
+	}
+	return writeFile(m.path(containerID, "pids"), "pids.max", pidsMax)
+}
+
+func (m *v1Manager) setBlkio(containerID string, resources *Resources) error {
+	blkioPath := m.path(containerID, "blkio")
+	for file, devices := range map[string][]ThrottleDevice{
+		"blkio.throttle.read_bps_device":  resources.DeviceReadBps,
+		"blkio.throttle.write_bps_device": resources.DeviceWriteBps,
+	} {
+		for _, device := range devices {
+			number, err := device.deviceNumber()
+			if err != nil {
+				return err
+			}
+			if err := writeFile(blkioPath, file, fmt.Sprintf("%s %d", number, device.Rate)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setMemory 设置内存相关限制
+// 内核要求 memory.limit_in_bytes 不大于 memory.memsw.limit_in_bytes，需要按新旧值调整写入顺序
+func (m *v1Manager) setMemory(containerID string, resources *Resources) error {
+	memoryPath := m.path(containerID, "memory")
+	limit := "-1"
+	if resources.Memory > 0 {
+		limit = strconv.FormatUint(resources.Memory, 10)
+	}
+	total := resources.swapLimit()
+	swap := "-1"
+	if total > 0 {
+		swap = strconv.FormatInt(total, 10)
+	}
+
+	// 内核未开启交换分区统计时没有 memsw 文件，只有显式设置 --memory-swap 时报错
+	_, err := os.Stat(filepath.Join(memoryPath, "memory.memsw.limit_in_bytes"))
+	hasSwap := err == nil
+	if !hasSwap && resources.MemorySwap > 0 {
+		return fmt.Errorf("memory swap limit not supported: kernel swap accounting is disabled")
+	}
+	writeLimit := func() error { return writeFile(memoryPath, "memory.limit_in_bytes", limit) }
+	writeSwap := func() error {
+		if !hasSwap {
+			return nil
+		}
+		return writeFile(memoryPath, "memory.memsw.limit_in_bytes", swap)
+	}
+
+	first, second := writeLimit, writeSwap
+	if swapFirst(readUint(filepath.Join(memoryPath, "memory.limit_in_bytes")), total) {
+		first, second = writeSwap, writeLimit
+	}
+	if err := first(); err != nil {
+		return err
+	}
+	if err := second(); err != nil {
+		return err
+	}
+
+	reservation := "-1"
+	if resources.MemoryReservation > 0 {
+		reservation = strconv.FormatUint(resources.MemoryReservation, 10)
+	}
+	if err := writeFile(memoryPath, "memory.soft_limit_in_bytes", reservation); err != nil {
+		return err
+	}
+	oomKillDisable := "0"
+	if resources.OOMKillDisable {
+		oomKillDisable = "1"
+	}
+	return writeFile(memoryPath, "memory.oom_control", oomKillDisable)
+}
+
+// swapFirst 是否先写入 memory.memsw.limit_in_bytes：新的总量（swap 不大于 0 表示不限制）大于当前内存限制时，
+// 先放宽总量再修改内存限制，否则先收紧内存限制，保证写入过程中内存限制始终不大于总量
+func swapFirst(currentLimit uint64, swap int64) bool {
+	return swap <= 0 || currentLimit < uint64(swap)
+}
+
+// setDevices 先拒绝全部设备，再逐条写入允许规则；除允许全部设备外，devices 子系统未挂载时报错
+func (m *v1Manager) setDevices(containerID string, rules []DeviceRule) error {
+	if ok, err := m.hasSubsystem("devices", !slices.Equal(rules, AllowAllDevices)); !ok {
+		return err
+	}
+	dir := m.path(containerID, "devices")
+	if err := writeFile(dir, "devices.deny", "a"); err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := writeFile(dir, "devices.allow", rule.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *v1Manager) setFrozen(containerID string, frozen bool) error {
+	if _, err := m.hasSubsystem("freezer", true); err != nil {
+		return err
+	}
+	freezerPath := m.path(containerID, "freezer")
+	state := freezerThawed
+	if frozen {
+		state = freezerFrozen
+	}
+	return waitFreezer(func() (bool, error) {
+		// 冻结过程中状态为 FREEZING，需要重复写入直到完成
+		if err := writeFile(freezerPath, "freezer.state", state); err != nil {
+			return false, err
+		}
+		current, err := os.ReadFile(filepath.Join(freezerPath, "freezer.state"))
+		if err != nil {
+			return false, fmt.Errorf("read freezer state: %w", err)
+		}
+		return strings.TrimSpace(string(current)) == state, nil
+	})
+}
+
+func (m *v1Manager) stats(containerID string) *Stats {
+	memoryPath := m.path(containerID, "memory")
+	stats := &Stats{
+		CPUUsage: readUint(filepath.Join(m.path(containerID, "cpuacct"), "cpuacct.usage")),
+		Pids:     len(readFields(filepath.Join(m.procsDir(containerID), "tasks"))),
+	}
+
+	usage := readUint(filepath.Join(memoryPath, "memory.usage_in_bytes"))
+	cache := readKeyedUint(filepath.Join(memoryPath, "memory.stat"), "total_inactive_file")
+	stats.MemoryUsage = usage - min(usage, cache)
+	if limit := readUint(filepath.Join(memoryPath, "memory.limit_in_bytes")); limit < memoryUnlimited {
+		stats.MemoryLimit = limit
+	}
+
+	// 每行格式: <major>:<minor> Read|Write|... <bytes>
+	forEachLine(filepath.Join(m.path(containerID, "blkio"), "blkio.throttle.io_service_bytes"), func(fields []string) {
+		if len(fields) != 3 {
+			return
+		}
+		value, _ := strconv.ParseUint(fields[2], 10, 64)
+		switch fields[1] {
+		case "Read":
+			stats.BlockRead += value
+		case "Write":
+			stats.BlockWrite += value
+		}
+	})
+	return stats
+}
+
+func (m *v1Manager) pids(containerID string) ([]int, error) {
+	return readPids(m.procsDir(containerID))
+}
+
+// oomKillCount 读取 memory.oom_control 中的 oom_kill 计数
+func (m *v1Manager) oomKillCount(containerID string) int {
+	return int(readKeyedUint(filepath.Join(m.path(containerID, "memory"), "memory.oom_control"), "oom_kill"))
+}
+
+func (m *v1Manager) remove(containerID string) {
+	for _, dir := range m.dirs(containerID) {
+		os.RemoveAll(dir)
+	}
+}
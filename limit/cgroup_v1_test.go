@@ -0,0 +1,217 @@
+package limit
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestV1Manager 在临时目录中模拟 cgroup v1，只挂载 subsystems 中的层级
+func newTestV1Manager(t *testing.T, subsystems ...string) *v1Manager {
+	t.Helper()
+	root := t.TempDir()
+	for _, subsystem := range subsystems {
+		if err := os.MkdirAll(filepath.Join(root, subsystem), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if slices.Contains(subsystems, "cpuset") {
+		writeTestFile(t, filepath.Join(root, "cpuset"), "cpuset.cpus", "0-3\n")
+		writeTestFile(t, filepath.Join(root, "cpuset"), "cpuset.mems", "0\n")
+	}
+	m, ok := newManager(root).(*v1Manager)
+	if !ok {
+		t.Fatal("newManager did not select cgroup v1")
+	}
+	return m
+}
+
+func TestV1Apply(t *testing.T) {
+	m := newTestV1Manager(t, v1Subsystems...)
+	// 开启交换分区统计的内核才有 memsw 文件
+	writeTestFile(t, m.path(testContainerID, "memory"), "memory.memsw.limit_in_bytes", "-1")
+
+	resources := &Resources{
+		CPUs:              1.5,
+		CPUShares:         512,
+		CpusetCpus:        "1-2",
+		Memory:            64 << 20,
+		MemorySwap:        128 << 20,
+		MemoryReservation: 32 << 20,
+		OOMKillDisable:    true,
+		PidsLimit:         100,
+	}
+	if err := m.apply(testContainerID, 42, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFiles(t, m.path(testContainerID, "cpu"), map[string]string{
+		"cpu.cfs_period_us": "100000",
+		"cpu.cfs_quota_us":  "150000",
+		"cpu.shares":        "512",
+	})
+	assertFiles(t, m.path(testContainerID, "cpuset"), map[string]string{
+		"cpuset.cpus": "1-2",
+		"cpuset.mems": "0", // 未指定时沿用根 cgroup
+	})
+	assertFiles(t, m.path(testContainerID, "memory"), map[string]string{
+		"memory.limit_in_bytes":       strconv.Itoa(64 << 20),
+		"memory.memsw.limit_in_bytes": strconv.Itoa(128 << 20),
+		"memory.soft_limit_in_bytes":  strconv.Itoa(32 << 20),
+		"memory.oom_control":          "1",
+	})
+	assertFiles(t, m.path(testContainerID, "pids"), map[string]string{"pids.max": "100"})
+	assertFiles(t, m.path(testContainerID, "freezer"), map[string]string{"freezer.state": freezerThawed})
+	for _, dir := range m.dirs(testContainerID) {
+		assertFiles(t, dir, map[string]string{"cgroup.procs": "42"})
+	}
+	if got := len(m.dirs(testContainerID)); got != len(v1Subsystems) {
+		t.Errorf("len(dirs) = %d, want %d", got, len(v1Subsystems))
+	}
+}
+
+func TestV1ApplyDefaults(t *testing.T) {
+	m := newTestV1Manager(t, v1Subsystems...)
+	// 重新启动的容器复用原有 cgroup，上一次的限制需要恢复为默认值
+	writeTestFile(t, m.path(testContainerID, "cpu"), "cpu.cfs_quota_us", "50000")
+	writeTestFile(t, m.path(testContainerID, "freezer"), "freezer.state", freezerFrozen)
+
+	if err := m.apply(testContainerID, 42, &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, m.path(testContainerID, "cpu"), map[string]string{
+		"cpu.cfs_quota_us": "-1",
+		"cpu.shares":       strconv.Itoa(defaultCPUShares),
+	})
+	assertFiles(t, m.path(testContainerID, "cpuset"), map[string]string{
+		"cpuset.cpus": "0-3",
+		"cpuset.mems": "0",
+	})
+	assertFiles(t, m.path(testContainerID, "memory"), map[string]string{
+		"memory.limit_in_bytes":      "-1",
+		"memory.soft_limit_in_bytes": "-1",
+		"memory.oom_control":         "0",
+	})
+	assertFiles(t, m.path(testContainerID, "pids"), map[string]string{"pids.max": "max"})
+	assertFiles(t, m.path(testContainerID, "freezer"), map[string]string{"freezer.state": freezerThawed})
+}
+
+func TestV1OptionalSubsystems(t *testing.T) {
+	// 主机上没有挂载 cpuset、blkio 和 pids
+	m := newTestV1Manager(t, "cpu", "cpuacct", "memory", "freezer", "devices")
+
+	if err := m.apply(testContainerID, 42, &Resources{Memory: 64 << 20}); err != nil {
+		t.Fatalf("apply without limits on missing subsystems: %v", err)
+	}
+	for _, subsystem := range []string{"cpuset", "blkio", "pids"} {
+		if _, err := os.Stat(filepath.Join(m.root, subsystem)); err == nil {
+			t.Errorf("%s cgroup created", subsystem)
+		}
+	}
+	if got := len(m.dirs(testContainerID)); got != 5 {
+		t.Errorf("len(dirs) = %d, want 5", got)
+	}
+
+	// 设置了未挂载子系统的限制时报错
+	for _, resources := range []*Resources{
+		{PidsLimit: 10},
+		{CpusetCpus: "0"},
+	} {
+		err := m.apply(testContainerID, 42, resources)
+		if err == nil || !strings.Contains(err.Error(), "not mounted") {
+			t.Errorf("apply(%+v) error = %v, want not mounted", resources, err)
+		}
+		if err := m.setResources(testContainerID, resources); err == nil {
+			t.Errorf("setResources(%+v) succeeded, want error", resources)
+		}
+	}
+}
+
+func TestV1DefaultSwap(t *testing.T) {
+	m := newTestV1Manager(t, v1Subsystems...)
+	memoryPath := m.path(testContainerID, "memory")
+	writeTestFile(t, memoryPath, "memory.memsw.limit_in_bytes", "-1")
+
+	// 只设置 --memory 时交换分区与内存相同，与 v2 一致
+	if err := m.apply(testContainerID, 42, &Resources{Memory: 64 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, memoryPath, map[string]string{
+		"memory.limit_in_bytes":       strconv.Itoa(64 << 20),
+		"memory.memsw.limit_in_bytes": strconv.Itoa(128 << 20),
+	})
+
+	if err := m.setMemory(testContainerID, &Resources{Memory: 64 << 20, MemorySwap: -1}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, memoryPath, map[string]string{"memory.memsw.limit_in_bytes": "-1"})
+}
+
+func TestV1SetMemoryWithoutSwapAccounting(t *testing.T) {
+	m := newTestV1Manager(t, v1Subsystems...)
+	if err := m.apply(testContainerID, 42, &Resources{Memory: 64 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(m.path(testContainerID, "memory"), "memory.memsw.limit_in_bytes")); err == nil {
+		t.Error("memsw written without swap accounting")
+	}
+	if err := m.setMemory(testContainerID, &Resources{Memory: 64 << 20, MemorySwap: 128 << 20}); err == nil {
+		t.Error("setMemory with --memory-swap succeeded without swap accounting, want error")
+	}
+}
+
+func TestSwapFirst(t *testing.T) {
+	tests := []struct {
+		name         string
+		currentLimit uint64
+		swap         int64
+		want         bool
+	}{
+		// 放宽：新的总量大于当前内存限制，先写总量
+		{name: "raise", currentLimit: 64 << 20, swap: 256 << 20, want: true},
+		{name: "unlimited swap", currentLimit: 64 << 20, swap: -1, want: true},
+		{name: "from unlimited", currentLimit: memoryUnlimited, swap: 0, want: true},
+		// 收紧：新的总量不大于当前内存限制，先写内存限制
+		{name: "lower", currentLimit: 256 << 20, swap: 128 << 20, want: false},
+		{name: "lower from unlimited", currentLimit: memoryUnlimited, swap: 128 << 20, want: false},
+		{name: "equal", currentLimit: 128 << 20, swap: 128 << 20, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := swapFirst(tt.currentLimit, tt.swap); got != tt.want {
+				t.Errorf("swapFirst(%d, %d) = %v, want %v", tt.currentLimit, tt.swap, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestV1SetDevices(t *testing.T) {
+	m := newTestV1Manager(t, v1Subsystems...)
+	if err := m.apply(testContainerID, 42, &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	rules := []DeviceRule{
+		{Type: 'c', Major: DeviceWildcard, Minor: DeviceWildcard, Access: "m"},
+		{Type: 'c', Major: 1, Minor: 3, Access: "rwm"},
+	}
+	if err := m.setDevices(testContainerID, rules); err != nil {
+		t.Fatal(err)
+	}
+	// 每次写入 devices.allow 追加一条规则，临时目录中只保留最后一条
+	assertFiles(t, m.path(testContainerID, "devices"), map[string]string{
+		"devices.deny":  "a",
+		"devices.allow": "c 1:3 rwm",
+	})
+
+	// 设备访问控制不能被跳过，只有允许全部设备时不需要 devices 子系统
+	m = newTestV1Manager(t, "cpu", "memory", "freezer")
+	if err := m.setDevices(testContainerID, rules); err == nil {
+		t.Error("setDevices without devices subsystem succeeded, want error")
+	}
+	if err := m.setDevices(testContainerID, AllowAllDevices); err != nil {
+		t.Errorf("setDevices(AllowAllDevices) without devices subsystem: %v", err)
+	}
+}
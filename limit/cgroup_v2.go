@@ -0,0 +1,245 @@
+package limit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// v2ParentName cgroup v2 下 ducker 容器的父 cgroup
+	v2ParentName = "ducker"
+
+	// v2Controllers 需要在父 cgroup 中启用的控制器
+	v2Controllers = "cpuset cpu memory io pids"
+)
+
+// v2Manager cgroup v2 后端，所有控制器共用 <root>/ducker/<容器 ID> 一个 cgroup
+type v2Manager struct {
+	root string
+}
+
+func (m *v2Manager) version() int {
+	return 2
+}
+
+func (m *v2Manager) path(containerID, _ string) string {
+	return filepath.Join(m.root, v2ParentName, containerID)
+}
+
+// enableControllers 创建父 cgroup 并逐级在 cgroup.subtree_control 中启用控制器
+// 只启用根 cgroup 中可用且尚未启用的控制器，freezer 为 v2 核心功能无需启用
+func (m *v2Manager) enableControllers() error {
+	parent := filepath.Join(m.root, v2ParentName)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("create cgroup %s: %w", parent, err)
+	}
+
+	available := readFields(filepath.Join(m.root, "cgroup.controllers"))
+	for _, dir := range []string{m.root, parent} {
+		enabled := readFields(filepath.Join(dir, "cgroup.subtree_control"))
+		var enable []string
+		for _, controller := range strings.Fields(v2Controllers) {
+			if slices.Contains(available, controller) && !slices.Contains(enabled, controller) {
+				enable = append(enable, "+"+controller)
+			}
+		}
+		if len(enable) == 0 {
+			continue
+		}
+		if err := writeFile(dir, "cgroup.subtree_control", strings.Join(enable, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *v2Manager) availableCpuset(kind string) string {
+	return readTrimmed(m.root, "cpuset."+kind+".effective")
+}
+
+func (m *v2Manager) apply(containerID string, pid int, resources *Resources) error {
+	if err := m.enableControllers(); err != nil {
+		return fmt.Errorf("enable controllers: %w", err)
+	}
+
+	cgroupPath := m.path(containerID, "")
+	if err := os.MkdirAll(cgroupPath, 0755); err != nil {
+		return fmt.Errorf("create cgroup: %w", err)
+	}
+	if err := m.setResources(containerID, resources); err != nil {
+		return err
+	}
+	if err := writeFile(cgroupPath, "cgroup.freeze", "0"); err != nil {
+		return err
+	}
+	return join(m.dirs(containerID), pid)
+}
+
+func (m *v2Manager) dirs(containerID string) []string {
+	return []string{m.path(containerID, "")}
+}
+
+// setResources 写入资源限制，重新启动的容器复用原有 cgroup，未设置的限制需要恢复为默认值
+func (m *v2Manager) setResources(containerID string, resources *Resources) error {
+	cgroupPath := m.path(containerID, "")
+	set := func(file, value string, required bool) error {
+		return m.setLimit(cgroupPath, file, value, required)
+	}
+
+	cpuMax := "max " + strconv.Itoa(cpuPeriod)
+	if resources.CPUs > 0 {
+		cpuMax = fmt.Sprintf("%d %d", int(resources.CPUs*cpuPeriod), cpuPeriod)
+	}
+	if err := set("cpu.max", cpuMax, resources.CPUs > 0); err != nil {
+		return err
+	}
+	if err := set("cpu.weight", strconv.FormatUint(sharesToWeight(resources.CPUShares), 10), resources.CPUShares > 0); err != nil {
+		return err
+	}
+	// 写入空值表示沿用父 cgroup 的配置
+	if err := set("cpuset.cpus", resources.CpusetCpus, resources.CpusetCpus != ""); err != nil {
+		return err
+	}
+	if err := set("cpuset.mems", resources.CpusetMems, resources.CpusetMems != ""); err != nil {
+		return err
+	}
+
+	memoryMax := "max"
+	if resources.Memory > 0 {
+		memoryMax = strconv.FormatUint(resources.Memory, 10)
+	}
+	if err := set("memory.max", memoryMax, resources.Memory > 0); err != nil {
+		return err
+	}
+	// v2 中交换分区单独限制，不包含内存
+	swapMax := "max"
+	if total := resources.swapLimit(); total > 0 {
+		swapMax = strconv.FormatUint(uint64(total)-resources.Memory, 10)
+	}
+	if err := set("memory.swap.max", swapMax, resources.MemorySwap > 0); err != nil {
+		return err
+	}
+	if err := set("memory.low", strconv.FormatUint(resources.MemoryReservation, 10), resources.MemoryReservation > 0); err != nil {
+		return err
+	}
+
+	pidsMax := "max"
+	if resources.PidsLimit > 0 {
+		pidsMax = strconv.FormatInt(resources.PidsLimit, 10)
+	}
+	if err := set("pids.max", pidsMax, resources.PidsLimit > 0); err != nil {
+		return err
+	}
+
+	for key, devices := range map[string][]ThrottleDevice{
+		"rbps": resources.DeviceReadBps,
+		"wbps": resources.DeviceWriteBps,
+	} {
+		for _, device := range devices {
+			number, err := device.deviceNumber()
+			if err != nil {
+				return err
+			}
+			if err := set("io.max", fmt.Sprintf("%s %s=%d", number, key, device.Rate), true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sharesToWeight 将 v1 的 cpu.shares（2-262144）换算为 v2 的 cpu.weight（1-10000），未设置时为默认值 100
+func sharesToWeight(shares uint64) uint64 {
+	if shares == 0 {
+		return 100
+	}
+	return 1 + (shares-minCPUShares)*9999/(maxCPUShares-minCPUShares)
+}
+
+// setLimit 写入限制值，未设置限制且控制器不可用（控制文件不存在）时跳过
+func (m *v2Manager) setLimit(dir, file, value string, required bool) error {
+	if _, err := os.Stat(filepath.Join(dir, file)); err != nil && !required {
+		return nil
+	}
+	return writeFile(dir, file, value)
+}
+
+// setDevices cgroup v2 没有 devices 控制器，通过挂在容器 cgroup 上的 eBPF 程序过滤设备访问
+func (m *v2Manager) setDevices(containerID string, rules []DeviceRule) error {
+	prog, err := compileDeviceFilter(rules)
+	if err != nil {
+		return err
+	}
+	progFd, err := loadDeviceFilter(prog)
+	if err != nil {
+		return err
+	}
+	// 挂载后程序由 cgroup 持有
+	defer unix.Close(progFd)
+	return attachDeviceFilter(m.path(containerID, ""), progFd)
+}
+
+func (m *v2Manager) setFrozen(containerID string, frozen bool) error {
+	cgroupPath := m.path(containerID, "")
+	value := "0"
+	if frozen {
+		value = "1"
+	}
+	if err := writeFile(cgroupPath, "cgroup.freeze", value); err != nil {
+		return err
+	}
+	return waitFreezer(func() (bool, error) {
+		events, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.events"))
+		if err != nil {
+			return false, fmt.Errorf("read cgroup.events: %w", err)
+		}
+		return strings.Contains(string(events), "frozen "+value), nil
+	})
+}
+
+func (m *v2Manager) stats(containerID string) *Stats {
+	cgroupPath := m.path(containerID, "")
+	stats := &Stats{
+		CPUUsage: readKeyedUint(filepath.Join(cgroupPath, "cpu.stat"), "usage_usec") * 1000,
+		Pids:     len(readFields(filepath.Join(cgroupPath, "cgroup.threads"))),
+	}
+
+	usage := readUint(filepath.Join(cgroupPath, "memory.current"))
+	cache := readKeyedUint(filepath.Join(cgroupPath, "memory.stat"), "inactive_file")
+	stats.MemoryUsage = usage - min(usage, cache)
+	stats.MemoryLimit = readUint(filepath.Join(cgroupPath, "memory.max")) // "max" 解析失败即为 0
+
+	// 每行格式: <major>:<minor> rbytes=N wbytes=N rios=N ...
+	forEachLine(filepath.Join(cgroupPath, "io.stat"), func(fields []string) {
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			n, _ := strconv.ParseUint(value, 10, 64)
+			switch key {
+			case "rbytes":
+				stats.BlockRead += n
+			case "wbytes":
+				stats.BlockWrite += n
+			}
+		}
+	})
+	return stats
+}
+
+func (m *v2Manager) pids(containerID string) ([]int, error) {
+	return readPids(m.path(containerID, ""))
+}
+
+// oomKillCount 读取 memory.events 中的 oom_kill 计数
+func (m *v2Manager) oomKillCount(containerID string) int {
+	return int(readKeyedUint(filepath.Join(m.path(containerID, ""), "memory.events"), "oom_kill"))
+}
+
+func (m *v2Manager) remove(containerID string) {
+	os.Remove(m.path(containerID, ""))
+}
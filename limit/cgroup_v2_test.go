@@ -0,0 +1,157 @@
+package limit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// newTestV2Manager 在临时目录中模拟 cgroup v2 unified 层级
+func newTestV2Manager(t *testing.T) *v2Manager {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFile(t, root, "cgroup.controllers", "cpuset cpu io memory hugetlb pids rdma\n")
+	writeTestFile(t, root, "cgroup.subtree_control", "cpu\n")
+	writeTestFile(t, root, "cpuset.cpus.effective", "0-3\n")
+	m, ok := newManager(root).(*v2Manager)
+	if !ok {
+		t.Fatal("newManager did not select cgroup v2")
+	}
+	return m
+}
+
+func TestV2Apply(t *testing.T) {
+	m := newTestV2Manager(t)
+	resources := &Resources{
+		CPUs:       0.5,
+		CPUShares:  1024,
+		CpusetCpus: "1",
+		Memory:     64 << 20,
+		MemorySwap: 192 << 20,
+		PidsLimit:  10,
+	}
+	if err := m.apply(testContainerID, 42, resources); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只启用尚未启用的控制器
+	assertFiles(t, m.root, map[string]string{"cgroup.subtree_control": "+cpuset +memory +io +pids"})
+	assertFiles(t, filepath.Join(m.root, v2ParentName), map[string]string{"cgroup.subtree_control": "+cpuset +cpu +memory +io +pids"})
+	assertFiles(t, m.path(testContainerID, ""), map[string]string{
+		"cpu.max":         "50000 100000",
+		"cpu.weight":      strconv.FormatUint(sharesToWeight(1024), 10),
+		"cpuset.cpus":     "1",
+		"memory.max":      strconv.Itoa(64 << 20),
+		"memory.swap.max": strconv.Itoa(128 << 20), // 交换分区不包含内存
+		"pids.max":        "10",
+		"cgroup.freeze":   "0",
+		"cgroup.procs":    "42",
+	})
+	// 未设置且控制文件不存在的限制跳过
+	for _, file := range []string{"cpuset.mems", "memory.low"} {
+		if _, err := os.Stat(filepath.Join(m.path(testContainerID, ""), file)); err == nil {
+			t.Errorf("%s written without a limit", file)
+		}
+	}
+}
+
+func TestV2ApplyDefaults(t *testing.T) {
+	m := newTestV2Manager(t)
+	// 重新启动的容器复用原有 cgroup，上一次的限制需要恢复为默认值
+	dir := m.path(testContainerID, "")
+	for file, value := range map[string]string{
+		"cpu.max":         "50000 100000",
+		"cpu.weight":      "39",
+		"memory.max":      "67108864",
+		"memory.swap.max": "0",
+		"pids.max":        "10",
+		"cgroup.freeze":   "1",
+	} {
+		writeTestFile(t, dir, file, value)
+	}
+
+	if err := m.apply(testContainerID, 42, &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, dir, map[string]string{
+		"cpu.max":         "max 100000",
+		"cpu.weight":      "100",
+		"memory.max":      "max",
+		"memory.swap.max": "max",
+		"pids.max":        "max",
+		"cgroup.freeze":   "0",
+	})
+}
+
+func TestV2DefaultSwap(t *testing.T) {
+	m := newTestV2Manager(t)
+	dir := m.path(testContainerID, "")
+	writeTestFile(t, dir, "memory.swap.max", "max")
+
+	// 只设置 --memory 时交换分区与内存相同，与 v1 一致
+	if err := m.apply(testContainerID, 42, &Resources{Memory: 64 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, dir, map[string]string{"memory.swap.max": strconv.Itoa(64 << 20)})
+
+	if err := m.setResources(testContainerID, &Resources{Memory: 64 << 20, MemorySwap: -1}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, dir, map[string]string{"memory.swap.max": "max"})
+}
+
+func TestV2IoMax(t *testing.T) {
+	device := findBlockDevice(t)
+	m := newTestV2Manager(t)
+	var st unix.Stat_t
+	if err := unix.Stat(device, &st); err != nil {
+		t.Fatal(err)
+	}
+
+	resources := &Resources{DeviceWriteBps: []ThrottleDevice{{Path: device, Rate: 1 << 20}}}
+	if err := m.apply(testContainerID, 42, resources); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%d:%d wbps=%d", unix.Major(st.Rdev), unix.Minor(st.Rdev), 1<<20)
+	assertFiles(t, m.path(testContainerID, ""), map[string]string{"io.max": want})
+
+	// 不是块设备
+	resources = &Resources{DeviceReadBps: []ThrottleDevice{{Path: "/dev/null", Rate: 1}}}
+	if err := m.setResources(testContainerID, resources); err == nil {
+		t.Error("setResources with /dev/null succeeded, want error")
+	}
+}
+
+// findBlockDevice 返回主机上的一个块设备，没有时跳过测试
+func findBlockDevice(t *testing.T) string {
+	t.Helper()
+	entries, _ := os.ReadDir("/dev")
+	for _, entry := range entries {
+		if entry.Type()&os.ModeDevice != 0 && entry.Type()&os.ModeCharDevice == 0 {
+			return filepath.Join("/dev", entry.Name())
+		}
+	}
+	t.Skip("no block device available")
+	return ""
+}
+
+func TestSharesToWeight(t *testing.T) {
+	tests := []struct {
+		shares uint64
+		want   uint64
+	}{
+		{shares: 0, want: 100},
+		{shares: minCPUShares, want: 1},
+		{shares: maxCPUShares, want: 10000},
+		{shares: defaultCPUShares, want: 39},
+	}
+	for _, tt := range tests {
+		if got := sharesToWeight(tt.shares); got != tt.want {
+			t.Errorf("sharesToWeight(%d) = %d, want %d", tt.shares, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package limit
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// DeviceWildcard 设备规则中的主次设备号为该值时匹配任意设备号
+const DeviceWildcard = -1
+
+// DeviceRule devices cgroup 中的一条允许规则，未命中任何规则的设备访问被拒绝
+type DeviceRule struct {
+	Type   byte   // c 字符设备、b 块设备、a 全部设备
+	Major  int64  // 主设备号，DeviceWildcard 表示任意
+	Minor  int64  // 次设备号，DeviceWildcard 表示任意
+	Access string // r 读、w 写、m 创建设备节点的组合
+}
+
+// String cgroup v1 devices.allow 的格式，如 c 1:3 rwm
+func (r DeviceRule) String() string {
+	number := func(n int64) string {
+		if n == DeviceWildcard {
+			return "*"
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprintf("%c %s:%s %s", r.Type, number(r.Major), number(r.Minor), r.Access)
+}
+
+// AllowAllDevices 特权容器可以访问全部设备
+var AllowAllDevices = []DeviceRule{{Type: 'a', Major: DeviceWildcard, Minor: DeviceWildcard, Access: "rwm"}}
+
+// DefaultDeviceRules 容器默认可以访问的设备：/dev 中的标准设备和伪终端，允许创建任意设备节点但不能访问
+var DefaultDeviceRules = []DeviceRule{
+	{Type: 'c', Major: DeviceWildcard, Minor: DeviceWildcard, Access: "m"},
+	{Type: 'b', Major: DeviceWildcard, Minor: DeviceWildcard, Access: "m"},
+	{Type: 'c', Major: 1, Minor: 3, Access: "rwm"},                // null
+	{Type: 'c', Major: 1, Minor: 5, Access: "rwm"},                // zero
+	{Type: 'c', Major: 1, Minor: 7, Access: "rwm"},                // full
+	{Type: 'c', Major: 1, Minor: 8, Access: "rwm"},                // random
+	{Type: 'c', Major: 1, Minor: 9, Access: "rwm"},                // urandom
+	{Type: 'c', Major: 5, Minor: 0, Access: "rwm"},                // tty
+	{Type: 'c', Major: 5, Minor: 2, Access: "rwm"},                // ptmx
+	{Type: 'c', Major: 136, Minor: DeviceWildcard, Access: "rwm"}, // pts
+}
+
+// SetDevices 只允许容器访问 rules 中的设备，需要在容器进程加入 cgroup 后、开始运行前调用
+func SetDevices(containerID string, rules []DeviceRule) error {
+	return current().setDevices(containerID, rules)
+}
+
+// eBPF 设备过滤程序的上下文 bpf_cgroup_dev_ctx 中各字段的偏移：
+// access_type 低 16 位为设备类型、高 16 位为访问方式
+const (
+	devCtxAccessType = 0
+	devCtxMajor      = 4
+	devCtxMinor      = 8
+)
+
+// bpfInsn eBPF 指令
+type bpfInsn struct {
+	code uint8
+	regs uint8 // 低 4 位为目标寄存器，高 4 位为源寄存器
+	off  int16
+	imm  int32
+}
+
+// eBPF 寄存器：r0 为返回值，r1 为上下文指针，r2-r5 依次保存设备类型、访问方式、主设备号、次设备号
+const (
+	r0 = iota
+	r1
+	r2
+	r3
+	r4
+	r5
+)
+
+func ldxW(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{code: unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W, regs: src<<4 | dst, off: off}
+}
+
+func alu32Imm(op uint8, dst uint8, imm int32) bpfInsn {
+	return bpfInsn{code: unix.BPF_ALU | op | unix.BPF_K, regs: dst, imm: imm}
+}
+
+func mov64Reg(dst, src uint8) bpfInsn {
+	return bpfInsn{code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X, regs: src<<4 | dst}
+}
+
+func mov64Imm(dst uint8, imm int32) bpfInsn {
+	return bpfInsn{code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K, regs: dst, imm: imm}
+}
+
+// jneImm 不等于 imm 时跳过 off 条指令
+func jneImm(dst uint8, imm int32, off int16) bpfInsn {
+	return bpfInsn{code: unix.BPF_JMP | unix.BPF_JNE | unix.BPF_K, regs: dst, off: off, imm: imm}
+}
+
+func jneReg(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{code: unix.BPF_JMP | unix.BPF_JNE | unix.BPF_X, regs: src<<4 | dst, off: off}
+}
+
+func exit() bpfInsn {
+	return bpfInsn{code: unix.BPF_JMP | unix.BPF_EXIT}
+}
+
+// compileDeviceFilter 将允许规则编译为 cgroup v2 的 eBPF 设备过滤程序：命中任意规则时返回 1 允许访问，否则返回 0
+func compileDeviceFilter(rules []DeviceRule) ([]bpfInsn, error) {
+	prog := []bpfInsn{
+		ldxW(r2, r1, devCtxAccessType),
+		alu32Imm(unix.BPF_AND, r2, 0xffff),
+		ldxW(r3, r1, devCtxAccessType),
+		alu32Imm(unix.BPF_RSH, r3, 16),
+		ldxW(r4, r1, devCtxMajor),
+		ldxW(r5, r1, devCtxMinor),
+	}
+	for _, rule := range rules {
+		block, err := deviceRuleBlock(rule)
+		if err != nil {
+			return nil, err
+		}
+		prog = append(prog, block...)
+	}
+	return append(prog, mov64Imm(r0, 0), exit()), nil
+}
+
+// deviceRuleBlock 匹配单条规则的指令块，任一条件不满足时跳到块的末尾继续匹配下一条规则
+func deviceRuleBlock(rule DeviceRule) ([]bpfInsn, error) {
+	var access int32
+	for _, c := range rule.Access {
+		switch c {
+		case 'r':
+			access |= unix.BPF_DEVCG_ACC_READ
+		case 'w':
+			access |= unix.BPF_DEVCG_ACC_WRITE
+		case 'm':
+			access |= unix.BPF_DEVCG_ACC_MKNOD
+		default:
+			return nil, fmt.Errorf("invalid device access %q", rule.Access)
+		}
+	}
+
+	// 跳转偏移先记为 -1，生成整个块后再指向块的末尾
+	var block []bpfInsn
+	switch rule.Type {
+	case 'c':
+		block = append(block, jneImm(r2, unix.BPF_DEVCG_DEV_CHAR, -1))
+	case 'b':
+		block = append(block, jneImm(r2, unix.BPF_DEVCG_DEV_BLOCK, -1))
+	case 'a':
+	default:
+		return nil, fmt.Errorf("invalid device type %q", rule.Type)
+	}
+	allAccess := int32(unix.BPF_DEVCG_ACC_READ | unix.BPF_DEVCG_ACC_WRITE | unix.BPF_DEVCG_ACC_MKNOD)
+	if access != allAccess {
+		// 请求的访问方式必须都在规则允许的范围内
+		block = append(block,
+			mov64Reg(r1, r3),
+			alu32Imm(unix.BPF_AND, r1, access),
+			jneReg(r1, r3, -1),
+		)
+	}
+	if rule.Major != DeviceWildcard {
+		block = append(block, jneImm(r4, int32(rule.Major), -1))
+	}
+	if rule.Minor != DeviceWildcard {
+		block = append(block, jneImm(r5, int32(rule.Minor), -1))
+	}
+	block = append(block, mov64Imm(r0, 1), exit())
+
+	for i := range block {
+		if block[i].off == -1 {
+			block[i].off = int16(len(block) - i - 1)
+		}
+	}
+	return block, nil
+}
+
+// loadDeviceFilter 加载 eBPF 设备过滤程序，返回程序的文件描述符
+func loadDeviceFilter(prog []bpfInsn) (int, error) {
+	license := []byte("GPL\x00")
+	attr := struct {
+		progType uint32
+		insnCnt  uint32
+		insns    uint64
+		license  uint64
+		logLevel uint32
+		logSize  uint32
+		logBuf   uint64
+	}{
+		progType: unix.BPF_PROG_TYPE_CGROUP_DEVICE,
+		insnCnt:  uint32(len(prog)),
+		insns:    uint64(uintptr(unsafe.Pointer(&prog[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(prog)
+	runtime.KeepAlive(license)
+	if errno != 0 {
+		return -1, fmt.Errorf("load device filter: %w", errno)
+	}
+	return int(fd), nil
+}
+
+// attachDeviceFilter 将设备过滤程序挂到 cgroup 上，不允许多个程序时新程序替换已有的程序
+func attachDeviceFilter(cgroupPath string, progFd int) error {
+	dirFd, err := unix.Open(cgroupPath, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open cgroup: %w", err)
+	}
+	defer unix.Close(dirFd)
+
+	attr := struct {
+		targetFd    uint32
+		attachBpfFd uint32
+		attachType  uint32
+		attachFlags uint32
+	}{
+		targetFd:    uint32(dirFd),
+		attachBpfFd: uint32(progFd),
+		attachType:  unix.BPF_CGROUP_DEVICE,
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_ATTACH, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr)); errno != 0 {
+		return fmt.Errorf("attach device filter: %w", errno)
+	}
+	return nil
+}
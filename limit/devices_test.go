@@ -0,0 +1,193 @@
+package limit
+
+import (
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runDeviceFilter 解释执行设备过滤程序中用到的 eBPF 指令，返回 r0
+func runDeviceFilter(t *testing.T, prog []bpfInsn, devType, access uint32, major, minor uint32) uint64 {
+	t.Helper()
+	ctx := map[int16]uint32{
+		devCtxAccessType: access<<16 | devType,
+		devCtxMajor:      major,
+		devCtxMinor:      minor,
+	}
+	var regs [11]uint64
+	for pc := 0; pc < len(prog); pc++ {
+		insn := prog[pc]
+		dst, src := insn.regs&0xf, insn.regs>>4
+		switch insn.code {
+		case unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W:
+			if src != r1 {
+				t.Fatalf("pc %d: load from r%d, want context r1", pc, src)
+			}
+			regs[dst] = uint64(ctx[insn.off])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			regs[dst] = uint64(uint32(regs[dst]) & uint32(insn.imm))
+		case unix.BPF_ALU | unix.BPF_RSH | unix.BPF_K:
+			regs[dst] = uint64(uint32(regs[dst]) >> uint32(insn.imm))
+		case unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X:
+			regs[dst] = regs[src]
+		case unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K:
+			regs[dst] = uint64(int64(insn.imm))
+		case unix.BPF_JMP | unix.BPF_JNE | unix.BPF_K:
+			if regs[dst] != uint64(int64(insn.imm)) {
+				pc += int(insn.off)
+			}
+		case unix.BPF_JMP | unix.BPF_JNE | unix.BPF_X:
+			if regs[dst] != regs[src] {
+				pc += int(insn.off)
+			}
+		case unix.BPF_JMP | unix.BPF_EXIT:
+			return regs[r0]
+		default:
+			t.Fatalf("pc %d: unexpected instruction %#x", pc, insn.code)
+		}
+	}
+	t.Fatal("program ran off the end")
+	return 0
+}
+
+func TestDeviceRuleBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     DeviceRule
+		wantLen  int
+		wantJmps []int16 // 各条件跳转的偏移
+	}{
+		// rwm 不检查访问方式：类型、主设备号、次设备号
+		{name: "rwm", rule: DeviceRule{Type: 'c', Major: 1, Minor: 3, Access: "rwm"}, wantLen: 5, wantJmps: []int16{4, 3, 2}},
+		{name: "access order", rule: DeviceRule{Type: 'b', Major: 8, Minor: 0, Access: "mwr"}, wantLen: 5, wantJmps: []int16{4, 3, 2}},
+		// 类型、访问方式、主设备号、次设备号
+		{name: "rw", rule: DeviceRule{Type: 'c', Major: 1, Minor: 3, Access: "rw"}, wantLen: 8, wantJmps: []int16{7, 4, 3, 2}},
+		{name: "wildcard minor", rule: DeviceRule{Type: 'c', Major: 136, Minor: DeviceWildcard, Access: "r"}, wantLen: 7, wantJmps: []int16{6, 3, 2}},
+		{name: "wildcard", rule: DeviceRule{Type: 'b', Major: DeviceWildcard, Minor: DeviceWildcard, Access: "m"}, wantLen: 6, wantJmps: []int16{5, 2}},
+		{name: "all devices", rule: AllowAllDevices[0], wantLen: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := deviceRuleBlock(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(block) != tt.wantLen {
+				t.Fatalf("len(block) = %d, want %d", len(block), tt.wantLen)
+			}
+			var jmps []int16
+			for i, insn := range block {
+				if insn.code&0x07 != unix.BPF_JMP || insn.code == unix.BPF_JMP|unix.BPF_EXIT {
+					continue
+				}
+				jmps = append(jmps, insn.off)
+				// 条件不满足时跳到块的末尾，即下一条规则的第一条指令
+				if target := i + 1 + int(insn.off); target != len(block) {
+					t.Errorf("jump at %d targets %d, want %d", i, target, len(block))
+				}
+			}
+			if len(jmps) != len(tt.wantJmps) {
+				t.Fatalf("jumps = %v, want %v", jmps, tt.wantJmps)
+			}
+			for i := range jmps {
+				if jmps[i] != tt.wantJmps[i] {
+					t.Errorf("jumps = %v, want %v", jmps, tt.wantJmps)
+					break
+				}
+			}
+			// 规则允许全部访问方式时不生成访问方式的检查
+			hasAccessCheck := slices.Contains(block, mov64Reg(r1, r3))
+			if wantAccessCheck := len(tt.rule.Access) < 3; hasAccessCheck != wantAccessCheck {
+				t.Errorf("access check = %v, want %v", hasAccessCheck, wantAccessCheck)
+			}
+			last := block[len(block)-2:]
+			if last[0] != mov64Imm(r0, 1) || last[1] != exit() {
+				t.Errorf("block does not end with return 1: %+v", last)
+			}
+		})
+	}
+}
+
+func TestDeviceRuleBlockErrors(t *testing.T) {
+	for _, rule := range []DeviceRule{
+		{Type: 'c', Major: 1, Minor: 3, Access: "rx"},
+		{Type: 'x', Major: 1, Minor: 3, Access: "rwm"},
+	} {
+		if _, err := deviceRuleBlock(rule); err == nil {
+			t.Errorf("deviceRuleBlock(%v) succeeded, want error", rule)
+		}
+		if _, err := compileDeviceFilter([]DeviceRule{rule}); err == nil {
+			t.Errorf("compileDeviceFilter(%v) succeeded, want error", rule)
+		}
+	}
+}
+
+func TestCompileDeviceFilter(t *testing.T) {
+	const (
+		char  = unix.BPF_DEVCG_DEV_CHAR
+		block = unix.BPF_DEVCG_DEV_BLOCK
+		read  = unix.BPF_DEVCG_ACC_READ
+		write = unix.BPF_DEVCG_ACC_WRITE
+		mknod = unix.BPF_DEVCG_ACC_MKNOD
+	)
+	rules := append(append([]DeviceRule{}, DefaultDeviceRules...),
+		DeviceRule{Type: 'c', Major: 10, Minor: 200, Access: "r"},
+		DeviceRule{Type: 'b', Major: 8, Minor: 0, Access: "rw"},
+	)
+	prog, err := compileDeviceFilter(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		devType      uint32
+		access       uint32
+		major, minor uint32
+		want         uint64
+	}{
+		{name: "read null", devType: char, access: read, major: 1, minor: 3, want: 1},
+		{name: "read write null", devType: char, access: read | write, major: 1, minor: 3, want: 1},
+		{name: "mknod null", devType: char, access: mknod, major: 1, minor: 3, want: 1},
+		{name: "pts", devType: char, access: read | write, major: 136, minor: 7, want: 1},
+		{name: "read other char", devType: char, access: read, major: 1, minor: 4, want: 0},
+		{name: "mknod any char", devType: char, access: mknod, major: 4, minor: 1, want: 1},
+		{name: "mknod any block", devType: block, access: mknod, major: 259, minor: 1, want: 1},
+		{name: "read other block", devType: block, access: read, major: 259, minor: 1, want: 0},
+		// 块设备与字符设备的设备号相同时不能匹配字符设备的规则
+		{name: "block with null number", devType: block, access: read, major: 1, minor: 3, want: 0},
+		// 只读规则
+		{name: "read only device read", devType: char, access: read, major: 10, minor: 200, want: 1},
+		{name: "read only device write", devType: char, access: write, major: 10, minor: 200, want: 0},
+		{name: "read only device read write", devType: char, access: read | write, major: 10, minor: 200, want: 0},
+		{name: "read only device mknod", devType: char, access: mknod, major: 10, minor: 200, want: 1},
+		{name: "rw block read write", devType: block, access: read | write, major: 8, minor: 0, want: 1},
+		{name: "rw block other minor", devType: block, access: read, major: 8, minor: 1, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runDeviceFilter(t, prog, tt.devType, tt.access, tt.major, tt.minor); got != tt.want {
+				t.Errorf("filter = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 没有规则时拒绝全部访问，允许全部设备时全部放行
+	deny, err := compileDeviceFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := compileDeviceFilter(AllowAllDevices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, devType := range []uint32{char, block} {
+		if got := runDeviceFilter(t, deny, devType, read|write|mknod, 1, 3); got != 0 {
+			t.Errorf("empty filter = %d, want 0", got)
+		}
+		if got := runDeviceFilter(t, allow, devType, read|write|mknod, 8, 0); got != 1 {
+			t.Errorf("allow all filter = %d, want 1", got)
+		}
+	}
+}
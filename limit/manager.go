@@ -2,64 +2,229 @@ package limit
 
 import (
 	"ducker/util"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
+// freezeTimeout 等待冻结或解冻完成的最长时间
+const freezeTimeout = 5 * time.Second
+
+// manager cgroup 后端，分别实现 v1 和 v2 (unified) 两种层级结构
+type manager interface {
+	// version cgroup 版本号
+	version() int
+	// path 容器在指定子系统中的 cgroup 目录，v2 下所有子系统共用同一目录
+	path(containerID, subsystem string) string
+	// apply 创建容器 cgroup、写入资源限制并将进程加入
+	apply(containerID string, pid int, resources *Resources) error
+	// dirs 容器所在的全部 cgroup 目录
+	dirs(containerID string) []string
+	// setResources 修改已创建的容器 cgroup 的资源限制
+	setResources(containerID string, resources *Resources) error
+	// availableCpuset 主机上可分配给容器的 CPU（kind 为 cpus）或内存节点（kind 为 mems）
+	availableCpuset(kind string) string
+	// setDevices 只允许容器访问 rules 中的设备
+	setDevices(containerID string, rules []DeviceRule) error
+	setFrozen(containerID string, frozen bool) error
+	stats(containerID string) *Stats
+	pids(containerID string) ([]int, error)
+	oomKillCount(containerID string) int
+	remove(containerID string)
+}
+
+// current 按运行时检测到的 cgroup 模式选择后端
+var current = sync.OnceValue(func() manager {
+	return newManager(util.GetCgroupRootDir())
+})
+
+// newManager 根据 root 下的 cgroup 文件系统选择后端
+// root 下存在 cgroup.controllers 即为 v2 unified 模式，混合模式按 v1 处理
+func newManager(root string) manager {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return &v2Manager{root: root}
+	}
+	return &v1Manager{root: root}
+}
+
 // Apply 应用 cgroup 资源限制
-func Apply(containerID string, pid int, cpuLimit float64, memoryLimit uint64) error {
+func Apply(containerID string, pid int, resources *Resources) error {
 	if containerID == "" {
 		return fmt.Errorf("container ID is empty")
 	}
 	if pid <= 0 {
 		return fmt.Errorf("invalid PID: %d", pid)
 	}
+	return current().apply(containerID, pid, resources)
+}
 
-	if cpuLimit > 0 {
-		if err := applyCPULimit(containerID, pid, cpuLimit); err != nil {
-			return err
+// Procs 已打开的容器各 cgroup 的 cgroup.procs 文件，切换 mnt 命名空间后仍可用于加入进程
+type Procs struct {
+	files []*os.File
+}
+
+// OpenProcs 打开已创建的容器 cgroup，用于之后将在容器内执行的进程加入
+func OpenProcs(containerID string) (*Procs, error) {
+	procs := &Procs{}
+	for _, dir := range current().dirs(containerID) {
+		file, err := os.OpenFile(filepath.Join(dir, "cgroup.procs"), os.O_WRONLY, 0)
+		if err != nil {
+			procs.Close()
+			return nil, fmt.Errorf("open cgroup %s: %w", dir, err)
 		}
+		procs.files = append(procs.files, file)
 	}
+	return procs, nil
+}
 
-	if memoryLimit > 0 {
-		if err := applyMemoryLimit(containerID, pid, memoryLimit); err != nil {
-			return err
+// Add 将进程（包括其所有线程）加入容器的全部 cgroup
+func (p *Procs) Add(pid int) error {
+	for _, file := range p.files {
+		if _, err := file.WriteString(strconv.Itoa(pid)); err != nil {
+			return fmt.Errorf("add pid to cgroup %s: %w", filepath.Dir(file.Name()), err)
 		}
 	}
 	return nil
 }
 
-func applyCPULimit(containerID string, pid int, cpuLimit float64) error {
-	cpuPath := util.GetCgroupCPUPath(containerID)
-	if err := os.Mkdir(cpuPath, 0755); err != nil {
-		return fmt.Errorf("create cpu cgroup: %w", err)
+func (p *Procs) Close() {
+	for _, file := range p.files {
+		file.Close()
 	}
-	quota := strconv.Itoa(int(cpuLimit * 100000))
-	if err := os.WriteFile(util.GetCPUQuotaPath(containerID), []byte(quota), 0644); err != nil {
-		return fmt.Errorf("set cpu quota: %w", err)
+}
+
+// Update 修改运行中容器的资源限制，resources 为修改后的完整限制
+// 内存限制不能低于当前用量，否则内核会拒绝（v1）或直接触发 OOM（v2）。
+// 用量不含可回收的文件缓存（v1 的 total_inactive_file，v2 的 inactive_file），与 stats 显示的一致
+func Update(containerID string, resources *Resources) error {
+	if resources.Memory > 0 {
+		if usage := GetStats(containerID).MemoryUsage; usage > resources.Memory {
+			return fmt.Errorf("memory limit %s is below current usage %s",
+				util.FormatSize(int64(resources.Memory)), util.FormatSize(int64(usage)))
+		}
 	}
-	if err := os.WriteFile(util.GetCPUTasksPath(containerID), []byte(strconv.Itoa(pid)), 0644); err != nil {
-		return fmt.Errorf("add pid to cpu cgroup: %w", err)
+	err := current().setResources(containerID, resources)
+	if errors.Is(err, unix.EBUSY) {
+		return fmt.Errorf("%w: kernel could not reclaim enough memory for the new limit", err)
 	}
-	return nil
+	return err
+}
+
+// Freeze 冻结容器内的所有进程，等待冻结完成
+func Freeze(containerID string) error {
+	return current().setFrozen(containerID, true)
+}
+
+// Thaw 解冻容器内的所有进程
+func Thaw(containerID string) error {
+	return current().setFrozen(containerID, false)
 }
 
-func applyMemoryLimit(containerID string, pid int, memoryLimit uint64) error {
-	memPath := util.GetCgroupMemoryPath(containerID)
-	if err := os.Mkdir(memPath, 0755); err != nil {
-		return fmt.Errorf("create memory cgroup: %w", err)
+// GetStats 读取容器的资源使用情况，缺失的统计文件对应的值为 0
+func GetStats(containerID string) *Stats {
+	return current().stats(containerID)
+}
+
+// Pids 容器 cgroup 中的所有进程
+func Pids(containerID string) ([]int, error) {
+	return current().pids(containerID)
+}
+
+// OOMKillCount 读取内存 cgroup 中因 OOM 被杀死的进程数
+func OOMKillCount(containerID string) int {
+	return current().oomKillCount(containerID)
+}
+
+// Version 当前使用的 cgroup 版本
+func Version() int {
+	return current().version()
+}
+
+// Path 容器在指定子系统（如 cpu、memory、freezer）中的 cgroup 目录
+func Path(containerID, subsystem string) string {
+	return current().path(containerID, subsystem)
+}
+
+// Hierarchies 容器在各 cgroup 层级中的目录，键为层级挂载点在 cgroup 根目录下的名称，v2 只有名称为空的一个层级，
+// v1 只包含主机上已挂载的层级
+func Hierarchies(containerID string) map[string]string {
+	m, ok := current().(*v1Manager)
+	if !ok {
+		return map[string]string{"": Path(containerID, "")}
 	}
-	if err := os.WriteFile(util.GetMemoryLimitPath(containerID), []byte(strconv.FormatUint(memoryLimit, 10)), 0644); err != nil {
-		return fmt.Errorf("set memory limit: %w", err)
+	hierarchies := make(map[string]string, len(v1Subsystems))
+	for _, subsystem := range m.subsystems() {
+		hierarchies[subsystem] = m.path(containerID, subsystem)
 	}
-	if err := os.WriteFile(util.GetMemoryTasksPath(containerID), []byte(strconv.Itoa(pid)), 0644); err != nil {
-		return fmt.Errorf("add pid to memory cgroup: %w", err)
+	return hierarchies
+}
+
+func Remove(containerID string) {
+	current().remove(containerID)
+}
+
+// writeFile 写入 cgroup 控制文件
+func writeFile(dir, file, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", file, err)
 	}
 	return nil
 }
 
-func Remove(containerID string) {
-	os.RemoveAll(util.GetCgroupCPUPath(containerID))
-	os.RemoveAll(util.GetCgroupMemoryPath(containerID))
+// join 将进程写入各 cgroup 的 cgroup.procs，写入 tasks 只会移动单个线程
+func join(dirs []string, pid int) error {
+	for _, dir := range dirs {
+		if err := writeFile(dir, "cgroup.procs", strconv.Itoa(pid)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orDefault value 为零值时返回 fallback
+func orDefault[T comparable](value, fallback T) T {
+	var zero T
+	if value == zero {
+		return fallback
+	}
+	return value
+}
+
+// readPids 读取 cgroup.procs 中的进程号
+func readPids(dir string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil, fmt.Errorf("read cgroup procs: %w", err)
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// waitFreezer 轮询直到 done 返回 true 或超时
+func waitFreezer(done func() (bool, error)) error {
+	deadline := time.Now().Add(freezeTimeout)
+	for time.Now().Before(deadline) {
+		ok, err := done()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for freezer")
 }
@@ -0,0 +1,110 @@
+package limit
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testContainerID 测试中使用的容器 ID
+const testContainerID = "0123456789ab"
+
+// useManager 在测试期间让包级函数（Update、GetStats 等）使用 m
+func useManager(t *testing.T, m manager) {
+	t.Helper()
+	saved := current
+	current = func() manager { return m }
+	t.Cleanup(func() { current = saved })
+}
+
+// writeTestFile 创建 dir 及其中的控制文件，模拟内核提供的文件
+func writeTestFile(t *testing.T, dir, file, value string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertFiles 检查 dir 中控制文件的内容
+func assertFiles(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	for file, value := range want {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Errorf("read %s: %v", file, err)
+			continue
+		}
+		if got := strings.TrimSpace(string(data)); got != value {
+			t.Errorf("%s = %q, want %q", file, got, value)
+		}
+	}
+}
+
+func TestNewManager(t *testing.T) {
+	root := t.TempDir()
+	if m := newManager(root); m.version() != 1 {
+		t.Errorf("version without cgroup.controllers = %d, want 1", m.version())
+	}
+	writeTestFile(t, root, "cgroup.controllers", "cpu memory")
+	if m := newManager(root); m.version() != 2 {
+		t.Errorf("version with cgroup.controllers = %d, want 2", m.version())
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	m := newTestV1Manager(t, v1Subsystems...)
+	useManager(t, m)
+	if err := m.apply(testContainerID, 1, &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	memoryPath := m.path(testContainerID, "memory")
+
+	// 内存限制不能低于当前用量
+	writeTestFile(t, memoryPath, "memory.usage_in_bytes", strconv.Itoa(64<<20))
+	if err := Update(testContainerID, &Resources{Memory: 32 << 20}); err == nil {
+		t.Error("Update below usage succeeded, want error")
+	}
+
+	// 可回收的文件缓存不计入用量
+	writeTestFile(t, memoryPath, "memory.stat", "cache 50331648\ntotal_inactive_file 41943040\n")
+	if err := Update(testContainerID, &Resources{Memory: 32 << 20}); err != nil {
+		t.Errorf("Update above usage without inactive file cache: %v", err)
+	}
+
+	if err := Update(testContainerID, &Resources{Memory: 128 << 20, PidsLimit: 50}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, memoryPath, map[string]string{"memory.limit_in_bytes": strconv.Itoa(128 << 20)})
+	assertFiles(t, m.path(testContainerID, "pids"), map[string]string{"pids.max": "50"})
+
+	// 取消内存限制
+	if err := Update(testContainerID, &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, memoryPath, map[string]string{"memory.limit_in_bytes": "-1"})
+}
+
+func TestUpdateV2InactiveFile(t *testing.T) {
+	m := newTestV2Manager(t)
+	useManager(t, m)
+	if err := m.apply(testContainerID, 1, &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	dir := m.path(testContainerID, "")
+	writeTestFile(t, dir, "memory.max", "max")
+	writeTestFile(t, dir, "memory.current", strconv.Itoa(64<<20))
+	writeTestFile(t, dir, "memory.stat", "file 50331648\ninactive_file 41943040\n")
+
+	if err := Update(testContainerID, &Resources{Memory: 32 << 20}); err != nil {
+		t.Fatalf("Update above usage without inactive file cache: %v", err)
+	}
+	assertFiles(t, dir, map[string]string{"memory.max": strconv.Itoa(32 << 20)})
+	if err := Update(testContainerID, &Resources{Memory: 16 << 20}); err == nil {
+		t.Error("Update below usage succeeded, want error")
+	}
+}
@@ -0,0 +1,205 @@
+package limit
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// minMemory 内存限制的下限，过小的限制会导致容器无法启动
+	minMemory = 6 * 1024 * 1024
+
+	// cgroup v1 cpu.shares 的取值范围和默认值
+	minCPUShares     = 2
+	maxCPUShares     = 262144
+	defaultCPUShares = 1024
+)
+
+// MemoryUnlimited 用于 Merge 的 changes，表示取消内存限制
+const MemoryUnlimited = math.MaxUint64
+
+// CPUsUnlimited 用于 Merge 的 changes，表示取消 CPU 核数限制
+const CPUsUnlimited = -1
+
+// Resources 容器的资源限制，零值表示不限制
+type Resources struct {
+	CPUs       float64 `json:"cpus"`
+	CPUShares  uint64  `json:"cpu_shares,omitempty"`  // CPU 竞争时的相对权重
+	CpusetCpus string  `json:"cpuset_cpus,omitempty"` // 允许使用的 CPU，如 0-3,5
+	CpusetMems string  `json:"cpuset_mems,omitempty"` // 允许使用的 NUMA 节点
+
+	Memory            uint64 `json:"memory"`
+	MemorySwap        int64  `json:"memory_swap,omitempty"`        // 内存与交换分区的总量，-1 表示不限制交换分区
+	MemoryReservation uint64 `json:"memory_reservation,omitempty"` // 软限制，内存紧张时回收到该值
+	OOMKillDisable    bool   `json:"oom_kill_disable,omitempty"`
+
+	PidsLimit int64 `json:"pids_limit,omitempty"` // 小于 0 表示不限制
+
+	DeviceReadBps  []ThrottleDevice `json:"device_read_bps,omitempty"`
+	DeviceWriteBps []ThrottleDevice `json:"device_write_bps,omitempty"`
+}
+
+// Merge 用 changes 中设置了的（非零）CPU、内存和进程数限制覆盖当前值，用于修改运行中的容器。
+// changes.CPUs 为 CPUsUnlimited 时取消 CPU 核数限制；
+// changes.Memory 为 MemoryUnlimited 时取消内存限制，未同时设置交换分区时原有的交换分区限制一并取消
+func (r *Resources) Merge(changes *Resources) {
+	r.CPUs = orDefault(changes.CPUs, r.CPUs)
+	if changes.CPUs == CPUsUnlimited {
+		r.CPUs = 0
+	}
+	r.CPUShares = orDefault(changes.CPUShares, r.CPUShares)
+	r.CpusetCpus = orDefault(changes.CpusetCpus, r.CpusetCpus)
+	r.CpusetMems = orDefault(changes.CpusetMems, r.CpusetMems)
+	r.Memory = orDefault(changes.Memory, r.Memory)
+	r.MemorySwap = orDefault(changes.MemorySwap, r.MemorySwap)
+	if changes.Memory == MemoryUnlimited {
+		r.Memory = 0
+		if changes.MemorySwap == 0 {
+			r.MemorySwap = 0
+		}
+	}
+	r.MemoryReservation = orDefault(changes.MemoryReservation, r.MemoryReservation)
+	r.PidsLimit = orDefault(changes.PidsLimit, r.PidsLimit)
+}
+
+// swapLimit 内存与交换分区的总量，只设置内存限制时默认为内存限制的两倍，返回 -1 表示不限制交换分区
+func (r *Resources) swapLimit() int64 {
+	switch {
+	case r.Memory == 0 || r.MemorySwap < 0:
+		return -1
+	case r.MemorySwap == 0:
+		return 2 * int64(r.Memory)
+	}
+	return r.MemorySwap
+}
+
+// ThrottleDevice 块设备的 I/O 速率限制，单位字节每秒
+type ThrottleDevice struct {
+	Path string `json:"path"`
+	Rate uint64 `json:"rate"`
+}
+
+// deviceNumber 读取块设备的主次设备号，格式为 major:minor
+func (d ThrottleDevice) deviceNumber() (string, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(d.Path, &stat); err != nil {
+		return "", fmt.Errorf("stat device %s: %w", d.Path, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return "", fmt.Errorf("%s is not a block device", d.Path)
+	}
+	return fmt.Sprintf("%d:%d", unix.Major(stat.Rdev), unix.Minor(stat.Rdev)), nil
+}
+
+// Validate 在创建容器前检查资源限制是否合法以及当前 cgroup 模式是否支持
+func (r *Resources) Validate() error {
+	if r.CPUs < 0 {
+		return fmt.Errorf("invalid --cpus: must be positive")
+	}
+	if cpus := runtime.NumCPU(); r.CPUs > float64(cpus) {
+		return fmt.Errorf("invalid --cpus: range of CPUs is from 0.01 to %d.00, as there are only %d CPUs available", cpus, cpus)
+	}
+	if r.CPUShares != 0 && (r.CPUShares < minCPUShares || r.CPUShares > maxCPUShares) {
+		return fmt.Errorf("invalid --cpu-shares: must be between %d and %d", minCPUShares, maxCPUShares)
+	}
+	if err := validateCpuset(r.CpusetCpus, "cpus"); err != nil {
+		return fmt.Errorf("invalid --cpuset-cpus: %w", err)
+	}
+	if err := validateCpuset(r.CpusetMems, "mems"); err != nil {
+		return fmt.Errorf("invalid --cpuset-mems: %w", err)
+	}
+
+	if r.Memory != 0 && r.Memory < minMemory {
+		return fmt.Errorf("invalid --memory: minimum memory limit allowed is 6MB")
+	}
+	if r.MemorySwap != 0 && r.MemorySwap != -1 {
+		if r.Memory == 0 {
+			return fmt.Errorf("invalid --memory-swap: you should always set --memory with --memory-swap")
+		}
+		if r.MemorySwap < int64(r.Memory) {
+			return fmt.Errorf("invalid --memory-swap: must be larger than or equal to --memory")
+		}
+	}
+	if r.Memory != 0 && r.MemoryReservation > r.Memory {
+		return fmt.Errorf("invalid --memory-reservation: must be smaller than --memory")
+	}
+	if r.OOMKillDisable && current().version() == 2 {
+		return fmt.Errorf("invalid --oom-kill-disable: not supported on cgroup v2")
+	}
+
+	if err := validateDevices(r.DeviceReadBps); err != nil {
+		return fmt.Errorf("invalid --device-read-bps: %w", err)
+	}
+	if err := validateDevices(r.DeviceWriteBps); err != nil {
+		return fmt.Errorf("invalid --device-write-bps: %w", err)
+	}
+	return nil
+}
+
+func validateDevices(devices []ThrottleDevice) error {
+	for _, device := range devices {
+		if _, err := device.deviceNumber(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCpuset 检查 cpuset 列表格式，并确认其中的 CPU 或节点在主机上可用
+func validateCpuset(list, kind string) error {
+	if list == "" {
+		return nil
+	}
+	requested, err := parseCpuset(list)
+	if err != nil {
+		return err
+	}
+	available, err := parseCpuset(current().availableCpuset(kind))
+	if err != nil {
+		return fmt.Errorf("read available %s: %w", kind, err)
+	}
+	for n := range requested {
+		if !available[n] {
+			return fmt.Errorf("%s %d is not available", strings.TrimSuffix(kind, "s"), n)
+		}
+	}
+	return nil
+}
+
+// parseCpuset 解析 cpuset 列表格式，如 "0-3,5"
+func parseCpuset(list string) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		low, high, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(low)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid format %q", list)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(high); err != nil || end < start {
+				return nil, fmt.Errorf("invalid format %q", list)
+			}
+		}
+		for n := start; n <= end; n++ {
+			set[n] = true
+		}
+	}
+	return set, nil
+}
+
+// readTrimmed 读取控制文件并去除首尾空白
+func readTrimmed(dir, file string) string {
+	data, _ := os.ReadFile(filepath.Join(dir, file))
+	return strings.TrimSpace(string(data))
+}
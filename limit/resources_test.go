@@ -0,0 +1,149 @@
+package limit
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseCpuset(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "0", want: []int{0}},
+		{in: "0-3", want: []int{0, 1, 2, 3}},
+		{in: "0-1,5,7-8\n", want: []int{0, 1, 5, 7, 8}},
+		{in: "2,2", want: []int{2}},
+		{in: "3-1", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "a", wantErr: true},
+		{in: "0-", wantErr: true},
+		{in: "0-x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCpuset(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCpuset(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCpuset(%q) error: %v", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseCpuset(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for _, n := range tt.want {
+			if !got[n] {
+				t.Errorf("parseCpuset(%q) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := Resources{CPUs: 1, Memory: 64 << 20, MemorySwap: 128 << 20, MemoryReservation: 32 << 20, PidsLimit: 10}
+	tests := []struct {
+		name    string
+		changes Resources
+		want    Resources
+	}{
+		{name: "no changes", changes: Resources{}, want: base},
+		{name: "cpus and pids", changes: Resources{CPUs: 2, PidsLimit: -1},
+			want: Resources{CPUs: 2, Memory: 64 << 20, MemorySwap: 128 << 20, MemoryReservation: 32 << 20, PidsLimit: -1}},
+		{name: "memory", changes: Resources{Memory: 96 << 20},
+			want: Resources{CPUs: 1, Memory: 96 << 20, MemorySwap: 128 << 20, MemoryReservation: 32 << 20, PidsLimit: 10}},
+		{name: "unlimited cpus", changes: Resources{CPUs: CPUsUnlimited},
+			want: Resources{Memory: 64 << 20, MemorySwap: 128 << 20, MemoryReservation: 32 << 20, PidsLimit: 10}},
+		{name: "unlimited memory", changes: Resources{Memory: MemoryUnlimited},
+			want: Resources{CPUs: 1, MemoryReservation: 32 << 20, PidsLimit: 10}},
+		{name: "unlimited memory and swap", changes: Resources{Memory: MemoryUnlimited, MemorySwap: -1},
+			want: Resources{CPUs: 1, MemorySwap: -1, MemoryReservation: 32 << 20, PidsLimit: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := base
+			got.Merge(&tt.changes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwapLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources Resources
+		want      int64
+	}{
+		{name: "no limit", resources: Resources{}, want: -1},
+		{name: "memory only", resources: Resources{Memory: 64 << 20}, want: 128 << 20},
+		{name: "memory-swap", resources: Resources{Memory: 64 << 20, MemorySwap: 96 << 20}, want: 96 << 20},
+		{name: "memory-swap equal to memory", resources: Resources{Memory: 64 << 20, MemorySwap: 64 << 20}, want: 64 << 20},
+		{name: "unlimited swap", resources: Resources{Memory: 64 << 20, MemorySwap: -1}, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.resources.swapLimit(); got != tt.want {
+				t.Errorf("swapLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	useManager(t, newTestV1Manager(t, v1Subsystems...)) // 可用 CPU 为 0-3，节点为 0
+
+	tests := []struct {
+		name      string
+		resources Resources
+		wantErr   string
+	}{
+		{name: "empty", resources: Resources{}},
+		{name: "all set", resources: Resources{CPUs: 1, CPUShares: 512, CpusetCpus: "0-1", CpusetMems: "0", Memory: 64 << 20, MemorySwap: 128 << 20, MemoryReservation: 32 << 20, PidsLimit: 10}},
+		{name: "unlimited swap", resources: Resources{Memory: 64 << 20, MemorySwap: -1}},
+		{name: "negative cpus", resources: Resources{CPUs: -1}, wantErr: "--cpus"},
+		{name: "too many cpus", resources: Resources{CPUs: float64(runtime.NumCPU() + 1)}, wantErr: "--cpus"},
+		{name: "cpu-shares too small", resources: Resources{CPUShares: 1}, wantErr: "--cpu-shares"},
+		{name: "cpu-shares too large", resources: Resources{CPUShares: maxCPUShares + 1}, wantErr: "--cpu-shares"},
+		{name: "cpuset format", resources: Resources{CpusetCpus: "0-"}, wantErr: "--cpuset-cpus"},
+		{name: "cpu not available", resources: Resources{CpusetCpus: "0,4"}, wantErr: "cpu 4 is not available"},
+		{name: "node not available", resources: Resources{CpusetMems: "1"}, wantErr: "--cpuset-mems"},
+		{name: "memory too small", resources: Resources{Memory: 1 << 20}, wantErr: "--memory"},
+		{name: "memory-swap without memory", resources: Resources{MemorySwap: 128 << 20}, wantErr: "--memory-swap"},
+		{name: "memory-swap below memory", resources: Resources{Memory: 64 << 20, MemorySwap: 32 << 20}, wantErr: "--memory-swap"},
+		{name: "reservation above memory", resources: Resources{Memory: 64 << 20, MemoryReservation: 128 << 20}, wantErr: "--memory-reservation"},
+		{name: "not a block device", resources: Resources{DeviceReadBps: []ThrottleDevice{{Path: "/dev/null", Rate: 1}}}, wantErr: "--device-read-bps"},
+		{name: "missing device", resources: Resources{DeviceWriteBps: []ThrottleDevice{{Path: "/dev/does-not-exist", Rate: 1}}}, wantErr: "--device-write-bps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.resources.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateOOMKillDisableV2(t *testing.T) {
+	useManager(t, newTestV2Manager(t))
+	if err := (&Resources{OOMKillDisable: true}).Validate(); err == nil {
+		t.Error("Validate(--oom-kill-disable) on cgroup v2 succeeded, want error")
+	}
+}
@@ -0,0 +1,59 @@
+package limit
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Stats 容器的 cgroup 资源使用情况
+type Stats struct {
+	CPUUsage    uint64 // 累计 CPU 时间，单位纳秒
+	MemoryUsage uint64 // 不含可回收的文件缓存
+	MemoryLimit uint64 // 未限制时为 0
+	Pids        int
+	BlockRead   uint64
+	BlockWrite  uint64
+}
+
+func readUint(path string) uint64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return value
+}
+
+// readKeyedUint 读取 "key value" 格式文件中指定键的值
+func readKeyedUint(path, key string) uint64 {
+	var value uint64
+	forEachLine(path, func(fields []string) {
+		if len(fields) == 2 && fields[0] == key {
+			value, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	})
+	return value
+}
+
+// readFields 读取以空白分隔的文件内容，读取失败时返回空
+func readFields(path string) []string {
+	data, _ := os.ReadFile(path)
+	return strings.Fields(string(data))
+}
+
+func forEachLine(path string, fn func(fields []string)) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+}
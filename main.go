@@ -2,6 +2,7 @@ package main
 
 import (
 	"ducker/cmd"
+	"ducker/container"
 	"ducker/image"
 	"ducker/net"
 	_ "embed"
@@ -14,15 +15,29 @@ import (
 //go:embed test/alpine.tar.gz
 var alpineImage []byte
 
+// internalCommands 内部子命令，无需初始化网络和内置镜像
+var internalCommands = map[string]bool{
+	"init":    true,
+	"monitor": true,
+	"nsexec":  true,
+}
+
 func preProcess(c *cli.Context) error {
-	if c.Args().First() != "init" {
-		if err := net.Init(); err != nil {
-			slog.Warn("init network failed", "err", err)
-		}
-
-		if err := image.LoadBuiltin(alpineImage, "alpine:latest"); err != nil {
-			slog.Warn("load builtin alpine failed", "err", err)
-		}
+	if internalCommands[c.Args().First()] {
+		return nil
+	}
+
+	if err := net.Init(); err != nil {
+		slog.Warn("init network failed", "err", err)
+	}
+
+	if err := image.LoadBuiltin(alpineImage, "alpine:latest"); err != nil {
+		slog.Warn("load builtin alpine failed", "err", err)
+	}
+
+	// 主机重启后按重启策略恢复容器，需要在网络初始化之后
+	if err := container.RestoreAfterBoot(); err != nil {
+		slog.Warn("restore containers failed", "err", err)
 	}
 	return nil
 }
@@ -32,23 +47,38 @@ func main() {
 		Name:   "ducker",
 		Usage:  "A simple container runtime",
 		Before: preProcess,
+		// 与 docker 一致，-e A=1,2、--tmpfs /run:size=1m,mode=1777 等参数中的逗号不作为多个值的分隔符
+		DisableSliceFlagSeparator: true,
 		Commands: []*cli.Command{
+			cmd.Attach,
 			cmd.Build,
 			cmd.Commit,
+			cmd.Container,
 			cmd.Cp,
+			cmd.Create,
 			cmd.Exec,
+			cmd.Image,
 			cmd.Images,
 			cmd.Init,
+			cmd.Inspect,
+			cmd.Kill,
 			cmd.Load,
 			cmd.Logs,
+			cmd.Monitor,
 			cmd.Network,
+			cmd.Nsexec,
+			cmd.Pause,
 			cmd.Ps,
 			cmd.Rm,
 			cmd.Rmi,
 			cmd.Run,
 			cmd.Save,
 			cmd.Start,
+			cmd.Stats,
 			cmd.Stop,
+			cmd.Top,
+			cmd.Unpause,
+			cmd.Update,
 			cmd.Volume,
 		},
 	}
@@ -46,6 +46,11 @@ func bridgeName(id string) string {
 	return fmt.Sprintf("br-%s", id[:6])
 }
 
+// vethName 容器在主机侧的 veth 名称，容器侧为 ceth-<短 ID>
+func vethName(containerID string) string {
+	return "veth-" + containerID[:6]
+}
+
 func (d *BridgeDriver) setUp() error {
 	if err := d.createBridge(); err != nil {
 		return fmt.Errorf("create bridge: %w", err)
@@ -106,9 +111,7 @@ func (d *BridgeDriver) connect(containerID string, pid int) error {
 
 func (d *BridgeDriver) disconnect(containerID string) error {
 	// 根据容器 ID 生成 veth 名称并删除
-	short := containerID[:6]
-	vethName := "veth-" + short
-	if link, err := netlink.LinkByName(vethName); err == nil {
+	if link, err := netlink.LinkByName(vethName(containerID)); err == nil {
 		netlink.LinkDel(link)
 	}
 	delete(d.veths, containerID)
@@ -161,10 +164,9 @@ func (d *BridgeDriver) createBridge() error {
 }
 
 func (d *BridgeDriver) createVethPair(containerID string) (*netlink.Veth, error) {
-	short := containerID[:6]
 	veth := &netlink.Veth{
-		LinkAttrs: netlink.LinkAttrs{Name: "veth-" + short},
-		PeerName:  "ceth-" + short,
+		LinkAttrs: netlink.LinkAttrs{Name: vethName(containerID)},
+		PeerName:  "ceth-" + containerID[:6],
 	}
 	if err := netlink.LinkAdd(veth); err != nil {
 		return nil, fmt.Errorf("add veth: %w", err)
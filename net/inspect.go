@@ -0,0 +1,79 @@
+package net
+
+import "net"
+
+// InspectInfo 网络详情（inspect 输出结构）
+type InspectInfo struct {
+	ID         string
+	Name       string
+	Driver     string
+	Bridge     string
+	Subnet     string
+	Gateway    string
+	IPRange    string
+	Containers map[string]ContainerEndpoint
+}
+
+// ContainerEndpoint 已连接容器在网络中的地址
+type ContainerEndpoint struct {
+	IPv4Address string
+}
+
+// Endpoint 容器在某个网络中的连接信息
+type Endpoint struct {
+	NetworkID   string
+	IPAddress   string
+	IPPrefixLen int
+	Gateway     string
+}
+
+// Inspect 获取网络详情
+func Inspect(nameOrID string) (*InspectInfo, error) {
+	driver, err := get(nameOrID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &InspectInfo{
+		ID:         driver.ID,
+		Name:       driver.Name,
+		Driver:     "bridge",
+		Bridge:     bridgeName(driver.ID),
+		Subnet:     driver.IPM.CIDR,
+		Gateway:    driver.IPM.GatewayIP().String(),
+		IPRange:    driver.IPM.Range,
+		Containers: make(map[string]ContainerEndpoint, len(driver.ContainerIPs)),
+	}
+	for containerID, ipCIDR := range driver.ContainerIPs {
+		info.Containers[containerID] = ContainerEndpoint{IPv4Address: ipCIDR}
+	}
+	return info, nil
+}
+
+// ContainerEndpoints 查找容器已连接的所有网络，返回 网络名 -> 连接信息
+func ContainerEndpoints(containerID string) map[string]Endpoint {
+	networks, err := getAll()
+	if err != nil {
+		return nil
+	}
+
+	endpoints := make(map[string]Endpoint)
+	for _, driver := range networks {
+		ipCIDR, ok := driver.ContainerIPs[containerID]
+		if !ok {
+			continue
+		}
+		ip, ipNet, err := net.ParseCIDR(ipCIDR)
+		if err != nil {
+			continue
+		}
+		ones, _ := ipNet.Mask.Size()
+		endpoints[driver.Name] = Endpoint{
+			NetworkID:   driver.ID,
+			IPAddress:   ip.String(),
+			IPPrefixLen: ones,
+			Gateway:     driver.IPM.GatewayIP().String(),
+		}
+	}
+	return endpoints
+}
@@ -7,6 +7,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
 )
 
 const (
@@ -39,23 +40,11 @@ func Create(name, subnet, gateway, ipRange string) error {
 }
 
 func List(quiet bool) error {
-	entries, err := os.ReadDir(util.GetNetRootDir())
+	networks, err := getAll()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
 
-	var networks []*BridgeDriver
-	for _, entry := range entries {
-		if entry.IsDir() {
-			if driver, err := util.FindBy[BridgeDriver](util.TypeNet, entry.Name()); err == nil {
-				networks = append(networks, driver)
-			}
-		}
-	}
-
 	if quiet {
 		for _, n := range networks {
 			fmt.Println(n.ID[:12])
@@ -91,6 +80,30 @@ func Connect(networkName, containerID string, pid int) error {
 	return driver.connect(containerID, pid)
 }
 
+// SetupLoopback 启用容器网络命名空间中的回环接口，用于不连接任何网络的容器
+func SetupLoopback(pid int) error {
+	targetNs, err := netns.GetFromPid(pid)
+	if err != nil {
+		return fmt.Errorf("get ns: %w", err)
+	}
+	defer targetNs.Close()
+
+	nlh, err := netlink.NewHandleAt(targetNs)
+	if err != nil {
+		return fmt.Errorf("create handle: %w", err)
+	}
+	defer nlh.Close()
+
+	lo, err := nlh.LinkByName("lo")
+	if err != nil {
+		return fmt.Errorf("get lo: %w", err)
+	}
+	if err := nlh.LinkSetUp(lo); err != nil {
+		return fmt.Errorf("set up lo: %w", err)
+	}
+	return nil
+}
+
 func Disconnect(networkName, containerID string) error {
 	driver, err := get(networkName)
 	if err != nil {
@@ -108,6 +121,20 @@ func GetContainerIP(networkName, containerID string) (string, error) {
 	return driver.getContainerIP(containerID)
 }
 
+// TrafficStats 容器网络接收和发送的字节数，以容器视角统计
+// 主机侧 veth 接收的即容器发送的，反之亦然
+func TrafficStats(containerID string) (rx, tx uint64, err error) {
+	link, err := netlink.LinkByName(vethName(containerID))
+	if err != nil {
+		return 0, 0, fmt.Errorf("get veth: %w", err)
+	}
+	stats := link.Attrs().Statistics
+	if stats == nil {
+		return 0, 0, nil
+	}
+	return stats.TxBytes, stats.RxBytes, nil
+}
+
 // SetupPortMappings 设置容器端口映射
 // network: 网络名称或 ID
 // containerID: 容器 ID
@@ -141,6 +168,26 @@ func CleanPortMappings(network, containerID string, ports map[string]string) err
 	return nil
 }
 
+func getAll() ([]*BridgeDriver, error) {
+	entries, err := os.ReadDir(util.GetNetRootDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var networks []*BridgeDriver
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if driver, err := util.FindBy[BridgeDriver](util.TypeNet, entry.Name()); err == nil {
+				networks = append(networks, driver)
+			}
+		}
+	}
+	return networks, nil
+}
+
 func get(nameOrID string) (*BridgeDriver, error) {
 	if nameOrID == "" {
 		return nil, fmt.Errorf("network name is empty")
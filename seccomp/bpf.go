@@ -0,0 +1,255 @@
+package seccomp
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp 过滤器的返回值
+const (
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retTrace       = 0x7ff00000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+)
+
+// seccomp_data 中各字段的偏移，参数为 64 位，小端序下低 32 位在前
+const (
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+)
+
+// foreignArchRet 其他架构和 x32 ABI 的系统调用返回 ENOSYS，程序如同运行在不支持该 ABI 的内核上，
+// 可以自行处理错误而不是被直接杀死
+const foreignArchRet = retErrno | uint32(unix.ENOSYS)
+
+// maxArgs 系统调用的参数个数上限
+const maxArgs = 6
+
+// seccomp(2) 的操作和标志，x/sys/unix 中未定义
+const (
+	setModeFilter   = 1
+	filterFlagTsync = 1
+)
+
+// Compile 将配置编译为 BPF 程序，caps 为进程拥有的能力，用于判断规则是否生效
+func (p *Profile) Compile(caps []string) ([]unix.SockFilter, error) {
+	defaultRet, err := actionRet(p.DefaultAction, p.DefaultErrnoRet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default action: %w", err)
+	}
+
+	prog := []unix.SockFilter{
+		// 其他架构的系统调用号不同，规则无法匹配
+		load(offsetArch),
+		jump(unix.BPF_JEQ, nativeArch, 1, 0),
+		ret(foreignArchRet),
+		load(offsetNr),
+	}
+	if x32SyscallBit != 0 {
+		// x32 ABI 的系统调用号与本机不同，同样无法匹配
+		prog = append(prog, jump(unix.BPF_JGE, x32SyscallBit, 0, 1), ret(foreignArchRet))
+	}
+
+	for _, rule := range p.Syscalls {
+		action, err := actionRet(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return nil, fmt.Errorf("invalid action for %v: %w", rule.Names, err)
+		}
+		checks, err := compileArgs(rule.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid args for %v: %w", rule.Names, err)
+		}
+		if !rule.applies(caps) {
+			continue
+		}
+		for _, name := range rule.Names {
+			// 本机架构没有的系统调用无需过滤
+			nr, ok := syscallNumbers[name]
+			if !ok {
+				continue
+			}
+			prog = append(prog, syscallBlock(nr, checks, action)...)
+		}
+	}
+	prog = append(prog, ret(defaultRet))
+
+	if len(prog) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("seccomp profile too large: %d instructions", len(prog))
+	}
+	return prog, nil
+}
+
+// Install 为当前线程加载过滤器，之后 fork 和 exec 的进程都继承该过滤器
+// 调用方需要拥有 CAP_SYS_ADMIN 或已设置 no_new_privs
+func Install(prog []unix.SockFilter) error {
+	fprog := unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&fprog)), 0, 0); err != nil {
+		return fmt.Errorf("load seccomp filter: %w", err)
+	}
+	return nil
+}
+
+// InstallAllThreads 为当前进程的所有线程加载过滤器，当前线程设置的 no_new_privs 也同步到其他线程
+// 调用方需要拥有 CAP_SYS_ADMIN 或已设置 no_new_privs
+func InstallAllThreads(prog []unix.SockFilter) error {
+	fprog := unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	tid, _, errno := unix.Syscall(unix.SYS_SECCOMP, setModeFilter, filterFlagTsync, uintptr(unsafe.Pointer(&fprog)))
+	if errno != 0 {
+		return fmt.Errorf("load seccomp filter: %w", errno)
+	}
+	// 有线程无法同步时返回该线程的 ID
+	if tid != 0 {
+		return fmt.Errorf("load seccomp filter: thread %d cannot be synchronized", tid)
+	}
+	return nil
+}
+
+// actionRet 将动作转换为过滤器的返回值，errno 未指定时为 EPERM
+func actionRet(action Action, errno *uint) (uint32, error) {
+	data := uint32(unix.EPERM)
+	if errno != nil {
+		data = uint32(*errno) & 0xffff
+	}
+	switch action {
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActErrno:
+		return retErrno | data, nil
+	case ActTrace:
+		return retTrace | data, nil
+	case ActLog:
+		return retLog, nil
+	case ActAllow:
+		return retAllow, nil
+	}
+	return 0, fmt.Errorf("unsupported action %q", action)
+}
+
+// check 参数检查中的一条指令，fail 为真时对应方向的跳转目标是参数检查失败
+type check struct {
+	ins            unix.SockFilter
+	jtFail, jfFail bool
+}
+
+// syscallBlock 匹配单个系统调用的指令块：系统调用号相同且参数满足条件时返回 action，
+// 否则跳到块的末尾继续匹配下一条规则。检查参数会覆盖累加器，末尾需要重新加载系统调用号
+func syscallBlock(nr uint32, checks []check, action uint32) []unix.SockFilter {
+	// 系统调用号不同时跳过参数检查、返回指令以及末尾的重新加载
+	skip := len(checks) + 1
+	if len(checks) > 0 {
+		skip++
+	}
+	block := []unix.SockFilter{jump(unix.BPF_JEQ, nr, 0, uint8(skip))}
+
+	// 参数检查失败时跳到末尾的重新加载指令
+	failAt := len(checks) + 1
+	for i, c := range checks {
+		ins := c.ins
+		if c.jtFail {
+			ins.Jt = uint8(failAt - i - 1)
+		}
+		if c.jfFail {
+			ins.Jf = uint8(failAt - i - 1)
+		}
+		block = append(block, ins)
+	}
+	block = append(block, ret(action))
+	if len(checks) > 0 {
+		block = append(block, load(offsetNr))
+	}
+	return block
+}
+
+// compileArgs 编译规则的全部参数条件，全部满足时顺序执行到末尾
+func compileArgs(args []Arg) ([]check, error) {
+	var checks []check
+	for _, arg := range args {
+		if arg.Index >= maxArgs {
+			return nil, fmt.Errorf("argument index %d out of range", arg.Index)
+		}
+		argChecks, err := compileArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, argChecks...)
+	}
+	return checks, nil
+}
+
+// compileArg 编译单个参数条件：64 位的参数分为高低两个 32 位字比较，先比较高位
+func compileArg(arg Arg) ([]check, error) {
+	lo := uint32(offsetArgs + 8*arg.Index)
+	hi := lo + 4
+	pass := func(ins unix.SockFilter) check { return check{ins: ins} }
+	failTrue := func(ins unix.SockFilter) check { return check{ins: ins, jtFail: true} }
+	failFalse := func(ins unix.SockFilter) check { return check{ins: ins, jfFail: true} }
+	value, valueHi := uint32(arg.Value), uint32(arg.Value>>32)
+
+	switch arg.Op {
+	case OpEqualTo:
+		return []check{
+			pass(load(hi)), failFalse(jump(unix.BPF_JEQ, valueHi, 0, 0)),
+			pass(load(lo)), failFalse(jump(unix.BPF_JEQ, value, 0, 0)),
+		}, nil
+	case OpNotEqual:
+		// 高位不同时直接满足，跳过低位比较
+		return []check{
+			pass(load(hi)), pass(jump(unix.BPF_JEQ, valueHi, 0, 2)),
+			pass(load(lo)), failTrue(jump(unix.BPF_JEQ, value, 0, 0)),
+		}, nil
+	case OpGreaterThan, OpGreaterEqual:
+		cmp := uint16(unix.BPF_JGT)
+		if arg.Op == OpGreaterEqual {
+			cmp = unix.BPF_JGE
+		}
+		// 高位更大时直接满足，高位更小时不满足，相等时比较低位
+		return []check{
+			pass(load(hi)), pass(jump(unix.BPF_JGT, valueHi, 3, 0)), failFalse(jump(unix.BPF_JEQ, valueHi, 0, 0)),
+			pass(load(lo)), failFalse(jump(cmp, value, 0, 0)),
+		}, nil
+	case OpLessThan, OpLessEqual:
+		cmp := uint16(unix.BPF_JGE)
+		if arg.Op == OpLessEqual {
+			cmp = unix.BPF_JGT
+		}
+		// 高位更大时不满足，高位更小时直接满足，相等时比较低位
+		return []check{
+			pass(load(hi)), failTrue(jump(unix.BPF_JGT, valueHi, 0, 0)), pass(jump(unix.BPF_JEQ, valueHi, 0, 2)),
+			pass(load(lo)), failTrue(jump(cmp, value, 0, 0)),
+		}, nil
+	case OpMaskedEqual:
+		want, wantHi := uint32(arg.ValueTwo), uint32(arg.ValueTwo>>32)
+		return []check{
+			pass(load(hi)), pass(and(valueHi)), failFalse(jump(unix.BPF_JEQ, wantHi, 0, 0)),
+			pass(load(lo)), pass(and(value)), failFalse(jump(unix.BPF_JEQ, want, 0, 0)),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %q", arg.Op)
+}
+
+func load(offset uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offset}
+}
+
+func jump(cmp uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_JMP | cmp | unix.BPF_K, K: k, Jt: jt, Jf: jf}
+}
+
+func and(k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, K: k}
+}
+
+func ret(k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: k}
+}
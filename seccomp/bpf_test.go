@@ -0,0 +1,283 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccompData 内核传给过滤器的 struct seccomp_data
+type seccompData struct {
+	nr   uint32
+	arch uint32
+	args [maxArgs]uint64
+}
+
+// bytes 按小端序编码，与 amd64 和 arm64 上内核的布局一致
+func (d seccompData) bytes() []byte {
+	buf := make([]byte, offsetArgs+8*maxArgs)
+	binary.LittleEndian.PutUint32(buf[offsetNr:], d.nr)
+	binary.LittleEndian.PutUint32(buf[offsetArch:], d.arch)
+	for i, arg := range d.args {
+		binary.LittleEndian.PutUint64(buf[offsetArgs+8*i:], arg)
+	}
+	return buf
+}
+
+// runFilter 解释执行经典 BPF 程序，返回过滤器的返回值
+func runFilter(t *testing.T, prog []unix.SockFilter, data seccompData) uint32 {
+	t.Helper()
+	buf := data.bytes()
+	var a uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			if int(ins.K)+4 > len(buf) {
+				t.Fatalf("pc %d: load offset %d out of range", pc, ins.K)
+			}
+			a = binary.LittleEndian.Uint32(buf[ins.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			a &= ins.K
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			var match bool
+			switch ins.Code &^ (unix.BPF_JMP | unix.BPF_K) {
+			case unix.BPF_JEQ:
+				match = a == ins.K
+			case unix.BPF_JGT:
+				match = a > ins.K
+			case unix.BPF_JGE:
+				match = a >= ins.K
+			}
+			if match {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+			if pc+1 >= len(prog) {
+				t.Fatalf("pc %d: jump out of range", pc)
+			}
+		default:
+			t.Fatalf("pc %d: unsupported instruction %#x", pc, ins.Code)
+		}
+	}
+	t.Fatal("filter did not return")
+	return 0
+}
+
+func errnoRet(errno unix.Errno) uint32 {
+	return retErrno | uint32(errno)
+}
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func TestCompile(t *testing.T) {
+	write := syscallNumbers["write"]
+	personality := syscallNumbers["personality"]
+	mount := syscallNumbers["mount"]
+	native := func(nr uint32, args ...uint64) seccompData {
+		d := seccompData{nr: nr, arch: nativeArch}
+		copy(d.args[:], args)
+		return d
+	}
+
+	type call struct {
+		name string
+		caps []string
+		data seccompData
+		want uint32
+	}
+	tests := []struct {
+		name    string
+		profile Profile
+		calls   []call
+	}{
+		{
+			name:    "foreign architecture",
+			profile: Profile{DefaultAction: ActAllow},
+			calls: []call{
+				{name: "native", data: native(write), want: retAllow},
+				{name: "i386", data: seccompData{nr: write, arch: unix.AUDIT_ARCH_I386}, want: errnoRet(unix.ENOSYS)},
+				{name: "arm", data: seccompData{nr: write, arch: unix.AUDIT_ARCH_ARM}, want: errnoRet(unix.ENOSYS)},
+			},
+		},
+		{
+			name: "errno",
+			profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{
+				{Names: []string{"personality"}, Action: ActErrno},
+				{Names: []string{"mount", "not_a_syscall"}, Action: ActErrno, ErrnoRet: uintPtr(uint(unix.ENOSYS))},
+			}},
+			calls: []call{
+				{name: "default EPERM", data: native(personality), want: errnoRet(unix.EPERM)},
+				{name: "errnoRet", data: native(mount), want: errnoRet(unix.ENOSYS)},
+				{name: "unmatched", data: native(write), want: retAllow},
+			},
+		},
+		{
+			name:    "default errno",
+			profile: Profile{DefaultAction: ActErrno, DefaultErrnoRet: uintPtr(uint(unix.EACCES)), Syscalls: []Syscall{{Names: []string{"write"}, Action: ActAllow}}},
+			calls: []call{
+				{name: "allowed", data: native(write), want: retAllow},
+				{name: "default", data: native(personality), want: errnoRet(unix.EACCES)},
+			},
+		},
+		{
+			name: "masked equal",
+			profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{
+				{Names: []string{"personality"}, Action: ActErrno, Args: []Arg{{Index: 0, Value: 0x0000_00ff, ValueTwo: 0x08, Op: OpMaskedEqual}}},
+				{Names: []string{"mount"}, Action: ActErrno, Args: []Arg{{Index: 3, Value: 0xff00_0000_0000_0001, ValueTwo: 0x0100_0000_0000_0000, Op: OpMaskedEqual}}},
+			}},
+			calls: []call{
+				{name: "low bits match", data: native(personality, 0x1008), want: errnoRet(unix.EPERM)},
+				{name: "low bits differ", data: native(personality, 0x1009), want: retAllow},
+				{name: "high bits ignored", data: native(personality, 0xffff_0000_0000_0008), want: errnoRet(unix.EPERM)},
+				{name: "high word match", data: native(mount, 0, 0, 0, 0x01ab_0000_0000_0000), want: errnoRet(unix.EPERM)},
+				{name: "high word differ", data: native(mount, 0, 0, 0, 0x02ab_0000_0000_0000), want: retAllow},
+				{name: "low word differ", data: native(mount, 0, 0, 0, 0x0100_0000_0000_0001), want: retAllow},
+			},
+		},
+		{
+			name: "comparisons",
+			profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{
+				{Names: []string{"write"}, Action: ActErrno, ErrnoRet: uintPtr(1), Args: []Arg{{Index: 0, Value: 1 << 32, Op: OpEqualTo}}},
+				{Names: []string{"write"}, Action: ActErrno, ErrnoRet: uintPtr(2), Args: []Arg{{Index: 1, Value: 1<<32 + 5, Op: OpGreaterThan}}},
+				{Names: []string{"write"}, Action: ActErrno, ErrnoRet: uintPtr(3), Args: []Arg{{Index: 2, Value: 1<<32 + 5, Op: OpLessThan}}},
+				{Names: []string{"write"}, Action: ActErrno, ErrnoRet: uintPtr(4), Args: []Arg{{Index: 3, Value: 7, Op: OpNotEqual}}},
+			}},
+			calls: []call{
+				// 参数 1、2 取中间值使后续规则不匹配，参数 3 为 7 使 NE 不匹配
+				{name: "eq high word", data: native(write, 1<<32, 1<<32+5, 1<<32+5, 7), want: errnoRet(1)},
+				{name: "eq low word only", data: native(write, 1, 1<<32+5, 1<<32+5, 7), want: retAllow},
+				{name: "gt high word", data: native(write, 0, 2<<32, 1<<32+5, 7), want: errnoRet(2)},
+				{name: "gt low word", data: native(write, 0, 1<<32+6, 1<<32+5, 7), want: errnoRet(2)},
+				{name: "gt smaller high word", data: native(write, 0, 0xffff_ffff, 1<<32+5, 7), want: retAllow},
+				{name: "lt high word", data: native(write, 0, 1<<32+5, 0xffff_ffff, 7), want: errnoRet(3)},
+				{name: "lt low word", data: native(write, 0, 1<<32+5, 1<<32+4, 7), want: errnoRet(3)},
+				{name: "lt larger high word", data: native(write, 0, 1<<32+5, 2<<32, 7), want: retAllow},
+				{name: "ne high word", data: native(write, 0, 1<<32+5, 1<<32+5, 1<<32+7), want: errnoRet(4)},
+				{name: "ne equal", data: native(write, 0, 1<<32+5, 1<<32+5, 7), want: retAllow},
+			},
+		},
+		{
+			name: "ge and le",
+			profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{
+				{Names: []string{"write"}, Action: ActErrno, ErrnoRet: uintPtr(1), Args: []Arg{{Index: 0, Value: 10, Op: OpGreaterEqual}, {Index: 0, Value: 20, Op: OpLessEqual}}},
+			}},
+			calls: []call{
+				{name: "below", data: native(write, 9), want: retAllow},
+				{name: "lower bound", data: native(write, 10), want: errnoRet(1)},
+				{name: "upper bound", data: native(write, 20), want: errnoRet(1)},
+				{name: "above", data: native(write, 21), want: retAllow},
+			},
+		},
+		{
+			name: "capabilities",
+			profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{
+				{Names: []string{"mount"}, Action: ActErrno, Excludes: Filter{Caps: []string{"CAP_SYS_ADMIN"}}},
+				{Names: []string{"personality"}, Action: ActErrno, Includes: Filter{Caps: []string{"CAP_SYS_ADMIN", "CAP_NET_ADMIN"}}},
+			}},
+			calls: []call{
+				{name: "excluded without cap", data: native(mount), want: errnoRet(unix.EPERM)},
+				{name: "excluded with cap", caps: []string{"CAP_SYS_ADMIN"}, data: native(mount), want: retAllow},
+				{name: "included without cap", caps: []string{"CAP_SYS_ADMIN"}, data: native(personality), want: retAllow},
+				{name: "included with caps", caps: []string{"CAP_SYS_ADMIN", "CAP_NET_ADMIN"}, data: native(personality), want: errnoRet(unix.EPERM)},
+			},
+		},
+		{
+			name: "other actions",
+			profile: Profile{DefaultAction: ActKillProcess, Syscalls: []Syscall{
+				{Names: []string{"write"}, Action: ActLog},
+				{Names: []string{"personality"}, Action: ActKill},
+				{Names: []string{"mount"}, Action: ActTrap},
+			}},
+			calls: []call{
+				{name: "log", data: native(write), want: retLog},
+				{name: "kill", data: native(personality), want: retKillThread},
+				{name: "trap", data: native(mount), want: retTrap},
+				{name: "default", data: native(syscallNumbers["read"]), want: retKillProcess},
+			},
+		},
+	}
+	if x32SyscallBit != 0 {
+		tests = append(tests, struct {
+			name    string
+			profile Profile
+			calls   []call
+		}{
+			name:    "x32",
+			profile: Profile{DefaultAction: ActAllow},
+			calls: []call{
+				{name: "x32 syscall", data: native(x32SyscallBit | write), want: errnoRet(unix.ENOSYS)},
+			},
+		})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, c := range tt.calls {
+				prog, err := tt.profile.Compile(c.caps)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := runFilter(t, prog, c.data); got != c.want {
+					t.Errorf("%s: ret = %#x, want %#x", c.name, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultProfile(t *testing.T) {
+	const cloneNewUser = unix.CLONE_NEWUSER
+	tests := []struct {
+		name string
+		caps []string
+		nr   uint32
+		args []uint64
+		want uint32
+	}{
+		{name: "write", nr: syscallNumbers["write"], want: retAllow},
+		{name: "keyctl", nr: syscallNumbers["keyctl"], want: errnoRet(unix.EPERM)},
+		{name: "unshare", nr: syscallNumbers["unshare"], want: errnoRet(unix.EPERM)},
+		{name: "unshare with CAP_SYS_ADMIN", caps: []string{"CAP_SYS_ADMIN"}, nr: syscallNumbers["unshare"], want: retAllow},
+		{name: "clone thread", nr: syscallNumbers["clone"], args: []uint64{unix.CLONE_VM | unix.CLONE_THREAD}, want: retAllow},
+		{name: "clone new user namespace", nr: syscallNumbers["clone"], args: []uint64{cloneNewUser}, want: errnoRet(unix.EPERM)},
+		{name: "clone3", nr: syscallNumbers["clone3"], want: errnoRet(unix.ENOSYS)},
+	}
+	profile := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, err := profile.Compile(tt.caps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := seccompData{nr: tt.nr, arch: nativeArch}
+			copy(data.args[:], tt.args)
+			if got := runFilter(t, prog, data); got != tt.want {
+				t.Errorf("ret = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+	}{
+		{name: "default action", profile: Profile{DefaultAction: "SCMP_ACT_FOO"}},
+		{name: "rule action", profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{{Names: []string{"write"}, Action: "SCMP_ACT_FOO"}}}},
+		{name: "operator", profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{{Names: []string{"write"}, Action: ActErrno, Args: []Arg{{Op: "SCMP_CMP_FOO"}}}}}},
+		{name: "argument index", profile: Profile{DefaultAction: ActAllow, Syscalls: []Syscall{{Names: []string{"write"}, Action: ActErrno, Args: []Arg{{Index: maxArgs, Op: OpEqualTo}}}}}},
+	}
+	for _, tt := range tests {
+		if _, err := tt.profile.Compile(nil); err == nil {
+			t.Errorf("%s: Compile succeeded, want error", tt.name)
+		}
+	}
+}
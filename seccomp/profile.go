@@ -0,0 +1,176 @@
+package seccomp
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Unconfined --security-opt seccomp=unconfined 表示不过滤系统调用
+const Unconfined = "unconfined"
+
+// Action 命中规则（或未命中任何规则）时的处理方式
+type Action string
+
+const (
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillThread  Action = "SCMP_ACT_KILL_THREAD"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActTrap        Action = "SCMP_ACT_TRAP"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActTrace       Action = "SCMP_ACT_TRACE"
+	ActLog         Action = "SCMP_ACT_LOG"
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+)
+
+// Operator 参数比较方式
+type Operator string
+
+const (
+	OpNotEqual     Operator = "SCMP_CMP_NE"
+	OpLessThan     Operator = "SCMP_CMP_LT"
+	OpLessEqual    Operator = "SCMP_CMP_LE"
+	OpEqualTo      Operator = "SCMP_CMP_EQ"
+	OpGreaterEqual Operator = "SCMP_CMP_GE"
+	OpGreaterThan  Operator = "SCMP_CMP_GT"
+	OpMaskedEqual  Operator = "SCMP_CMP_MASKED_EQ"
+)
+
+// Profile Docker/OCI 格式的 seccomp 配置，按顺序匹配规则，未命中时执行 DefaultAction
+// 只处理本机架构的系统调用，其他架构（如 amd64 上的 32 位调用）的系统调用返回 ENOSYS
+type Profile struct {
+	DefaultAction   Action    `json:"defaultAction"`
+	DefaultErrnoRet *uint     `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string  `json:"architectures,omitempty"`
+	Syscalls        []Syscall `json:"syscalls"`
+}
+
+// Syscall 一条规则：Names 中的系统调用在参数满足 Args 中全部条件时执行 Action
+type Syscall struct {
+	Names    []string `json:"names"`
+	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []Arg    `json:"args,omitempty"`
+	Includes Filter   `json:"includes,omitempty"`
+	Excludes Filter   `json:"excludes,omitempty"`
+}
+
+// Arg 系统调用第 Index 个参数的条件，MASKED_EQ 时 Value 为掩码、ValueTwo 为期望值
+type Arg struct {
+	Index    uint     `json:"index"`
+	Value    uint64   `json:"value"`
+	ValueTwo uint64   `json:"valueTwo,omitempty"`
+	Op       Operator `json:"op"`
+}
+
+// Filter 规则的生效条件：Includes 中的条件全部满足、Excludes 中的条件都不满足时规则才生效
+type Filter struct {
+	Caps      []string `json:"caps,omitempty"`
+	Arches    []string `json:"arches,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+//go:embed default.json
+var defaultProfile []byte
+
+// Default 默认配置：允许所有系统调用，只拒绝可用于攻击宿主机内核或逃逸容器的调用，
+// 其中挂载、创建命名空间等调用在容器拥有相应能力时放行
+func Default() *Profile {
+	profile, err := Parse(defaultProfile)
+	if err != nil {
+		panic(fmt.Sprintf("parse default seccomp profile: %v", err))
+	}
+	return profile
+}
+
+// Read 读取 JSON 格式的 seccomp 配置文件并检查其内容
+func Read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read seccomp profile: %w", err)
+	}
+	if _, err := Parse(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Parse 解析 JSON 格式的 seccomp 配置，并检查其能否编译
+func Parse(data []byte) (*Profile, error) {
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("parse seccomp profile: %w", err)
+	}
+	if _, err := profile.Compile(nil); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// applies 规则对拥有 caps 能力的进程是否生效
+func (s *Syscall) applies(caps []string) bool {
+	for _, capability := range s.Includes.Caps {
+		if !slices.Contains(caps, capability) {
+			return false
+		}
+	}
+	for _, capability := range s.Excludes.Caps {
+		if slices.Contains(caps, capability) {
+			return false
+		}
+	}
+	if len(s.Includes.Arches) > 0 && !matchesArch(s.Includes.Arches) {
+		return false
+	}
+	if matchesArch(s.Excludes.Arches) {
+		return false
+	}
+	if s.Includes.MinKernel != "" && !kernelAtLeast(s.Includes.MinKernel) {
+		return false
+	}
+	if s.Excludes.MinKernel != "" && kernelAtLeast(s.Excludes.MinKernel) {
+		return false
+	}
+	return true
+}
+
+// matchesArch arches 中是否包含本机架构
+func matchesArch(arches []string) bool {
+	for _, arch := range arches {
+		if slices.Contains(archNames, arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// kernelAtLeast 当前内核版本是否不低于 major.minor 格式的 version，无法判断时视为满足
+func kernelAtLeast(version string) bool {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return true
+	}
+	current := parseKernelVersion(unix.ByteSliceToString(uts.Release[:]))
+	required := parseKernelVersion(version)
+	if current[0] != required[0] {
+		return current[0] > required[0]
+	}
+	return current[1] >= required[1]
+}
+
+// parseKernelVersion 解析 6.1.0-xx 形式版本号中的主版本号和次版本号
+func parseKernelVersion(version string) [2]int {
+	var parsed [2]int
+	parts := strings.SplitN(version, ".", 3)
+	for i := 0; i < len(parts) && i < 2; i++ {
+		digits := strings.TrimRightFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' })
+		parsed[i], _ = strconv.Atoi(digits)
+	}
+	return parsed
+}
@@ -31,14 +31,14 @@ section() {
 
 cleanup() {
     echo "清理环境..."
-    $DUCKER stop test-bg test-cpu test-mem test-net test-port 2>/dev/null || true
-    $DUCKER rm test-bg test-cpu test-mem test-net test-port 2>/dev/null || true
+    $DUCKER stop test-bg test-cpu test-mem test-net test-port test-restart test-always test-attach test-tick test-update test-ns test-device test-userns 2>/dev/null || true
+    $DUCKER rm test-bg test-cpu test-mem test-net test-port test-restart test-always test-attach test-tick test-update test-ns test-device test-userns 2>/dev/null || true
     $DUCKER volume rm test-vol 2>/dev/null || true
     $DUCKER network rm test-network 2>/dev/null || true
     $DUCKER rmi test-app:v1 2>/dev/null || true
     $DUCKER rmi loaded-alpine:latest 2>/dev/null || true
     $DUCKER rmi committed-image:v1 2>/dev/null || true
-    rm -f /tmp/test-alpine.tar.gz /tmp/copied-example.txt 2>/dev/null || true
+    rm -f /tmp/test-alpine.tar.gz /tmp/copied-example.txt /tmp/ducker-test.env /tmp/ducker-test-dev 2>/dev/null || true
 }
 
 # 开始
@@ -183,6 +183,19 @@ else
     fail "run -e"
 fi
 
+# 只读根文件系统上 --tmpfs 挂载点仍可写
+if $DUCKER run --rm --name test-ro --read-only --tmpfs /tmp alpine:latest /bin/sh -c 'touch /tmp/ok && echo tmpfs-ok; touch /rootfile 2>&1' 2>&1 | tr '\n' ' ' | grep -q "tmpfs-ok.*Read-only file system"; then
+    pass "run --read-only --tmpfs"
+else
+    fail "run --read-only --tmpfs"
+fi
+
+if $DUCKER run --rm --name test-tmpfs --tmpfs /data:size=1m,mode=1777 alpine:latest /bin/sh -c 'stat -c %a /data; grep " /data " /proc/mounts' 2>&1 | tr '\n' ' ' | grep -q "1777 .*noexec.*size=1024k"; then
+    pass "run --tmpfs options"
+else
+    fail "run --tmpfs options"
+fi
+
 if $DUCKER run -d --name test-cpu --cpus 0.5 alpine:latest /bin/sh -c "sleep 2" 2>&1; then
     pass "run --cpus"
 else
@@ -303,8 +316,233 @@ else
     fail "verify build"
 fi
 
-# 10. 清理
-section "10. 清理"
+# 10. 安全选项
+section "10. 安全选项"
+
+# 非 root 用户只获得 --cap-add 显式添加的能力
+if $DUCKER run --rm --name test-cap --user 1000 --cap-add NET_BIND_SERVICE alpine:latest /bin/sh -c "grep CapEff /proc/self/status" 2>&1 | grep -q "0000000000000400"; then
+    pass "run --user --cap-add"
+else
+    fail "run --user --cap-add"
+fi
+
+if $DUCKER run --rm --name test-cap --user 1000 alpine:latest /bin/sh -c "grep CapEff /proc/self/status" 2>&1 | grep -q "0000000000000000"; then
+    pass "run --user without capabilities"
+else
+    fail "run --user without capabilities"
+fi
+
+# --init 启动的 init 与用户命令受同样的能力限制
+if $DUCKER run --rm --name test-cap --init alpine:latest /bin/sh -c "grep CapEff /proc/1/status" 2>&1 | grep -q "00000000a80425fb"; then
+    pass "run --init confines init"
+else
+    fail "run --init confines init"
+fi
+
+# 11. 重启策略
+section "11. 重启策略"
+
+$DUCKER run -d --name test-restart --restart on-failure:2 alpine:latest /bin/sh -c "exit 1" >/dev/null 2>&1 || true
+$DUCKER run -d --name test-always --restart always alpine:latest /bin/sh -c "sleep 1" >/dev/null 2>&1 || true
+sleep 6
+
+# 达到最大重试次数后不再重启
+if $DUCKER inspect -f '{{.State.Status}} {{.RestartCount}}' test-restart 2>&1 | grep -q "exited 2"; then
+    pass "run --restart on-failure:2"
+else
+    fail "run --restart on-failure:2"
+fi
+
+if $DUCKER inspect -f '{{.RestartCount}}' test-always 2>&1 | grep -q "^[1-9]"; then
+    pass "run --restart always"
+else
+    fail "run --restart always"
+fi
+
+# 手动停止的容器不再重启
+$DUCKER stop test-always >/dev/null 2>&1 || true
+sleep 3
+if $DUCKER inspect -f '{{.State.Status}}' test-always 2>&1 | grep -q "exited"; then
+    pass "stop --restart always"
+else
+    fail "stop --restart always"
+fi
+
+$DUCKER rm test-restart test-always 2>/dev/null || true
+
+# 12. attach
+section "12. attach"
+
+$DUCKER run -d -i --name test-attach alpine:latest cat >/dev/null 2>&1 || true
+$DUCKER run -d --name test-tick alpine:latest /bin/sh -c "while true; do echo tick; sleep 1; done" >/dev/null 2>&1 || true
+sleep 1
+
+# ctrl-p,ctrl-q 断开后容器继续运行
+if (printf 'hello-attach\n'; sleep 1; printf '\020\021'; sleep 1) | $DUCKER attach test-attach 2>&1 | grep -q hello-attach && $DUCKER ps 2>&1 | grep -q test-attach; then
+    pass "attach detach"
+else
+    fail "attach detach"
+fi
+
+if (printf 'hello-keys\n'; sleep 1; printf '\030'; sleep 1) | $DUCKER attach --detach-keys ctrl-x test-attach 2>&1 | grep -q hello-keys && $DUCKER ps 2>&1 | grep -q test-attach; then
+    pass "attach --detach-keys"
+else
+    fail "attach --detach-keys"
+fi
+
+# 标准输入结束后 cat 退出，容器随之停止
+printf 'bye\n' | $DUCKER attach test-attach >/dev/null 2>&1 || true
+sleep 1
+if $DUCKER inspect -f '{{.State.Status}}' test-attach 2>&1 | grep -q "exited"; then
+    pass "attach stdin close"
+else
+    fail "attach stdin close"
+fi
+
+# 不转发信号，timeout 结束 attach 后容器继续运行
+if timeout 3 $DUCKER attach --no-stdin --sig-proxy=false test-tick 2>&1 | grep -q tick && $DUCKER ps 2>&1 | grep -q test-tick; then
+    pass "attach --no-stdin"
+else
+    fail "attach --no-stdin"
+fi
+
+$DUCKER stop test-tick 2>/dev/null || true
+$DUCKER rm test-attach test-tick 2>/dev/null || true
+
+# 13. 资源更新
+section "13. 资源更新"
+
+$DUCKER run -d --name test-update -m 64m alpine:latest /bin/sh -c "while true; do sleep 10; done" >/dev/null 2>&1 || true
+sleep 1
+
+# 容器内的 /sys/fs/cgroup 为自身的 cgroup，同时兼容 cgroup v1 和 v2
+if $DUCKER update -m 128m --pids-limit 20 test-update 2>&1 && $DUCKER exec test-update /bin/sh -c "cat /sys/fs/cgroup/memory.max /sys/fs/cgroup/memory/memory.limit_in_bytes /sys/fs/cgroup/pids.max /sys/fs/cgroup/pids/pids.max 2>/dev/null" 2>&1 | tr '\n' ' ' | grep -q "134217728 20"; then
+    pass "update -m --pids-limit"
+else
+    fail "update -m --pids-limit"
+fi
+
+if $DUCKER update -m -1 test-update 2>&1 && $DUCKER exec test-update /bin/sh -c "cat /sys/fs/cgroup/memory.max /sys/fs/cgroup/memory/memory.limit_in_bytes 2>/dev/null" 2>&1 | grep -Eqx "max|9223372036854771712"; then
+    pass "update -m -1"
+else
+    fail "update -m -1"
+fi
+
+$DUCKER stop test-update 2>/dev/null || true
+$DUCKER rm test-update 2>/dev/null || true
+
+# 14. exec
+section "14. exec"
+
+# test-bg 在镜像构建时已停止，exec 和命名空间测试需要其运行
+$DUCKER start test-bg >/dev/null 2>&1 || true
+sleep 1
+
+if $DUCKER exec -e MY_VAR=hello -w /tmp -u 1000 test-bg /bin/sh -c 'echo "$MY_VAR $(pwd) $(id -u)"' 2>&1 | grep -q "hello /tmp 1000"; then
+    pass "exec -e -w -u"
+else
+    fail "exec -e -w -u"
+fi
+
+printf '# comment\nFROM_FILE=yes\n' > /tmp/ducker-test.env
+if $DUCKER exec --env-file /tmp/ducker-test.env test-bg /bin/sh -c 'echo "FROM_FILE=$FROM_FILE"' 2>&1 | grep -q "FROM_FILE=yes"; then
+    pass "exec --env-file"
+else
+    fail "exec --env-file"
+fi
+
+$DUCKER exec -d test-bg /bin/sh -c "touch /tmp/exec-detached" >/dev/null 2>&1 || true
+sleep 1
+if $DUCKER exec test-bg ls /tmp/exec-detached 2>&1 | grep -q exec-detached; then
+    pass "exec -d"
+else
+    fail "exec -d"
+fi
+
+# --userns-remap 的容器中执行的命令留在宿主机的用户命名空间中，即使容器是特权容器也不具有任何能力
+$DUCKER run -d --name test-userns --userns-remap default --privileged alpine:latest sleep 300 >/dev/null 2>&1 || true
+sleep 1
+if $DUCKER exec test-userns grep CapEff /proc/self/status 2>&1 | grep -q "0000000000000000"; then
+    pass "exec --userns-remap without capabilities"
+else
+    fail "exec --userns-remap without capabilities"
+fi
+
+if $DUCKER exec --privileged test-userns true 2>&1 | grep -q "userns-remap" && $DUCKER exec --cap-add NET_ADMIN test-userns true 2>&1 | grep -q "userns-remap"; then
+    pass "exec --userns-remap rejects --privileged and --cap-add"
+else
+    fail "exec --userns-remap rejects --privileged and --cap-add"
+fi
+$DUCKER stop test-userns 2>/dev/null || true
+$DUCKER rm test-userns 2>/dev/null || true
+
+# 15. 命名空间
+section "15. 命名空间"
+
+if [ "$($DUCKER run --rm --name test-ns --pid host alpine:latest cat /proc/1/comm 2>&1)" = "$(cat /proc/1/comm)" ]; then
+    pass "run --pid host"
+else
+    fail "run --pid host"
+fi
+
+if [ "$($DUCKER run --rm --name test-ns --uts host alpine:latest hostname 2>&1)" = "$(hostname)" ]; then
+    pass "run --uts host"
+else
+    fail "run --uts host"
+fi
+
+if [ "$($DUCKER run --rm --name test-ns --ipc host alpine:latest readlink /proc/self/ns/ipc 2>&1)" = "$(readlink /proc/self/ns/ipc)" ]; then
+    pass "run --ipc host"
+else
+    fail "run --ipc host"
+fi
+
+# 加入其他容器的网络命名空间时使用该容器的主机名
+if [ "$($DUCKER run --rm --name test-ns --network container:test-bg alpine:latest hostname 2>&1)" = "$($DUCKER inspect -f '{{.ID}}' test-bg)" ]; then
+    pass "run --network container:"
+else
+    fail "run --network container:"
+fi
+
+if $DUCKER run --rm --name test-ns --pid container:test-bg alpine:latest ps 2>&1 | grep -q "while true"; then
+    pass "run --pid container:"
+else
+    fail "run --pid container:"
+fi
+
+if [ "$($DUCKER run --rm --name test-ns --ipc container:test-bg alpine:latest readlink /proc/self/ns/ipc 2>&1)" = "$($DUCKER exec test-bg readlink /proc/self/ns/ipc 2>&1)" ]; then
+    pass "run --ipc container:"
+else
+    fail "run --ipc container:"
+fi
+
+# 16. 设备
+section "16. 设备"
+
+if $DUCKER run --rm --name test-device --device /dev/null:/dev/mynull alpine:latest /bin/sh -c "echo x > /dev/mynull && echo device-ok" 2>&1 | grep -q device-ok; then
+    pass "run --device"
+else
+    fail "run --device"
+fi
+
+# 主设备号 42 保留给示例使用，没有驱动：放行时打开失败为 No such device，被 cgroup 拒绝时为 Operation not permitted
+rm -f /tmp/ducker-test-dev
+mknod /tmp/ducker-test-dev c 42 0
+if $DUCKER run --rm --name test-device --device /tmp/ducker-test-dev:/dev/mydev:r alpine:latest /bin/sh -c "cat /dev/mydev; echo x > /dev/mydev" 2>&1 | tr '\n' ' ' | grep -q "No such device.*Operation not permitted"; then
+    pass "run --device permissions"
+else
+    fail "run --device permissions"
+fi
+
+if $DUCKER run --rm --name test-device alpine:latest /bin/sh -c "mknod /tmp/dev c 42 0 && cat /tmp/dev" 2>&1 | grep -q "Operation not permitted"; then
+    pass "device not allowed by default"
+else
+    fail "device not allowed by default"
+fi
+rm -f /tmp/ducker-test-dev
+
+# 17. 清理
+section "17. 清理"
 
 if $DUCKER stop test-bg 2>/dev/null; $DUCKER rm test-bg 2>&1; then
     pass "rm container"
@@ -339,7 +577,7 @@ echo -e "${GREEN}通过: $PASSED${NC}"
 echo -e "${RED}失败: $FAILED${NC}"
 echo "=========================================="
 
-rm -f /tmp/test-alpine.tar.gz /tmp/copied-example.txt
+rm -f /tmp/test-alpine.tar.gz /tmp/copied-example.txt /tmp/ducker-test.env
 $DUCKER rmi loaded-alpine:latest committed-image:v1 2>/dev/null || true
 
 if [ $FAILED -eq 0 ]; then
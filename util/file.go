@@ -8,6 +8,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 func EnsureDir(dir string) error {
@@ -17,6 +21,49 @@ func EnsureDir(dir string) error {
 	return nil
 }
 
+// IsMountPoint 判断目录是否为挂载点（与父目录不在同一设备上），目录不存在时返回 false
+func IsMountPoint(dir string) (bool, error) {
+	var st, parent syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat %s: %w", dir, err)
+	}
+	if err := syscall.Stat(filepath.Dir(dir), &parent); err != nil {
+		return false, fmt.Errorf("stat %s: %w", filepath.Dir(dir), err)
+	}
+	return st.Dev != parent.Dev, nil
+}
+
+// OverlayLowerDir 将由底层到顶层排列的镜像层转换为 overlay 的 lowerdir 参数，overlay 要求上层在前
+func OverlayLowerDir(layers []string) string {
+	dirs := make([]string, len(layers))
+	for i, layer := range layers {
+		dirs[len(layers)-1-i] = layer
+	}
+	return strings.Join(dirs, ":")
+}
+
+// IDMapMount 将 source 绑定挂载到 target，挂载内的文件属主按 usernsFd 指向的用户命名空间的映射转换：
+// 磁盘上属于映射内 ID n 的文件显示为宿主机上对应的 ID，经由挂载写入时反向转换
+func IDMapMount(source, target string, usernsFd int) error {
+	tree, err := unix.OpenTree(unix.AT_FDCWD, source, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("clone mount %s: %w", source, err)
+	}
+	defer unix.Close(tree)
+
+	attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_IDMAP, Userns_fd: uint64(usernsFd)}
+	if err := unix.MountSetattr(tree, "", unix.AT_EMPTY_PATH, attr); err != nil {
+		return fmt.Errorf("set idmap on %s: %w", source, err)
+	}
+	if err := unix.MoveMount(tree, "", unix.AT_FDCWD, target, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+		return fmt.Errorf("mount %s: %w", target, err)
+	}
+	return nil
+}
+
 func GetDirSize(dir string) int64 {
 	var size int64
 	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
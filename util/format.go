@@ -1,7 +1,11 @@
 package util
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
+	"text/template"
 	"time"
 )
 
@@ -25,15 +29,56 @@ func FormatSize(bytes int64) string {
 }
 
 func FormatDuration(t time.Time) string {
+	return FormatElapsed(t) + " ago"
+}
+
+// FormatElapsed 返回从 t 到现在经过的时长描述，如 "5 minutes"
+func FormatElapsed(t time.Time) string {
 	d := time.Since(t)
 	switch {
 	case d < time.Minute:
-		return fmt.Sprintf("%d seconds ago", int(d.Seconds()))
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
 	case d < time.Hour:
-		return fmt.Sprintf("%d minutes ago", int(d.Minutes()))
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
 	case d < 24*time.Hour:
-		return fmt.Sprintf("%d hours ago", int(d.Hours()))
+		return fmt.Sprintf("%d hours", int(d.Hours()))
 	default:
-		return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	}
+}
+
+// inspectFuncs --format 模板中可用的辅助函数
+var inspectFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// PrintInspect 输出 inspect 结果
+// 未指定 format 时输出缩进的 JSON 数组，否则按 text/template 逐项渲染
+func PrintInspect(items []any, format string) error {
+	if format == "" {
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal inspect: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	tmpl, err := template.New("format").Funcs(inspectFuncs).Parse(format)
+	if err != nil {
+		return fmt.Errorf("parse format: %w", err)
+	}
+	for _, item := range items {
+		if err := tmpl.Execute(os.Stdout, item); err != nil {
+			return fmt.Errorf("execute format: %w", err)
+		}
+		fmt.Println()
 	}
+	return nil
 }
@@ -11,8 +11,7 @@ const (
 	volumeDir    = baseDir + "/volumes"
 	netDir       = baseDir + "/nets"
 
-	cgroupCPUDir    = "/sys/fs/cgroup/cpu"
-	cgroupMemoryDir = "/sys/fs/cgroup/memory"
+	cgroupRootDir = "/sys/fs/cgroup"
 )
 
 // ========== 容器相关路径 ==========
@@ -44,6 +43,39 @@ func GetContainerLogPath(containerID string) string {
 	return filepath.Join(GetContainerMergedDir(containerID), "var/log/container.log")
 }
 
+func GetContainerAttachSocketPath(containerID string) string {
+	return filepath.Join(GetContainerDir(containerID), "attach.sock")
+}
+
+func GetContainerIDMapDir(containerID string) string {
+	return filepath.Join(GetContainerDir(containerID), "idmap")
+}
+
+func GetContainerExecDir(containerID string) string {
+	return filepath.Join(GetContainerDir(containerID), "exec")
+}
+
+func GetContainerExecLogPath(containerID, execID string) string {
+	return filepath.Join(GetContainerExecDir(containerID), execID+".log")
+}
+
+func GetContainerHostnamePath(containerID string) string {
+	return filepath.Join(GetContainerDir(containerID), "hostname")
+}
+
+func GetContainerHostsPath(containerID string) string {
+	return filepath.Join(GetContainerDir(containerID), "hosts")
+}
+
+func GetContainerResolvConfPath(containerID string) string {
+	return filepath.Join(GetContainerDir(containerID), "resolv.conf")
+}
+
+// GetContainerBootIDPath 记录容器状态所属的主机启动 ID，用于发现主机重启
+func GetContainerBootIDPath() string {
+	return filepath.Join(GetContainerRootDir(), "boot_id")
+}
+
 // ========== 镜像相关路径 ==========
 func GetImageRootDir() string {
 	return imageDir
@@ -85,28 +117,8 @@ func GetVolumeConfigPath(name string) string {
 
 // ========== cgroup 相关路径 ==========
 
-func GetCgroupCPUPath(containerID string) string {
-	return filepath.Join(cgroupCPUDir, containerID)
-}
-
-func GetCgroupMemoryPath(containerID string) string {
-	return filepath.Join(cgroupMemoryDir, containerID)
-}
-
-func GetCPUQuotaPath(containerID string) string {
-	return filepath.Join(GetCgroupCPUPath(containerID), "cpu.cfs_quota_us")
-}
-
-func GetMemoryLimitPath(containerID string) string {
-	return filepath.Join(GetCgroupMemoryPath(containerID), "memory.limit_in_bytes")
-}
-
-func GetCPUTasksPath(containerID string) string {
-	return filepath.Join(GetCgroupCPUPath(containerID), "tasks")
-}
-
-func GetMemoryTasksPath(containerID string) string {
-	return filepath.Join(GetCgroupMemoryPath(containerID), "tasks")
+func GetCgroupRootDir() string {
+	return cgroupRootDir
 }
 
 // ========== 网络相关路径 ==========
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sigRTMax Linux 实时信号的最大编号
+const sigRTMax = 64
+
+// ParseSignal 解析信号，支持名称（SIGTERM、TERM）和编号（15）
+func ParseSignal(s string) (syscall.Signal, error) {
+	s = strings.TrimSpace(s)
+	if num, err := strconv.Atoi(s); err == nil {
+		if num <= 0 || num > sigRTMax {
+			return 0, fmt.Errorf("invalid signal: %s", s)
+		}
+		return syscall.Signal(num), nil
+	}
+
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("invalid signal: %s", s)
+	}
+	return sig, nil
+}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// User 解析后的用户身份
+type User struct {
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+	Home   string
+}
+
+// Credential 转换为启动进程使用的身份
+func (u *User) Credential() *syscall.Credential {
+	return &syscall.Credential{Uid: u.UID, Gid: u.GID, Groups: u.Groups}
+}
+
+// ResolveUser 按 rootfs 下的 /etc/passwd 和 /etc/group 解析 user[:group] 格式的用户，
+// 用户和组都可以是名称或数字 ID；数字用户不在 passwd 中时使用 GID 0，附加组为用户所属的所有组
+func ResolveUser(rootfs, spec string) (*User, error) {
+	userSpec, groupSpec, hasGroup := strings.Cut(spec, ":")
+	if userSpec == "" || hasGroup && groupSpec == "" {
+		return nil, fmt.Errorf("invalid user %q", spec)
+	}
+	passwdPath := filepath.Join(rootfs, "etc/passwd")
+	groupPath := filepath.Join(rootfs, "etc/group")
+
+	user := &User{Home: "/"}
+	name := ""
+	uid, numeric := parseID(userSpec)
+	found := false
+	err := forEachEntry(passwdPath, func(fields []string) bool {
+		if len(fields) < 6 {
+			return false
+		}
+		id, ok := parseID(fields[2])
+		if !ok || fields[0] != userSpec && !(numeric && id == uid) {
+			return false
+		}
+		gid, _ := parseID(fields[3])
+		name, user.UID, user.GID, user.Home = fields[0], id, gid, fields[5]
+		found = true
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read passwd: %w", err)
+	}
+	if !found {
+		if !numeric {
+			return nil, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userSpec)
+		}
+		user.UID = uid
+	}
+
+	if hasGroup {
+		gid, numeric := parseID(groupSpec)
+		found := numeric
+		err := forEachEntry(groupPath, func(fields []string) bool {
+			if len(fields) < 3 || fields[0] != groupSpec {
+				return false
+			}
+			gid, found = parseID(fields[2])
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read group: %w", err)
+		}
+		if !found {
+			return nil, fmt.Errorf("unable to find group %s: no matching entries in group file", groupSpec)
+		}
+		user.GID = gid
+	}
+
+	user.Groups = []uint32{user.GID}
+	if name != "" {
+		forEachEntry(groupPath, func(fields []string) bool {
+			if len(fields) < 4 {
+				return false
+			}
+			for _, member := range strings.Split(fields[3], ",") {
+				if gid, ok := parseID(fields[2]); ok && member == name && gid != user.GID {
+					user.Groups = append(user.Groups, gid)
+				}
+			}
+			return false
+		})
+	}
+	return user, nil
+}
+
+// forEachEntry 按冒号分隔逐行遍历 passwd/group 格式的文件，fn 返回 true 时停止
+func forEachEntry(path string, fn func(fields []string) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fn(strings.Split(line, ":")) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+func parseID(s string) (uint32, bool) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	return uint32(id), err == nil
+}
@@ -67,20 +67,37 @@ func Remove(name string) error {
 	return os.RemoveAll(util.GetVolumeDir(name))
 }
 
-func Inspect(name string) error {
+// InspectInfo 卷详情（inspect 输出结构）
+type InspectInfo struct {
+	ID         string
+	Name       string
+	Driver     string
+	CreatedAt  time.Time
+	Mountpoint string
+}
+
+// Inspect 获取卷详情
+func Inspect(name string) (*InspectInfo, error) {
 	vol, err := Get(name)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	info := map[string]any{
-		"ID":         vol.ID,
-		"Name":       vol.Name,
-		"CreatedAt":  vol.CreatedAt.Format(time.RFC3339),
-		"Mountpoint": util.GetVolumeDataDir(vol.Name),
+	return &InspectInfo{
+		ID:         vol.ID,
+		Name:       vol.Name,
+		Driver:     "local",
+		CreatedAt:  vol.CreatedAt,
+		Mountpoint: util.GetVolumeDataDir(vol.Name),
+	}, nil
+}
+
+// ResolveSource 解析挂载源：绝对路径为 bind mount，否则为命名卷
+// 返回主机上的实际路径以及是否为命名卷
+func ResolveSource(source string) (hostPath string, named bool) {
+	if strings.HasPrefix(source, "/") {
+		return source, false
 	}
-	data, _ := json.MarshalIndent(info, "", "  ")
-	fmt.Println(string(data))
-	return nil
+	return util.GetVolumeDataDir(source), true
 }
 
 func List() error {
@@ -113,19 +130,21 @@ func List() error {
 	return nil
 }
 
-// Mount 挂载卷或目录到容器路径
+// Ensure 挂载源为命名卷时确保卷已创建
+func Ensure(source string) error {
+	if _, named := ResolveSource(source); !named {
+		return nil
+	}
+	if _, err := getOrCreate(source, true); err != nil {
+		return fmt.Errorf("get or create volume %s: %w", source, err)
+	}
+	return nil
+}
+
+// Mount 挂载卷或目录到容器路径，命名卷需要事先通过 Ensure 创建
 func Mount(sourcePath, containerPath, mergedDir string) error {
 	containerPath = filepath.Join(mergedDir, containerPath)
-
-	var hostPath string
-	if strings.HasPrefix(sourcePath, "/") {
-		hostPath = sourcePath
-	} else {
-		if _, err := getOrCreate(sourcePath, true); err != nil {
-			return fmt.Errorf("get or create volume %s: %w", sourcePath, err)
-		}
-		hostPath = util.GetVolumeDataDir(sourcePath)
-	}
+	hostPath, _ := ResolveSource(sourcePath)
 
 	hostInfo, err := os.Stat(hostPath)
 	if err != nil {